@@ -0,0 +1,438 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Principal identifies an authenticated caller.
+type Principal struct {
+	// ID identifies the caller, e.g. a user name or a key ID.
+	ID string
+
+	// Scheme is the authentication scheme the caller was authenticated by.
+	Scheme string
+
+	// Attributes hold additional information such as roles or token claims.
+	Attributes map[string]interface{}
+}
+
+type principalKey struct{}
+
+// WithPrincipal injects the Principal into the given context.
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext extracts the Principal from the given context.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
+
+// ErrUnauthenticated is returned when a request lacks valid credentials.
+var ErrUnauthenticated = errors.New("authentication required")
+
+// ErrForbidden is returned when a Principal may not perform an operation.
+var ErrForbidden = errors.New("operation is forbidden")
+
+// Authenticator authenticates the caller of a request. It returns a nil
+// Principal and nil error if the request does not carry the credentials it
+// handles, and an error if the credentials are invalid.
+type Authenticator interface {
+	Authenticate(*http.Request) (*Principal, error)
+
+	// Challenge returns the WWW-Authenticate challenge for the scheme.
+	Challenge() string
+}
+
+// TokenVerifier verifies a token or key, returning the Principal it
+// identifies or an error if it is invalid. The error is only shown to the
+// caller if it is a ServiceError.
+type TokenVerifier func(ctx context.Context, token string) (*Principal, error)
+
+// PasswordVerifier verifies a user name and password, returning the Principal
+// it identifies or an error if the credentials are invalid. The error is only
+// shown to the caller if it is a ServiceError.
+type PasswordVerifier func(ctx context.Context, username, password string) (*Principal, error)
+
+type bearerAuthenticator struct {
+	verify TokenVerifier
+	realm  string
+}
+
+// BearerToken creates an Authenticator for bearer tokens given in the
+// Authorization header.
+func BearerToken(realm string, verify TokenVerifier) Authenticator {
+	return bearerAuthenticator{verify: verify, realm: realm}
+}
+
+func (a bearerAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return nil, nil
+	}
+	principal, err := a.verify(r.Context(), strings.TrimSpace(token))
+	return verified(principal, err, "Bearer")
+}
+
+func (a bearerAuthenticator) Challenge() string {
+	return fmt.Sprintf("Bearer realm=%q", a.realm)
+}
+
+type apiKeyAuthenticator struct {
+	header string
+	verify TokenVerifier
+}
+
+// APIKey creates an Authenticator for API keys given in the named header.
+func APIKey(header string, verify TokenVerifier) Authenticator {
+	return apiKeyAuthenticator{header: header, verify: verify}
+}
+
+func (a apiKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(a.header)
+	if key == "" {
+		return nil, nil
+	}
+	principal, err := a.verify(r.Context(), key)
+	return verified(principal, err, "APIKey")
+}
+
+func (a apiKeyAuthenticator) Challenge() string {
+	return fmt.Sprintf("APIKey header=%q", a.header)
+}
+
+type basicAuthenticator struct {
+	verify PasswordVerifier
+	realm  string
+}
+
+// BasicAuth creates an Authenticator for HTTP basic authentication.
+func BasicAuth(realm string, verify PasswordVerifier) Authenticator {
+	return basicAuthenticator{verify: verify, realm: realm}
+}
+
+func (a basicAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+	principal, err := a.verify(r.Context(), username, password)
+	return verified(principal, err, "Basic")
+}
+
+func (a basicAuthenticator) Challenge() string {
+	return fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", a.realm)
+}
+
+// verified completes the result of a verifier with the scheme.
+func verified(principal *Principal, err error, scheme string) (*Principal, error) {
+	if err != nil {
+		return nil, err
+	}
+	if principal == nil {
+		return nil, ErrUnauthenticated
+	}
+	if principal.Scheme == "" {
+		principal.Scheme = scheme
+	}
+	return principal, nil
+}
+
+// Authenticate creates an InterfaceMiddleware authenticating every request
+// with the first Authenticator which finds credentials in it. Requests without
+// valid credentials are rejected with a 401 Problem unless optional is true,
+// in which case requests without any credentials pass through anonymously.
+func Authenticate(optional bool, authenticators ...Authenticator) InterfaceMiddleware {
+	return InterfaceMiddlewareFunc(func(op Operation, next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			for _, authenticator := range authenticators {
+				principal, err := authenticator.Authenticate(r)
+				if err != nil {
+					unauthorized(w, err, authenticators)
+					return
+				}
+				if principal != nil {
+					next(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+					return
+				}
+			}
+
+			if !optional {
+				unauthorized(w, ErrUnauthenticated, authenticators)
+				return
+			}
+
+			next(w, r)
+		}
+	})
+}
+
+// unauthorized responds with a 401 Problem and the authentication challenges.
+// Errors other than ServiceErrors are not shown so that the reason why the
+// credentials were rejected does not leak.
+func unauthorized(w http.ResponseWriter, err error, authenticators []Authenticator) {
+	for _, authenticator := range authenticators {
+		w.Header().Add("WWW-Authenticate", authenticator.Challenge())
+	}
+	if _, ok := errors.Cause(err).(ServiceError); !ok {
+		err = NewServiceError(ErrUnauthenticated, http.StatusUnauthorized)
+	}
+	HandleError(err, w)
+}
+
+// Authorizer decides if the Principal in the context may perform an
+// operation. The model is nil for checks on a collection as a whole and the
+// affected value otherwise. Return ErrUnauthenticated or ErrForbidden (or a
+// ServiceError) to deny the operation.
+type Authorizer interface {
+	Authorize(ctx context.Context, op Operation, model Model) error
+}
+
+// AuthorizerFunc is an adapter to use ordinary functions as Authorizers.
+type AuthorizerFunc func(ctx context.Context, op Operation, model Model) error
+
+// Authorize calls f(ctx, op, model).
+func (f AuthorizerFunc) Authorize(ctx context.Context, op Operation, model Model) error {
+	return f(ctx, op, model)
+}
+
+// authError maps an error to a ServiceError with a 401 or 403 status code.
+func authError(err error) error {
+	switch cause := errors.Cause(err); cause {
+	case nil:
+		return nil
+	case ErrUnauthenticated:
+		return NewServiceError(cause, http.StatusUnauthorized)
+	default:
+		if _, ok := cause.(ServiceError); ok {
+			return cause
+		}
+		return NewServiceError(err, http.StatusForbidden)
+	}
+}
+
+// Authorize creates a ServiceMiddleware consulting the Authorizer before
+// every operation. Values affected by an operation on a single key are
+// selected first so that the Authorizer can decide based on the value, e.g.
+// to only allow owners to modify it. Browse leaves out values the Principal
+// may not select and Delete fails if any of the matched values may not be
+// removed.
+//
+// The values written by Create, Update, Modify and Revert and the values
+// removed by Remove and Delete are authorized again by Before hooks injected
+// with WithContextHooks, so that the Authorizer sees the new or merged value
+// and a value changed concurrently cannot slip through. This requires a
+// Service running Hooks, like the Services of this package. As Hooks may run
+// while the Service is locked, the Authorizer must not call back into it.
+func Authorize(authorizer Authorizer) ServiceMiddleware {
+	return func(service Service) Service {
+		return authorizedService{service: service, authorizer: authorizer}
+	}
+}
+
+type authorizedService struct {
+	service    Service
+	authorizer Authorizer
+}
+
+func (s authorizedService) authorize(ctx context.Context, op Operation, model Model) error {
+	return authError(s.authorizer.Authorize(ctx, op, model))
+}
+
+// checked injects Hooks into the context authorizing the operation for the
+// values it writes or removes.
+func (s authorizedService) checked(ctx context.Context, op Operation) context.Context {
+	check := func(ctx context.Context, model Model) error {
+		return s.authorize(ctx, op, model)
+	}
+	hooks := NewHooks()
+	for _, event := range []HookEvent{HookBeforeCreate, HookBeforeUpdate, HookBeforeModify, HookBeforeRemove} {
+		hooks.On(event, check)
+	}
+	return WithContextHooks(ctx, hooks)
+}
+
+// authorizeKey selects the value for the key and authorizes the operation.
+func (s authorizedService) authorizeKey(ctx context.Context, op Operation, key string) error {
+	if err := s.authorize(ctx, op, nil); err != nil {
+		return err
+	}
+	model, err := s.service.Select(ctx, key)
+	if err != nil {
+		return err
+	}
+	return s.authorize(ctx, op, model)
+}
+
+func (s authorizedService) Browse(ctx context.Context) ([]Model, error) {
+	if err := s.authorize(ctx, OpBrowse, nil); err != nil {
+		return nil, err
+	}
+
+	list, err := s.service.Browse(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := make([]Model, 0, len(list))
+	for _, model := range list {
+		if s.authorize(ctx, OpSelect, model) == nil {
+			allowed = append(allowed, model)
+		}
+	}
+	return allowed, nil
+}
+
+func (s authorizedService) Delete(ctx context.Context) ([]Model, error) {
+	if err := s.authorize(ctx, OpDelete, nil); err != nil {
+		return nil, err
+	}
+
+	list, err := s.service.Browse(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, model := range list {
+		if err := s.authorize(ctx, OpRemove, model); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.service.Delete(s.checked(ctx, OpRemove))
+}
+
+func (s authorizedService) Create(ctx context.Context, reader io.Reader) (Model, error) {
+	if err := s.authorize(ctx, OpCreate, nil); err != nil {
+		return nil, err
+	}
+	return s.service.Create(s.checked(ctx, OpCreate), reader)
+}
+
+func (s authorizedService) Select(ctx context.Context, key string) (Model, error) {
+	if err := s.authorize(ctx, OpSelect, nil); err != nil {
+		return nil, err
+	}
+
+	model, err := s.service.Select(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.authorize(ctx, OpSelect, model); err != nil {
+		return nil, err
+	}
+
+	return model, nil
+}
+
+func (s authorizedService) Remove(ctx context.Context, key string) (Model, error) {
+	if err := s.authorizeKey(ctx, OpRemove, key); err != nil {
+		return nil, err
+	}
+	return s.service.Remove(s.checked(ctx, OpRemove), key)
+}
+
+func (s authorizedService) Update(ctx context.Context, key string, reader io.Reader) (Model, error) {
+	if err := s.authorizeKey(ctx, OpUpdate, key); err != nil {
+		return nil, err
+	}
+	return s.service.Update(s.checked(ctx, OpUpdate), key, reader)
+}
+
+func (s authorizedService) Modify(ctx context.Context, key string, reader io.Reader) (Model, error) {
+	if err := s.authorizeKey(ctx, OpModify, key); err != nil {
+		return nil, err
+	}
+	return s.service.Modify(s.checked(ctx, OpModify), key, reader)
+}
+
+func (s authorizedService) SelectWithDeleted(ctx context.Context, key string) (Model, error) {
+	if err := s.authorize(ctx, OpSelect, nil); err != nil {
+		return nil, err
+	}
+
+	model, err := asSoftDeleter(s.service).SelectWithDeleted(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.authorize(ctx, OpSelect, model); err != nil {
+		return nil, err
+	}
+
+	return model, nil
+}
+
+func (s authorizedService) Restore(ctx context.Context, key string) (Model, error) {
+	if err := s.authorize(ctx, OpRestore, nil); err != nil {
+		return nil, err
+	}
+
+	deleter := asSoftDeleter(s.service)
+
+	model, err := deleter.SelectWithDeleted(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.authorize(ctx, OpRestore, model); err != nil {
+		return nil, err
+	}
+
+	return deleter.Restore(ctx, key)
+}
+
+func (s authorizedService) FilterParams() []string {
+	return filterParams(s.service)
+}
+
+func (s authorizedService) Purge(ctx context.Context) ([]Model, error) {
+	if err := s.authorize(ctx, OpPurge, nil); err != nil {
+		return nil, err
+	}
+	return asSoftDeleter(s.service).Purge(ctx)
+}
+
+func (s authorizedService) Revisions(ctx context.Context, key string) ([]Revision, error) {
+	if err := s.authorizeKey(ctx, OpRevisions, key); err != nil {
+		return nil, err
+	}
+	return asReverter(s.service).Revisions(ctx, key)
+}
+
+func (s authorizedService) SelectRevision(ctx context.Context, key string, number int) (Model, error) {
+	if err := s.authorizeKey(ctx, OpRevisions, key); err != nil {
+		return nil, err
+	}
+	return asReverter(s.service).SelectRevision(ctx, key, number)
+}
+
+func (s authorizedService) Revert(ctx context.Context, key string, number int) (Model, error) {
+	if err := s.authorizeKey(ctx, OpRevert, key); err != nil {
+		return nil, err
+	}
+	return asReverter(s.service).Revert(s.checked(ctx, OpRevert), key, number)
+}
+
+func (s authorizedService) CreateWithTTL(ctx context.Context, reader io.Reader, ttl time.Duration) (Model, error) {
+	if err := s.authorize(ctx, OpCreate, nil); err != nil {
+		return nil, err
+	}
+	return asExpirer(s.service).CreateWithTTL(s.checked(ctx, OpCreate), reader, ttl)
+}
+
+func (s authorizedService) UpdateWithTTL(ctx context.Context, key string, reader io.Reader, ttl time.Duration) (Model, error) {
+	if err := s.authorizeKey(ctx, OpUpdate, key); err != nil {
+		return nil, err
+	}
+	return asExpirer(s.service).UpdateWithTTL(s.checked(ctx, OpUpdate), key, reader, ttl)
+}
@@ -0,0 +1,229 @@
+package rest_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/stretchr/testify/require"
+)
+
+func verifyToken(ctx context.Context, token string) (*rest.Principal, error) {
+	switch token {
+	case "admin", "user":
+		return &rest.Principal{ID: token}, nil
+	default:
+		return nil, rest.ErrUnauthenticated
+	}
+}
+
+func verifyPassword(ctx context.Context, username, password string) (*rest.Principal, error) {
+	if password != "secret" {
+		return nil, rest.ErrUnauthenticated
+	}
+	return verifyToken(ctx, username)
+}
+
+// authorizeTodo lets admins do anything and users only see and change todos
+// which are not done yet.
+func authorizeTodo(ctx context.Context, op rest.Operation, model rest.Model) error {
+	principal, ok := rest.PrincipalFromContext(ctx)
+	if !ok {
+		return rest.ErrUnauthenticated
+	}
+	if principal.ID == "admin" {
+		return nil
+	}
+	if op == rest.OpDelete {
+		return rest.ErrForbidden
+	}
+	if todo, ok := model.(*Todo); ok && todo.Done {
+		return rest.ErrForbidden
+	}
+	return nil
+}
+
+func TestAuthenticate(t *testing.T) {
+	var principal *rest.Principal
+	service := rest.ServiceFuncs{
+		Service: NewTodoDictService(),
+		BrowseFunc: func(ctx context.Context) ([]rest.Model, error) {
+			principal, _ = rest.PrincipalFromContext(ctx)
+			return nil, nil
+		},
+	}
+
+	authenticators := []rest.Authenticator{
+		rest.BearerToken("todos", verifyToken),
+		rest.APIKey("X-API-Key", verifyToken),
+		rest.BasicAuth("todos", verifyPassword),
+	}
+
+	iface := rest.Authenticate(false, authenticators...)(rest.NewServiceInterface(service))
+
+	t.Run("authenticates bearer tokens", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", "Bearer admin")
+		iface.Browse(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "admin", principal.ID)
+		require.Equal(t, "Bearer", principal.Scheme)
+	})
+
+	t.Run("authenticates API keys", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-API-Key", "user")
+		iface.Browse(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "user", principal.ID)
+		require.Equal(t, "APIKey", principal.Scheme)
+	})
+
+	t.Run("authenticates basic credentials", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.SetBasicAuth("user", "secret")
+		iface.Browse(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "user", principal.ID)
+		require.Equal(t, "Basic", principal.Scheme)
+	})
+
+	t.Run("rejects invalid credentials", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.SetBasicAuth("user", "wrong")
+		iface.Browse(w, r)
+
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+		require.Equal(t, rest.ProblemContentType, w.Header().Get("Content-Type"))
+		require.Len(t, w.Header()["Www-Authenticate"], len(authenticators))
+	})
+
+	t.Run("hides verifier errors", func(t *testing.T) {
+		iface := rest.Authenticate(false, rest.BearerToken("todos", func(ctx context.Context, token string) (*rest.Principal, error) {
+			return nil, errors.New("signing key 'k1' rejected the token")
+		}))(rest.NewServiceInterface(service))
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", "Bearer admin")
+		iface.Browse(w, r)
+
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+		require.NotContains(t, w.Body.String(), "signing key")
+	})
+
+	t.Run("rejects missing credentials", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		iface.Browse(w, r)
+
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+		require.Contains(t, w.Header().Get("WWW-Authenticate"), "Bearer")
+	})
+
+	t.Run("allows anonymous requests if optional", func(t *testing.T) {
+		iface := rest.Authenticate(true, authenticators...)(rest.NewServiceInterface(service))
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		iface.Browse(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Nil(t, principal)
+	})
+}
+
+func TestAuthorize(t *testing.T) {
+	service := rest.Authorize(rest.AuthorizerFunc(authorizeTodo))(NewTodoDictService())
+
+	admin := rest.WithPrincipal(emptyContext, &rest.Principal{ID: "admin"})
+	user := rest.WithPrincipal(emptyContext, &rest.Principal{ID: "user"})
+
+	for i := 0; i < 4; i++ {
+		data, err := json.Marshal(RandomTodo())
+		require.NoError(t, err)
+		_, err = service.Create(admin, bytes.NewReader(data))
+		require.NoError(t, err)
+	}
+
+	t.Run("rejects anonymous callers", func(t *testing.T) {
+		_, err := service.Browse(emptyContext)
+		require.Equal(t, http.StatusUnauthorized, err.(rest.ServiceError).Code)
+	})
+
+	t.Run("filters browsed values", func(t *testing.T) {
+		models, err := service.Browse(admin)
+		require.NoError(t, err)
+		require.Len(t, models, 4)
+
+		models, err = service.Browse(user)
+		require.NoError(t, err)
+		require.Len(t, models, 2)
+	})
+
+	t.Run("authorizes by value", func(t *testing.T) {
+		_, err := service.Select(user, "1")
+		require.Equal(t, http.StatusForbidden, err.(rest.ServiceError).Code)
+
+		_, err = service.Modify(user, "1", bytes.NewReader([]byte(`{"content":"foo"}`)))
+		require.Equal(t, http.StatusForbidden, err.(rest.ServiceError).Code)
+
+		_, err = service.Remove(user, "1")
+		require.Equal(t, http.StatusForbidden, err.(rest.ServiceError).Code)
+
+		_, err = service.Remove(user, "0")
+		require.NoError(t, err)
+
+		_, err = service.Remove(admin, "1")
+		require.NoError(t, err)
+	})
+
+	t.Run("authorizes written values", func(t *testing.T) {
+		_, err := service.Modify(user, "2", bytes.NewReader([]byte(`{"content":"foo","done":true}`)))
+		require.Equal(t, http.StatusForbidden, err.(rest.ServiceError).Code)
+
+		done := RandomTodo()
+		done.Done = true
+		_, err = service.Update(user, "2", bytes.NewReader(mustMarshal(done)))
+		require.Equal(t, http.StatusForbidden, err.(rest.ServiceError).Code)
+
+		model, err := service.Select(user, "2")
+		require.NoError(t, err)
+		require.False(t, model.(*Todo).Done)
+
+		_, err = service.Modify(admin, "2", bytes.NewReader([]byte(`{"content":"foo","done":true}`)))
+		require.NoError(t, err)
+	})
+
+	t.Run("authorizes collection operations", func(t *testing.T) {
+		_, err := service.Delete(user)
+		require.Equal(t, http.StatusForbidden, err.(rest.ServiceError).Code)
+
+		models, err := service.Delete(admin)
+		require.NoError(t, err)
+		require.Len(t, models, 2)
+	})
+
+	t.Run("responds with problems", func(t *testing.T) {
+		iface := rest.NewServiceInterface(service)
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		iface.Browse(w, r)
+
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+		require.Equal(t, rest.ProblemContentType, w.Header().Get("Content-Type"))
+	})
+}
@@ -0,0 +1,104 @@
+// Package boltkv provides a rest.KVStore backed by a bbolt database.
+package boltkv
+
+import (
+	"bytes"
+	"os"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultBucket is the bucket used by Open.
+const DefaultBucket = "rest"
+
+// Store is a rest.KVStore keeping its keys in a single bbolt bucket.
+type Store struct {
+	db     *bolt.DB
+	bucket []byte
+}
+
+// Open the bbolt database file at the given path, creating it if it does not
+// exist, and return a Store using its DefaultBucket.
+func Open(path string, mode os.FileMode, options *bolt.Options) (*Store, error) {
+	db, err := bolt.Open(path, mode, options)
+	if err != nil {
+		return nil, errors.Wrap(err, "in boltkv Open")
+	}
+
+	store, err := New(db, DefaultBucket)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// New creates a Store using the named bucket of the database, creating the
+// bucket if it does not exist.
+func New(db *bolt.DB, bucket string) (*Store, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "in boltkv New")
+	}
+	return &Store{db: db, bucket: []byte(bucket)}, nil
+}
+
+// DB returns the underlying database.
+func (s *Store) DB() *bolt.DB {
+	return s.db
+}
+
+// Close the underlying database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// View runs the function in a read-only transaction.
+func (s *Store) View(f func(rest.KVTx) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return f(txn{tx.Bucket(s.bucket)})
+	})
+}
+
+// Update runs the function in a read-write transaction.
+func (s *Store) Update(f func(rest.KVTx) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return f(txn{tx.Bucket(s.bucket)})
+	})
+}
+
+// txn is a rest.KVTx on a bucket.
+type txn struct {
+	bucket *bolt.Bucket
+}
+
+func (t txn) Get(key []byte) []byte {
+	return t.bucket.Get(key)
+}
+
+func (t txn) Put(key, value []byte) error {
+	return t.bucket.Put(key, value)
+}
+
+func (t txn) Delete(key []byte) error {
+	return t.bucket.Delete(key)
+}
+
+func (t txn) Scan(prefix, start []byte, f func(key, value []byte) bool) error {
+	if bytes.Compare(start, prefix) < 0 {
+		start = prefix
+	}
+
+	c := t.bucket.Cursor()
+	for key, value := c.Seek(start); key != nil && bytes.HasPrefix(key, prefix); key, value = c.Next() {
+		if !f(key, value) {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package boltkv_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/ktnyt/go-rest/boltkv"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	store, err := boltkv.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	require.NoError(t, err)
+	defer store.Close()
+
+	scan := func(prefix, start string) []string {
+		var keys []string
+		err := store.View(func(tx rest.KVTx) error {
+			return tx.Scan([]byte(prefix), []byte(start), func(key, value []byte) bool {
+				keys = append(keys, string(key)+"="+string(value))
+				return true
+			})
+		})
+		require.NoError(t, err)
+		return keys
+	}
+
+	t.Run("scans prefixes in order", func(t *testing.T) {
+		err := store.Update(func(tx rest.KVTx) error {
+			for _, key := range []string{"b/2", "a/1", "b/1", "c/1", "b/3"} {
+				if err := tx.Put([]byte(key), []byte(key[2:])); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, []string{"b/1=1", "b/2=2", "b/3=3"}, scan("b/", ""))
+		require.Equal(t, []string{"b/2=2", "b/3=3"}, scan("b/", "b/2"))
+		require.Empty(t, scan("d/", ""))
+	})
+
+	t.Run("rolls back failed updates", func(t *testing.T) {
+		failure := errors.New("failure")
+		err := store.Update(func(tx rest.KVTx) error {
+			if err := tx.Delete([]byte("a/1")); err != nil {
+				return err
+			}
+			return failure
+		})
+		require.Equal(t, failure, err)
+
+		err = store.View(func(tx rest.KVTx) error {
+			require.Equal(t, []byte("1"), tx.Get([]byte("a/1")))
+			require.Nil(t, tx.Get([]byte("a/2")))
+			return nil
+		})
+		require.NoError(t, err)
+	})
+}
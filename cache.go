@@ -0,0 +1,469 @@
+package rest
+
+import (
+	"container/list"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CacheStats are the statistics of a Cache.
+type CacheStats struct {
+	// Hits is the number of Selects served from the Cache.
+	Hits int64
+
+	// NegativeHits is the number of Selects for missing keys served from
+	// the Cache.
+	NegativeHits int64
+
+	// Misses is the number of Selects passed on to the Service.
+	Misses int64
+
+	// Evictions is the number of entries dropped to make room for others.
+	Evictions int64
+
+	// Invalidations is the number of entries dropped because their values
+	// were changed through the Cache.
+	Invalidations int64
+}
+
+// CacheOption configures optional behavior of a Cache.
+type CacheOption func(*Cache)
+
+// WithCacheTTL makes cached values expire after the given duration. Values
+// do not expire by default, so values changed without going through the
+// Cache are served until they are evicted. Values expiring in a Service
+// reporting their expiry with an Expiry method, like DictService, are never
+// cached past their expiry; set a TTL for other Services supporting expiring
+// values.
+func WithCacheTTL(ttl time.Duration) CacheOption {
+	return func(c *Cache) {
+		c.ttl = ttl
+	}
+}
+
+// WithNegativeCaching makes the Cache remember missing keys for the given
+// duration, so that repeated Selects for a missing key do not reach the
+// Service. Missing keys are forgotten whenever a value is created through the
+// Cache.
+func WithNegativeCaching(ttl time.Duration) CacheOption {
+	return func(c *Cache) {
+		c.negativeTTL = ttl
+	}
+}
+
+// WithWriteThrough makes the Cache store the values returned by Update and
+// Modify instead of invalidating them.
+func WithWriteThrough() CacheOption {
+	return func(c *Cache) {
+		c.writeThrough = true
+	}
+}
+
+// WithCacheScope sets the function deriving a scope from the context of an
+// operation, e.g. the tenant ID, so that a Cache shared by the Services of
+// several scopes keeps their keys apart.
+func WithCacheScope(scope func(context.Context) string) CacheOption {
+	return func(c *Cache) {
+		c.scope = scope
+	}
+}
+
+// cacheEntry is a cached value or missing key.
+type cacheEntry struct {
+	key     string
+	model   Model
+	err     error
+	expires time.Time
+}
+
+// Cache is a size-bounded cache of Models by key, evicting the least recently
+// used entries first. Use the Cached ServiceMiddleware to put a Cache in
+// front of a Service. Cached values are shared between callers and must not
+// be modified.
+type Cache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+	stats   CacheStats
+
+	// generation is incremented on every invalidation so that values fetched
+	// concurrently with a change are not cached.
+	generation uint64
+
+	ttl          time.Duration
+	negativeTTL  time.Duration
+	writeThrough bool
+	scope        func(context.Context) string
+}
+
+// NewCache creates a new Cache holding at most size entries.
+func NewCache(size int, opts ...CacheOption) *Cache {
+	c := &Cache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		scope:   func(context.Context) string { return "" },
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Stats returns the statistics of the Cache.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Len returns the number of entries in the Cache.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Invalidate the entry for the key in the scope of the context.
+func (c *Cache) Invalidate(ctx context.Context, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidate(c.scope(ctx) + "\x00" + key)
+}
+
+// Clear all entries.
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.stats.Invalidations += int64(c.order.Len())
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+// get the entry for the key, returning false if there is none or it expired.
+func (c *Cache) get(key string) (cacheEntry, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		e := element.Value.(*cacheEntry)
+		if e.expires.IsZero() || time.Now().Before(e.expires) {
+			c.order.MoveToFront(element)
+			if e.err != nil {
+				c.stats.NegativeHits++
+			} else {
+				c.stats.Hits++
+			}
+			return *e, c.generation, true
+		}
+		c.remove(element)
+	}
+
+	c.stats.Misses++
+	return cacheEntry{}, c.generation, false
+}
+
+// put an entry unless the Cache was invalidated since the given generation.
+func (c *Cache) put(e cacheEntry, generation uint64, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation == c.generation {
+		c.insert(e, ttl)
+	}
+}
+
+// replace the entry for the key with the value.
+func (c *Cache) replace(key string, model Model, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.invalidate(key)
+	c.insert(cacheEntry{key: key, model: model}, ttl)
+}
+
+func (c *Cache) insert(e cacheEntry, ttl time.Duration) {
+	if c.size <= 0 {
+		return
+	}
+
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl)
+	}
+
+	if element, ok := c.entries[e.key]; ok {
+		element.Value = &e
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[e.key] = c.order.PushFront(&e)
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *Cache) invalidate(key string) {
+	c.generation++
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+		c.stats.Invalidations++
+	}
+}
+
+// forgetMissing drops all negative entries.
+func (c *Cache) forgetMissing() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for element := c.order.Front(); element != nil; {
+		next := element.Next()
+		if element.Value.(*cacheEntry).err != nil {
+			c.remove(element)
+			c.stats.Invalidations++
+		}
+		element = next
+	}
+}
+
+func (c *Cache) remove(element *list.Element) {
+	delete(c.entries, element.Value.(*cacheEntry).key)
+	c.order.Remove(element)
+}
+
+// missing tests if the error reports a missing key.
+func missing(err error) bool {
+	e, ok := errors.Cause(err).(ServiceError)
+	if !ok {
+		return false
+	}
+	if e.Code == http.StatusNotFound {
+		return true
+	}
+	keyErr, ok := errors.Cause(e.Err).(KeyError)
+	return ok && keyErr.missing
+}
+
+// Cached creates a ServiceMiddleware serving Selects from the Cache, reading
+// through to the Service on a miss. Values changed through the middleware
+// are invalidated, and Delete clears the Cache since the deleted keys are not
+// known.
+func Cached(cache *Cache) ServiceMiddleware {
+	return func(service Service) Service {
+		return cachedService{service: service, cache: cache}
+	}
+}
+
+type cachedService struct {
+	service Service
+	cache   *Cache
+}
+
+// expiryReporter is implemented by Services reporting when their values
+// expire, like DictService.
+type expiryReporter interface {
+	Expiry(key string) (time.Time, bool)
+}
+
+func (s cachedService) key(ctx context.Context, key string) string {
+	return s.cache.scope(ctx) + "\x00" + key
+}
+
+// ttl returns how long the value of the key may be cached, i.e. the TTL of
+// the Cache capped at the expiry of the value if the wrapped Service reports
+// it. Returns false if the value must not be cached as it already expired.
+func (s cachedService) ttl(key string) (time.Duration, bool) {
+	reporter, ok := s.service.(expiryReporter)
+	if !ok {
+		return s.cache.ttl, true
+	}
+	at, ok := reporter.Expiry(key)
+	if !ok {
+		return s.cache.ttl, true
+	}
+	left := time.Until(at)
+	switch {
+	case left <= 0:
+		return 0, false
+	case s.cache.ttl > 0 && s.cache.ttl < left:
+		return s.cache.ttl, true
+	}
+	return left, true
+}
+
+// keep the value of the key unless the Cache was invalidated since the
+// given generation.
+func (s cachedService) keep(ctx context.Context, key string, model Model, generation uint64) {
+	if ttl, ok := s.ttl(key); ok {
+		s.cache.put(cacheEntry{key: s.key(ctx, key), model: model}, generation, ttl)
+	}
+}
+
+// store the value returned by an Update or Modify.
+func (s cachedService) store(ctx context.Context, key string, model Model, err error) (Model, error) {
+	if err == nil && s.cache.writeThrough {
+		if ttl, ok := s.ttl(key); ok {
+			s.cache.replace(s.key(ctx, key), model, ttl)
+			return model, err
+		}
+	}
+	s.cache.Invalidate(ctx, key)
+	return model, err
+}
+
+// Browse forwards to the wrapped Service.
+func (s cachedService) Browse(ctx context.Context) ([]Model, error) {
+	return s.service.Browse(ctx)
+}
+
+// Delete the values and clear the Cache.
+func (s cachedService) Delete(ctx context.Context) ([]Model, error) {
+	defer s.cache.Clear()
+	return s.service.Delete(ctx)
+}
+
+// Create a value and forget the missing keys.
+func (s cachedService) Create(ctx context.Context, reader io.Reader) (Model, error) {
+	model, err := s.service.Create(ctx, reader)
+	if err == nil {
+		s.cache.forgetMissing()
+	}
+	return model, err
+}
+
+// Select a value from the Cache or the wrapped Service.
+func (s cachedService) Select(ctx context.Context, key string) (Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	e, generation, ok := s.cache.get(s.key(ctx, key))
+	if ok {
+		return e.model, e.err
+	}
+
+	model, err := s.service.Select(ctx, key)
+	switch {
+	case err == nil:
+		s.keep(ctx, key, model, generation)
+	case s.cache.negativeTTL > 0 && missing(err):
+		s.cache.put(cacheEntry{key: s.key(ctx, key), err: err}, generation, s.cache.negativeTTL)
+	}
+	return model, err
+}
+
+// SelectMany selects the cached values and the rest from the wrapped Service
+// at once.
+func (s cachedService) SelectMany(ctx context.Context, keys []string) (map[string]Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]Model, len(keys))
+	generations := make(map[string]uint64)
+	remaining := make([]string, 0, len(keys))
+	for _, key := range keys {
+		e, generation, ok := s.cache.get(s.key(ctx, key))
+		switch {
+		case !ok:
+			generations[key] = generation
+			remaining = append(remaining, key)
+		case e.err == nil:
+			values[key] = e.model
+		}
+	}
+
+	if len(remaining) == 0 {
+		return values, nil
+	}
+
+	selected, err := SelectMany(ctx, s.service, remaining)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, model := range selected {
+		values[key] = model
+		s.keep(ctx, key, model, generations[key])
+	}
+	return values, nil
+}
+
+// Remove a value and invalidate it.
+func (s cachedService) Remove(ctx context.Context, key string) (Model, error) {
+	defer s.cache.Invalidate(ctx, key)
+	return s.service.Remove(ctx, key)
+}
+
+// Update a value and invalidate it.
+func (s cachedService) Update(ctx context.Context, key string, reader io.Reader) (Model, error) {
+	model, err := s.service.Update(ctx, key, reader)
+	return s.store(ctx, key, model, err)
+}
+
+// Modify a value and invalidate it.
+func (s cachedService) Modify(ctx context.Context, key string, reader io.Reader) (Model, error) {
+	model, err := s.service.Modify(ctx, key, reader)
+	return s.store(ctx, key, model, err)
+}
+
+// FilterParams forwards to the wrapped Service.
+func (s cachedService) FilterParams() []string {
+	return filterParams(s.service)
+}
+
+// SelectWithDeleted forwards to the wrapped Service.
+func (s cachedService) SelectWithDeleted(ctx context.Context, key string) (Model, error) {
+	return asSoftDeleter(s.service).SelectWithDeleted(ctx, key)
+}
+
+// Restore a value and invalidate it.
+func (s cachedService) Restore(ctx context.Context, key string) (Model, error) {
+	defer s.cache.Invalidate(ctx, key)
+	return asSoftDeleter(s.service).Restore(ctx, key)
+}
+
+// Purge forwards to the wrapped Service.
+func (s cachedService) Purge(ctx context.Context) ([]Model, error) {
+	return asSoftDeleter(s.service).Purge(ctx)
+}
+
+// Revisions forwards to the wrapped Service.
+func (s cachedService) Revisions(ctx context.Context, key string) ([]Revision, error) {
+	return asReverter(s.service).Revisions(ctx, key)
+}
+
+// SelectRevision forwards to the wrapped Service.
+func (s cachedService) SelectRevision(ctx context.Context, key string, number int) (Model, error) {
+	return asReverter(s.service).SelectRevision(ctx, key, number)
+}
+
+// Revert a value and invalidate it.
+func (s cachedService) Revert(ctx context.Context, key string, number int) (Model, error) {
+	defer s.cache.Invalidate(ctx, key)
+	return asReverter(s.service).Revert(ctx, key, number)
+}
+
+// CreateWithTTL creates an expiring value and forgets the missing keys.
+func (s cachedService) CreateWithTTL(ctx context.Context, reader io.Reader, ttl time.Duration) (Model, error) {
+	model, err := asExpirer(s.service).CreateWithTTL(ctx, reader, ttl)
+	if err == nil {
+		s.cache.forgetMissing()
+	}
+	return model, err
+}
+
+// UpdateWithTTL updates an expiring value and invalidates it.
+func (s cachedService) UpdateWithTTL(ctx context.Context, key string, reader io.Reader, ttl time.Duration) (Model, error) {
+	defer s.cache.Invalidate(ctx, key)
+	return asExpirer(s.service).UpdateWithTTL(ctx, key, reader, ttl)
+}
@@ -0,0 +1,166 @@
+package rest_test
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/ktnyt/go-rest/resttest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCached(t *testing.T) {
+	todo := &Todo{Key: "0", Content: "foo"}
+
+	t.Run("reads through", func(t *testing.T) {
+		fake := resttest.NewFakeService().Returns(rest.OpSelect, todo)
+		cache := rest.NewCache(10)
+		service := rest.Cached(cache)(fake)
+
+		for i := 0; i < 3; i++ {
+			model, err := service.Select(emptyContext, "0")
+			require.NoError(t, err)
+			require.Equal(t, todo, model)
+		}
+
+		fake.AssertCalls(t, rest.OpSelect, 1)
+		require.Equal(t, rest.CacheStats{Hits: 2, Misses: 1}, cache.Stats())
+	})
+
+	t.Run("invalidates changed values", func(t *testing.T) {
+		fake := resttest.NewFakeService().Returns(rest.OpSelect, todo)
+		cache := rest.NewCache(10)
+		service := rest.Cached(cache)(fake)
+
+		change := []func(){
+			func() { service.Update(emptyContext, "0", bytes.NewReader(nil)) },
+			func() { service.Modify(emptyContext, "0", bytes.NewReader(nil)) },
+			func() { service.Remove(emptyContext, "0") },
+			func() { service.Delete(emptyContext) },
+		}
+		for _, f := range change {
+			_, err := service.Select(emptyContext, "0")
+			require.NoError(t, err)
+			require.Equal(t, 1, cache.Len())
+			f()
+			require.Equal(t, 0, cache.Len())
+		}
+
+		fake.AssertCalls(t, rest.OpSelect, len(change))
+		require.Equal(t, int64(len(change)), cache.Stats().Invalidations)
+	})
+
+	t.Run("writes through", func(t *testing.T) {
+		updated := &Todo{Key: "0", Content: "bar"}
+		fake := resttest.NewFakeService().Returns(rest.OpUpdate, updated)
+		service := rest.Cached(rest.NewCache(10, rest.WithWriteThrough()))(fake)
+
+		_, err := service.Update(emptyContext, "0", bytes.NewReader(nil))
+		require.NoError(t, err)
+
+		model, err := service.Select(emptyContext, "0")
+		require.NoError(t, err)
+		require.Equal(t, updated, model)
+		fake.AssertNotCalled(t, rest.OpSelect)
+	})
+
+	t.Run("evicts least recently used values", func(t *testing.T) {
+		service := NewTodoDictService()
+		for i := 0; i < 3; i++ {
+			_, err := service.Create(emptyContext, bytes.NewReader(mustMarshal(RandomTodo())))
+			require.NoError(t, err)
+		}
+
+		cache := rest.NewCache(2)
+		cached := rest.Cached(cache)(service)
+		for _, key := range []string{"0", "1", "0", "2", "0", "1"} {
+			_, err := cached.Select(emptyContext, key)
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, rest.CacheStats{Hits: 2, Misses: 4, Evictions: 2}, cache.Stats())
+	})
+
+	t.Run("expires values", func(t *testing.T) {
+		fake := resttest.NewFakeService().Returns(rest.OpSelect, todo)
+		service := rest.Cached(rest.NewCache(10, rest.WithCacheTTL(10*time.Millisecond)))(fake)
+
+		service.Select(emptyContext, "0")
+		service.Select(emptyContext, "0")
+		fake.AssertCalls(t, rest.OpSelect, 1)
+
+		time.Sleep(20 * time.Millisecond)
+		service.Select(emptyContext, "0")
+		fake.AssertCalls(t, rest.OpSelect, 2)
+	})
+
+	t.Run("expires values with the service", func(t *testing.T) {
+		service := rest.Cached(rest.NewCache(10))(NewTodoDictService())
+
+		model, err := service.(rest.Expirer).CreateWithTTL(emptyContext, bytes.NewReader(mustMarshal(RandomTodo())), 10*time.Millisecond)
+		require.NoError(t, err)
+		_, err = service.Select(emptyContext, model.(*Todo).Key)
+		require.NoError(t, err)
+
+		time.Sleep(20 * time.Millisecond)
+		_, err = service.Select(emptyContext, model.(*Todo).Key)
+		require.Error(t, err)
+	})
+
+	t.Run("caches missing keys", func(t *testing.T) {
+		service := NewTodoDictService()
+		cache := rest.NewCache(10, rest.WithNegativeCaching(time.Minute))
+		cached := rest.Cached(cache)(service)
+
+		for i := 0; i < 2; i++ {
+			_, err := cached.Select(emptyContext, "0")
+			require.Error(t, err)
+			require.IsType(t, rest.KeyError{}, err.(rest.ServiceError).Err)
+		}
+		require.Equal(t, rest.CacheStats{NegativeHits: 1, Misses: 1}, cache.Stats())
+
+		_, err := cached.Create(emptyContext, bytes.NewReader(mustMarshal(RandomTodo())))
+		require.NoError(t, err)
+
+		_, err = cached.Select(emptyContext, "0")
+		require.NoError(t, err)
+	})
+
+	t.Run("selects many", func(t *testing.T) {
+		service := NewTodoDictService()
+		for i := 0; i < 3; i++ {
+			_, err := service.Create(emptyContext, bytes.NewReader(mustMarshal(RandomTodo())))
+			require.NoError(t, err)
+		}
+
+		cache := rest.NewCache(10)
+		cached := rest.Cached(cache)(service)
+		_, err := cached.Select(emptyContext, "0")
+		require.NoError(t, err)
+
+		values, err := rest.SelectMany(emptyContext, cached, []string{"0", "1", "missing"})
+		require.NoError(t, err)
+		require.Len(t, values, 2)
+		require.Equal(t, 2, cache.Len())
+		require.Equal(t, int64(1), cache.Stats().Hits)
+	})
+
+	t.Run("scopes keys", func(t *testing.T) {
+		fake := resttest.NewFakeService().Returns(rest.OpSelect, todo)
+		cache := rest.NewCache(10, rest.WithCacheScope(func(ctx context.Context) string {
+			return rest.ExtractParams(ctx).Get("tenant")
+		}))
+		service := rest.Cached(cache)(fake)
+
+		for _, tenant := range []string{"a", "b", "a"} {
+			ctx := rest.InjectParams(emptyContext, url.Values{"tenant": {tenant}})
+			_, err := service.Select(ctx, "0")
+			require.NoError(t, err)
+		}
+
+		fake.AssertCalls(t, rest.OpSelect, 2)
+	})
+}
@@ -0,0 +1,211 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ClientOption configures a Client.
+type ClientOption func(*clientConfig)
+
+type clientConfig struct {
+	client *http.Client
+	header http.Header
+}
+
+// WithHTTPClient sets the http.Client used to send requests.
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(c *clientConfig) {
+		c.client = client
+	}
+}
+
+// WithHeader sets a header sent with every request, e.g. for authentication.
+func WithHeader(name, value string) ClientOption {
+	return func(c *clientConfig) {
+		c.header.Set(name, value)
+	}
+}
+
+// Client is a Service for a collection served by a ServiceInterface over
+// HTTP, so that a remote collection can be used wherever a Service is
+// expected. The URL parameters in the context are sent as query parameters,
+// e.g. to filter Browse and Delete. Problem responses are returned as
+// ServiceErrors with the status code of the response and the Problem as the
+// error.
+type Client[M Model] struct {
+	base   string
+	client *http.Client
+	header http.Header
+}
+
+// NewClient creates a new Client for the collection at the given URL.
+func NewClient[M Model](base string, opts ...ClientOption) *Client[M] {
+	config := clientConfig{client: http.DefaultClient, header: make(http.Header)}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return &Client[M]{
+		base:   strings.TrimSuffix(base, "/"),
+		client: config.client,
+		header: config.header,
+	}
+}
+
+// Browse the values matching the URL parameters in the context.
+func (c *Client[M]) Browse(ctx context.Context) ([]Model, error) {
+	var list []M
+	if err := c.do(ctx, http.MethodGet, "", nil, nil, &list); err != nil {
+		return nil, err
+	}
+	return models(list), nil
+}
+
+// Delete the values matching the URL parameters in the context.
+func (c *Client[M]) Delete(ctx context.Context) ([]Model, error) {
+	var list []M
+	if err := c.do(ctx, http.MethodDelete, "", nil, nil, &list); err != nil {
+		return nil, err
+	}
+	return models(list), nil
+}
+
+// Create a new value.
+func (c *Client[M]) Create(ctx context.Context, reader io.Reader) (Model, error) {
+	return c.one(ctx, http.MethodPost, "", reader, nil)
+}
+
+// Select a value identified by the given key.
+func (c *Client[M]) Select(ctx context.Context, key string) (Model, error) {
+	return c.one(ctx, http.MethodGet, key, nil, nil)
+}
+
+// Remove a value identified by the given key.
+func (c *Client[M]) Remove(ctx context.Context, key string) (Model, error) {
+	return c.one(ctx, http.MethodDelete, key, nil, nil)
+}
+
+// Update a value identified by the given key.
+func (c *Client[M]) Update(ctx context.Context, key string, reader io.Reader) (Model, error) {
+	return c.one(ctx, http.MethodPut, key, reader, nil)
+}
+
+// Modify a value identified by the given key.
+func (c *Client[M]) Modify(ctx context.Context, key string, reader io.Reader) (Model, error) {
+	return c.one(ctx, http.MethodPatch, key, reader, nil)
+}
+
+// CreateWithTTL creates a new value expiring after the given duration.
+func (c *Client[M]) CreateWithTTL(ctx context.Context, reader io.Reader, ttl time.Duration) (Model, error) {
+	return c.one(ctx, http.MethodPost, "", reader, ttlHeader(ttl))
+}
+
+// UpdateWithTTL updates a value and sets it to expire after the given
+// duration.
+func (c *Client[M]) UpdateWithTTL(ctx context.Context, key string, reader io.Reader, ttl time.Duration) (Model, error) {
+	return c.one(ctx, http.MethodPut, key, reader, ttlHeader(ttl))
+}
+
+// one sends a request responding with a single value.
+func (c *Client[M]) one(ctx context.Context, method, key string, body io.Reader, header http.Header) (Model, error) {
+	var model M
+	if err := c.do(ctx, method, key, body, header, &model); err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+// do sends a request for the collection, or the value with the key if it is
+// not empty, and decodes the response into v.
+func (c *Client[M]) do(ctx context.Context, method, key string, body io.Reader, header http.Header, v interface{}) error {
+	if err := CheckContext(ctx); err != nil {
+		return err
+	}
+
+	target := c.base
+	if key != "" {
+		target += "/" + url.PathEscape(key)
+	}
+	if params := ExtractParams(ctx); len(params) > 0 {
+		target += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return errors.Wrapf(err, "in Client %s", method)
+	}
+
+	for name, values := range c.header {
+		req.Header[name] = values
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if id := RequestIDFromContext(ctx); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		if err := CheckContext(ctx); err != nil {
+			return err
+		}
+		return NewServiceError(errors.Wrapf(err, "in Client %s", method), http.StatusBadGateway)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return responseError(res)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		err = errors.Wrapf(err, "in Client %s: invalid response body", method)
+		return NewServiceError(err, http.StatusBadGateway)
+	}
+
+	return nil
+}
+
+// responseError decodes an error response into a ServiceError.
+func responseError(res *http.Response) error {
+	data, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return NewServiceError(err, res.StatusCode)
+	}
+
+	var problem Problem
+	if err := json.Unmarshal(data, &problem); err != nil || problem.Status == 0 {
+		detail := strings.TrimSpace(string(data))
+		if detail == "" {
+			detail = http.StatusText(res.StatusCode)
+		}
+		problem = NewProblem(res.StatusCode, detail)
+	}
+
+	return NewServiceError(problem, res.StatusCode)
+}
+
+func ttlHeader(ttl time.Duration) http.Header {
+	header := make(http.Header)
+	header.Set(TTLHeader, ttl.String())
+	return header
+}
+
+func models[M Model](list []M) []Model {
+	result := make([]Model, len(list))
+	for i := range list {
+		result[i] = list[i]
+	}
+	return result
+}
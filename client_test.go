@@ -0,0 +1,124 @@
+package rest_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/stretchr/testify/require"
+)
+
+// mount routes the collection at the path to the Interface.
+func mount(mux *http.ServeMux, path string, iface rest.Interface) {
+	withPK := func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), rest.PK, r.PathValue(rest.PK))
+			handler(w, r.WithContext(ctx))
+		}
+	}
+
+	mux.HandleFunc("GET "+path, iface.Browse)
+	mux.HandleFunc("DELETE "+path, iface.Delete)
+	mux.HandleFunc("POST "+path, iface.Create)
+	mux.HandleFunc("GET "+path+"/{pk}", withPK(iface.Select))
+	mux.HandleFunc("DELETE "+path+"/{pk}", withPK(iface.Remove))
+	mux.HandleFunc("PUT "+path+"/{pk}", withPK(iface.Update))
+	mux.HandleFunc("PATCH "+path+"/{pk}", withPK(iface.Modify))
+}
+
+func TestClient(t *testing.T) {
+	service := NewTodoDictService()
+
+	mux := http.NewServeMux()
+	mount(mux, "/todos", rest.NewServiceInterface(service))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := rest.NewClient[*Todo](server.URL + "/todos")
+
+	reader := func(t *testing.T, todo *Todo) *bytes.Reader {
+		data, err := json.Marshal(todo)
+		require.NoError(t, err)
+		return bytes.NewReader(data)
+	}
+
+	t.Run("implements Service", func(t *testing.T) {
+		var _ rest.Service = client
+		var _ rest.Expirer = client
+
+		todo := RandomTodo()
+		model, err := client.Create(emptyContext, reader(t, todo))
+		require.NoError(t, err)
+		require.Equal(t, todo.Content, model.(*Todo).Content)
+		require.Equal(t, "0", model.(*Todo).Key)
+
+		_, err = client.Create(emptyContext, reader(t, RandomTodo()))
+		require.NoError(t, err)
+
+		model, err = client.Select(emptyContext, "0")
+		require.NoError(t, err)
+		require.Equal(t, todo.Content, model.(*Todo).Content)
+
+		models, err := client.Browse(emptyContext)
+		require.NoError(t, err)
+		require.Len(t, models, 2)
+
+		updated := RandomTodo()
+		model, err = client.Update(emptyContext, "0", reader(t, updated))
+		require.NoError(t, err)
+		require.Equal(t, updated.Content, model.(*Todo).Content)
+
+		model, err = client.Modify(emptyContext, "0", bytes.NewReader([]byte(`{"Content":"foo"}`)))
+		require.NoError(t, err)
+		require.Equal(t, "foo", model.(*Todo).Content)
+
+		model, err = client.Remove(emptyContext, "0")
+		require.NoError(t, err)
+		require.Equal(t, "foo", model.(*Todo).Content)
+
+		ctx := rest.InjectParams(emptyContext, url.Values{rest.AllParam: {"true"}})
+		models, err = client.Delete(ctx)
+		require.NoError(t, err)
+		require.Len(t, models, 1)
+	})
+
+	t.Run("decodes problems", func(t *testing.T) {
+		_, err := client.Select(emptyContext, "foo")
+		require.Error(t, err)
+		serviceErr, ok := err.(rest.ServiceError)
+		require.True(t, ok)
+		require.Equal(t, http.StatusBadRequest, serviceErr.Code)
+		problem, ok := serviceErr.Err.(rest.Problem)
+		require.True(t, ok)
+		require.Equal(t, http.StatusBadRequest, problem.Status)
+
+		_, err = client.Create(emptyContext, bytes.NewReader([]byte(`{"Content":`)))
+		problem = err.(rest.ServiceError).Err.(rest.Problem)
+		require.Contains(t, problem.Extensions, "offset")
+
+		_, err = client.Delete(emptyContext)
+		require.Equal(t, http.StatusBadRequest, err.(rest.ServiceError).Code)
+	})
+
+	t.Run("sends expiring values", func(t *testing.T) {
+		model, err := client.CreateWithTTL(emptyContext, reader(t, RandomTodo()), time.Minute)
+		require.NoError(t, err)
+
+		_, ok := service.(*rest.DictService).Expiry(model.(*Todo).Key)
+		require.True(t, ok)
+	})
+
+	t.Run("honors contexts", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(emptyContext)
+		cancel()
+
+		_, err := client.Browse(ctx)
+		require.Equal(t, rest.StatusClientClosedRequest, err.(rest.ServiceError).Code)
+	})
+}
@@ -0,0 +1,15 @@
+// Command restctl inspects and edits DictServices persisted as NDJSON
+// snapshots, handling records as raw JSON. It registers no types with
+// encoding/gob, so it cannot read the values of gob files with -gob. See
+// package restctl for embedding the tool with registered model and gob types.
+package main
+
+import (
+	"os"
+
+	"github.com/ktnyt/go-rest/restctl"
+)
+
+func main() {
+	os.Exit(restctl.Run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
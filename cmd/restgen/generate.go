@@ -0,0 +1,545 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// kind classifies the type of a field by the checks it supports.
+type kind int
+
+const (
+	kindOther kind = iota
+	kindString
+	kindBool
+	kindInt
+	kindUint
+	kindFloat
+	kindTime
+	kindPointer
+	kindSlice
+	kindMap
+)
+
+var basicKinds = map[string]kind{
+	"string":  kindString,
+	"bool":    kindBool,
+	"int":     kindInt,
+	"int8":    kindInt,
+	"int16":   kindInt,
+	"int32":   kindInt,
+	"int64":   kindInt,
+	"uint":    kindUint,
+	"uint8":   kindUint,
+	"uint16":  kindUint,
+	"uint32":  kindUint,
+	"uint64":  kindUint,
+	"float32": kindFloat,
+	"float64": kindFloat,
+}
+
+func kindOf(expr ast.Expr) kind {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		return basicKinds[expr.Name]
+	case *ast.SelectorExpr:
+		switch types.ExprString(expr) {
+		case "time.Time":
+			return kindTime
+		case "time.Duration":
+			return kindInt
+		}
+	case *ast.StarExpr:
+		return kindPointer
+	case *ast.ArrayType:
+		if expr.Len == nil {
+			return kindSlice
+		}
+	case *ast.MapType:
+		return kindMap
+	}
+	return kindOther
+}
+
+// check is a condition on a field which makes a Model invalid.
+type check struct {
+	Cond    string
+	Message string
+}
+
+type filter struct {
+	Field string
+	Param string
+	Kind  kind
+}
+
+type resource struct {
+	Package  string
+	Name     string
+	Receiver string
+	Path     string
+	Key      string
+	Checks   []check
+	Merge    []string
+	Filters  []filter
+}
+
+// Lower returns the name of the resource for messages.
+func (r resource) Lower() string {
+	return strings.ToLower(r.Name)
+}
+
+// generate the source of the resource for the struct in the package in the
+// directory.
+func generate(dir, name, path string) ([]byte, error) {
+	pkg, spec, err := findStruct(dir, name)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := newResource(pkg, name, path, spec)
+	if err != nil {
+		return nil, errors.Wrapf(err, "type %s", name)
+	}
+
+	var buf bytes.Buffer
+	if err := resourceTemplate.Execute(&buf, r); err != nil {
+		return nil, err
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "formatting generated source")
+	}
+	return src, nil
+}
+
+// findStruct finds the named struct type in the non-test files of the
+// package in the directory, returning the package name.
+func findStruct(dir, name string) (string, *ast.StructType, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", nil, err
+	}
+
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		filename := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(filename, ".go") || strings.HasSuffix(filename, "_test.go") {
+			continue
+		}
+
+		file, err := parser.ParseFile(fset, filepath.Join(dir, filename), nil, 0)
+		if err != nil {
+			return "", nil, err
+		}
+
+		for _, decl := range file.Decls {
+			decl, ok := decl.(*ast.GenDecl)
+			if !ok || decl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				spec := spec.(*ast.TypeSpec)
+				if spec.Name.Name != name {
+					continue
+				}
+				st, ok := spec.Type.(*ast.StructType)
+				if !ok {
+					return "", nil, errors.Errorf("type %s is not a struct", name)
+				}
+				return file.Name.Name, st, nil
+			}
+		}
+	}
+
+	return "", nil, errors.Errorf("type %s not found in %s", name, dir)
+}
+
+func newResource(pkg, name, path string, st *ast.StructType) (resource, error) {
+	r := resource{
+		Package:  pkg,
+		Name:     name,
+		Receiver: strings.ToLower(name[:1]),
+		Path:     path,
+	}
+	if r.Receiver == "i" {
+		r.Receiver = "m"
+	}
+
+	var keyTagged bool
+	for _, f := range st.Fields.List {
+		var tag reflect.StructTag
+		if f.Tag != nil {
+			value, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return resource{}, err
+			}
+			tag = reflect.StructTag(value)
+		}
+
+		for _, ident := range f.Names {
+			if !ident.IsExported() {
+				continue
+			}
+
+			opts, err := parseOptions(tag.Get("rest"))
+			if err != nil {
+				return resource{}, errors.Wrapf(err, "field %s", ident.Name)
+			}
+
+			if _, ok := opts["key"]; ok {
+				if keyTagged {
+					return resource{}, errors.Errorf("field %s: only one field can be the key", ident.Name)
+				}
+				keyTagged = true
+				r.Key = ident.Name
+			} else if ident.Name == "Key" && !keyTagged {
+				r.Key = ident.Name
+			}
+
+			if err := r.addField(ident.Name, f.Type, tag, opts); err != nil {
+				return resource{}, errors.Wrapf(err, "field %s", ident.Name)
+			}
+		}
+	}
+
+	if r.Key != "" {
+		for _, f := range st.Fields.List {
+			for _, ident := range f.Names {
+				if ident.Name == r.Key && kindOf(f.Type) != kindString {
+					return resource{}, errors.Errorf("key field %s must be a string", r.Key)
+				}
+			}
+		}
+
+		merge := r.Merge[:0]
+		for _, field := range r.Merge {
+			if field != r.Key {
+				merge = append(merge, field)
+			}
+		}
+		r.Merge = merge
+	}
+
+	return r, nil
+}
+
+// parseOptions parses the comma separated options of a rest tag.
+func parseOptions(tag string) (map[string]string, error) {
+	opts := make(map[string]string)
+	if tag == "" {
+		return opts, nil
+	}
+
+	for _, opt := range strings.Split(tag, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(opt), "=")
+		switch name {
+		case "key", "readonly", "required", "filter", "min", "max", "oneof":
+		default:
+			return nil, errors.Errorf("unknown rest tag option '%s'", name)
+		}
+		if _, ok := opts[name]; ok {
+			return nil, errors.Errorf("duplicate rest tag option '%s'", name)
+		}
+		opts[name] = value
+	}
+	return opts, nil
+}
+
+func (r *resource) addField(name string, typ ast.Expr, tag reflect.StructTag, opts map[string]string) error {
+	k := kindOf(typ)
+	field := r.Receiver + "." + name
+	label := r.Lower() + " " + words(name)
+
+	if _, ok := opts["readonly"]; !ok {
+		r.Merge = append(r.Merge, name)
+	}
+
+	if _, ok := opts["required"]; ok {
+		var c check
+		switch k {
+		case kindString, kindSlice, kindMap:
+			c = check{Cond: "len(" + field + ") == 0", Message: label + " is empty"}
+		case kindInt, kindUint, kindFloat:
+			c = check{Cond: field + " == 0", Message: label + " is zero"}
+		case kindTime:
+			c = check{Cond: field + ".IsZero()", Message: label + " is not set"}
+		case kindPointer:
+			c = check{Cond: field + " == nil", Message: label + " is not set"}
+		default:
+			return errors.Errorf("required is not supported for %s", types.ExprString(typ))
+		}
+		r.Checks = append(r.Checks, c)
+	}
+
+	for _, bound := range []string{"min", "max"} {
+		value, ok := opts[bound]
+		if !ok {
+			continue
+		}
+
+		op, than := "<", "less than"
+		if bound == "max" {
+			op, than = ">", "greater than"
+		}
+
+		switch k {
+		case kindString, kindSlice, kindMap:
+			if _, err := strconv.Atoi(value); err != nil {
+				return errors.Errorf("%s must be an integer, got '%s'", bound, value)
+			}
+			noun := "length"
+			if k != kindString {
+				noun = "size"
+			}
+			r.Checks = append(r.Checks, check{
+				Cond:    "len(" + field + ") " + op + " " + value,
+				Message: label + " " + noun + " is " + than + " " + value,
+			})
+		case kindInt, kindUint, kindFloat:
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				return errors.Errorf("%s must be a number, got '%s'", bound, value)
+			}
+			r.Checks = append(r.Checks, check{
+				Cond:    field + " " + op + " " + value,
+				Message: label + " is " + than + " " + value,
+			})
+		default:
+			return errors.Errorf("%s is not supported for %s", bound, types.ExprString(typ))
+		}
+	}
+
+	if value, ok := opts["oneof"]; ok {
+		if k != kindString {
+			return errors.Errorf("oneof is not supported for %s", types.ExprString(typ))
+		}
+		values := strings.Split(value, "|")
+		quoted := make([]string, len(values))
+		for i, v := range values {
+			quoted[i] = field + " != " + strconv.Quote(v)
+		}
+		r.Checks = append(r.Checks, check{
+			Cond:    strings.Join(quoted, " && "),
+			Message: label + " must be one of " + strings.Join(values, ", "),
+		})
+	}
+
+	if param, ok := opts["filter"]; ok {
+		switch k {
+		case kindString, kindBool, kindInt, kindUint, kindFloat:
+		default:
+			return errors.Errorf("filter is not supported for %s", types.ExprString(typ))
+		}
+		if param == "" {
+			param = jsonName(name, tag)
+		}
+		r.Filters = append(r.Filters, filter{Field: name, Param: param, Kind: k})
+	}
+
+	return nil
+}
+
+// words splits a camel case name into lower case words for messages.
+func words(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, c := range runes {
+		if i > 0 && unicode.IsUpper(c) {
+			prev := runes[i-1]
+			next := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && next) {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteRune(unicode.ToLower(c))
+	}
+	return b.String()
+}
+
+// jsonName returns the name of the field in JSON, in lower case if it has
+// no json tag so that it reads as a URL parameter.
+func jsonName(name string, tag reflect.StructTag) string {
+	if value, _, _ := strings.Cut(tag.Get("json"), ","); value != "" && value != "-" {
+		return value
+	}
+	return strings.ToLower(name)
+}
+
+// Match returns the condition matching a parsed URL parameter to the field.
+func (f filter) Match(receiver string) string {
+	field := receiver + "." + f.Field
+	switch f.Kind {
+	case kindBool:
+		return "parsed, err := strconv.ParseBool(param); err == nil && " + field + " == parsed"
+	case kindInt:
+		return "parsed, err := strconv.ParseInt(param, 10, 64); err == nil && int64(" + field + ") == parsed"
+	case kindUint:
+		return "parsed, err := strconv.ParseUint(param, 10, 64); err == nil && uint64(" + field + ") == parsed"
+	case kindFloat:
+		return "parsed, err := strconv.ParseFloat(param, 64); err == nil && float64(" + field + ") == parsed"
+	default:
+		return "param == " + field
+	}
+}
+
+// Schema returns the JSON schema type of the URL parameter.
+func (f filter) Schema() string {
+	switch f.Kind {
+	case kindBool:
+		return "boolean"
+	case kindInt, kindUint:
+		return "integer"
+	case kindFloat:
+		return "number"
+	default:
+		return "string"
+	}
+}
+
+var resourceTemplate = template.Must(template.New("resource").Funcs(template.FuncMap{
+	"quote": strconv.Quote,
+	"format": func(message string) string {
+		return strconv.Quote(strings.ReplaceAll(message, "%", "%%"))
+	},
+}).Parse(`// Code generated by restgen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	rest "github.com/ktnyt/go-rest"
+)
+
+{{$r := .Receiver}}
+// {{.Name}}Path is the path of the {{.Name}} collection.
+const {{.Name}}Path = {{quote .Path}}
+
+// New{{.Name}} creates an empty {{.Name}}.
+func New{{.Name}}() rest.Model {
+	return &{{.Name}}{}
+}
+
+// Validate the {{.Name}} and return an error if it is invalid.
+func ({{$r}} *{{.Name}}) Validate() error {
+{{- range .Checks}}
+	if {{.Cond}} {
+		return fmt.Errorf({{format .Message}})
+	}
+{{- end}}
+	return nil
+}
+
+// MakeKey creates a new key given an integer.
+func ({{$r}} *{{.Name}}) MakeKey(i int) string {
+{{- if .Key}}
+	{{$r}}.{{.Key}} = strconv.Itoa(i)
+	return {{$r}}.{{.Key}}
+{{- else}}
+	return strconv.Itoa(i)
+{{- end}}
+}
+
+// Merge another {{.Name}} into this {{.Name}}.
+func ({{$r}} *{{.Name}}) Merge(other interface{}) error {
+	switch other := other.(type) {
+	case *{{.Name}}:
+{{- range .Merge}}
+		{{$r}}.{{.}} = other.{{.}}
+{{- end}}
+		return nil
+	default:
+		return fmt.Errorf("attempted to merge non-{{.Name}} object")
+	}
+}
+
+// Filter{{.Name}} creates a filter matching the {{.Name}} values to the URL
+// parameters.
+func Filter{{.Name}}(ctx context.Context) rest.Filter {
+{{- if .Filters}}
+	params := rest.ExtractParams(ctx)
+	return func(value interface{}) bool {
+		{{$r}} := value.(*{{.Name}})
+{{- range .Filters}}
+		if values, ok := params[{{quote .Param}}]; ok {
+			found := false
+			for _, param := range values {
+				if {{.Match $r}} {
+					found = true
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+{{- end}}
+		return true
+	}
+{{- else}}
+	return func(interface{}) bool { return true }
+{{- end}}
+}
+
+// Convert{{.Name}} converts a stored value to a {{.Name}}.
+func Convert{{.Name}}(value interface{}) rest.Model {
+	return value.(*{{.Name}})
+}
+
+// New{{.Name}}DictService creates a DictService for {{.Name}} values.
+func New{{.Name}}DictService(opts ...rest.DictServiceOption) rest.Service {
+	opts = append([]rest.DictServiceOption{rest.WithFilterParams(
+{{- range $i, $f := .Filters}}{{if $i}}, {{end}}{{quote $f.Param}}{{end}})}, opts...)
+	return rest.NewDictService(New{{.Name}}, Filter{{.Name}}, Convert{{.Name}}, opts...)
+}
+
+// {{.Name}}Resource describes the {{.Name}} collection for an OpenAPI document.
+func {{.Name}}Resource() rest.Resource {
+	return rest.Resource{
+		Path:  {{.Name}}Path,
+		Name:  {{quote .Name}},
+		Build: New{{.Name}},
+		Params: []rest.Parameter{
+{{- range .Filters}}
+			{Name: {{quote .Param}}, Type: {{quote .Schema}}},
+{{- end}}
+		},
+	}
+}
+
+// Register{{.Name}} routes the {{.Name}} collection at {{.Name}}Path on the
+// mux to the Interface.
+func Register{{.Name}}(mux *http.ServeMux, iface rest.Interface) {
+	withPK := func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), rest.PK, r.PathValue(rest.PK))
+			handler(w, r.WithContext(ctx))
+		}
+	}
+
+	item := {{.Name}}Path + "/{" + rest.PK + "}"
+	mux.HandleFunc("GET "+{{.Name}}Path, iface.Browse)
+	mux.HandleFunc("DELETE "+{{.Name}}Path, iface.Delete)
+	mux.HandleFunc("POST "+{{.Name}}Path, iface.Create)
+	mux.HandleFunc("GET "+item, withPK(iface.Select))
+	mux.HandleFunc("DELETE "+item, withPK(iface.Remove))
+	mux.HandleFunc("PUT "+item, withPK(iface.Update))
+	mux.HandleFunc("PATCH "+item, withPK(iface.Modify))
+}
+`))
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writePackage(t *testing.T, src string) string {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "model.go"), []byte(src), 0644))
+	return dir
+}
+
+func TestGenerate(t *testing.T) {
+	t.Run("matches the example", func(t *testing.T) {
+		src, err := generate(filepath.Join("internal", "example"), "Todo", "/todos")
+		require.NoError(t, err)
+
+		expected, err := os.ReadFile(filepath.Join("internal", "example", "todo_rest.go"))
+		require.NoError(t, err)
+		require.Equal(t, string(expected), string(src), "run go generate in internal/example")
+	})
+
+	t.Run("generates defaults without tags", func(t *testing.T) {
+		dir := writePackage(t, "package notes\n\ntype Note struct {\n\tText string\n\tsecret string\n}\n")
+
+		var stderr bytes.Buffer
+		require.Equal(t, 0, run([]string{"-type", "Note", dir}, &stderr), stderr.String())
+
+		src, err := os.ReadFile(filepath.Join(dir, "note_rest.go"))
+		require.NoError(t, err)
+		require.Contains(t, string(src), "package notes")
+		require.Contains(t, string(src), `const NotePath = "/notes"`)
+		require.Contains(t, string(src), "return strconv.Itoa(i)")
+		require.Contains(t, string(src), "n.Text = other.Text")
+		require.NotContains(t, string(src), "secret")
+		require.Contains(t, string(src), "return func(interface{}) bool { return true }")
+	})
+
+	t.Run("uses the given path and output", func(t *testing.T) {
+		dir := writePackage(t, "package items\n\ntype Item struct {\n\tKey string\n\tUserID string `rest:\"required\"`\n}\n")
+
+		var stderr bytes.Buffer
+		code := run([]string{"-type", "Item", "-path", "/v1/items", "-output", "gen.go", dir}, &stderr)
+		require.Equal(t, 0, code, stderr.String())
+
+		src, err := os.ReadFile(filepath.Join(dir, "gen.go"))
+		require.NoError(t, err)
+		require.Contains(t, string(src), `const ItemPath = "/v1/items"`)
+		require.Contains(t, string(src), "func (m *Item) MakeKey(i int) string")
+		require.Contains(t, string(src), `"item user id is empty"`)
+	})
+
+	t.Run("rejects invalid annotations", func(t *testing.T) {
+		for name, test := range map[string]struct {
+			src string
+			err string
+		}{
+			"missing type":  {"type Other struct{}", "type Note not found"},
+			"not a struct":  {"type Note string", "type Note is not a struct"},
+			"numeric key":   {"type Note struct {\n\tKey int\n}", "key field Key must be a string"},
+			"two keys":      {"type Note struct {\n\tA string `rest:\"key\"`\n\tB string `rest:\"key\"`\n}", "only one field can be the key"},
+			"unknown":       {"type Note struct {\n\tText string `rest:\"unique\"`\n}", "unknown rest tag option 'unique'"},
+			"duplicate":     {"type Note struct {\n\tText string `rest:\"filter,filter=text\"`\n}", "duplicate rest tag option 'filter'"},
+			"bad bound":     {"type Note struct {\n\tText string `rest:\"max=ten\"`\n}", "max must be an integer"},
+			"bool required": {"type Note struct {\n\tDone bool `rest:\"required\"`\n}", "required is not supported for bool"},
+			"slice filter":  {"type Note struct {\n\tTags []string `rest:\"filter\"`\n}", "filter is not supported for []string"},
+			"int oneof":     {"type Note struct {\n\tRank int `rest:\"oneof=1|2\"`\n}", "oneof is not supported for int"},
+		} {
+			t.Run(name, func(t *testing.T) {
+				dir := writePackage(t, "package notes\n\n"+test.src+"\n")
+
+				var stderr bytes.Buffer
+				require.Equal(t, 1, run([]string{"-type", "Note", dir}, &stderr))
+				require.Contains(t, stderr.String(), test.err)
+			})
+		}
+	})
+
+	t.Run("rejects invalid usage", func(t *testing.T) {
+		var stderr bytes.Buffer
+		require.Equal(t, 2, run(nil, &stderr))
+		require.Contains(t, stderr.String(), "usage: restgen")
+	})
+}
@@ -0,0 +1,18 @@
+// Package example is a resource generated by restgen, kept up to date by the
+// tests of restgen.
+package example
+
+import "time"
+
+//go:generate go run github.com/ktnyt/go-rest/cmd/restgen -type Todo
+
+// Todo is an annotated Model.
+type Todo struct {
+	Key       string    `json:"key" rest:"key"`
+	Content   string    `json:"content" rest:"required,max=140"`
+	Priority  int       `json:"priority" rest:"min=0,max=5,filter"`
+	Status    string    `json:"status" rest:"oneof=open|closed,filter=state"`
+	Tags      []string  `json:"tags" rest:"max=8"`
+	CreatedAt time.Time `json:"createdAt" rest:"required,readonly"`
+	Done      bool      `json:"done" rest:"filter"`
+}
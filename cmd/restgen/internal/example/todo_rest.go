@@ -0,0 +1,155 @@
+// Code generated by restgen. DO NOT EDIT.
+
+package example
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	rest "github.com/ktnyt/go-rest"
+)
+
+// TodoPath is the path of the Todo collection.
+const TodoPath = "/todos"
+
+// NewTodo creates an empty Todo.
+func NewTodo() rest.Model {
+	return &Todo{}
+}
+
+// Validate the Todo and return an error if it is invalid.
+func (t *Todo) Validate() error {
+	if len(t.Content) == 0 {
+		return fmt.Errorf("todo content is empty")
+	}
+	if len(t.Content) > 140 {
+		return fmt.Errorf("todo content length is greater than 140")
+	}
+	if t.Priority < 0 {
+		return fmt.Errorf("todo priority is less than 0")
+	}
+	if t.Priority > 5 {
+		return fmt.Errorf("todo priority is greater than 5")
+	}
+	if t.Status != "open" && t.Status != "closed" {
+		return fmt.Errorf("todo status must be one of open, closed")
+	}
+	if len(t.Tags) > 8 {
+		return fmt.Errorf("todo tags size is greater than 8")
+	}
+	if t.CreatedAt.IsZero() {
+		return fmt.Errorf("todo created at is not set")
+	}
+	return nil
+}
+
+// MakeKey creates a new key given an integer.
+func (t *Todo) MakeKey(i int) string {
+	t.Key = strconv.Itoa(i)
+	return t.Key
+}
+
+// Merge another Todo into this Todo.
+func (t *Todo) Merge(other interface{}) error {
+	switch other := other.(type) {
+	case *Todo:
+		t.Content = other.Content
+		t.Priority = other.Priority
+		t.Status = other.Status
+		t.Tags = other.Tags
+		t.Done = other.Done
+		return nil
+	default:
+		return fmt.Errorf("attempted to merge non-Todo object")
+	}
+}
+
+// FilterTodo creates a filter matching the Todo values to the URL
+// parameters.
+func FilterTodo(ctx context.Context) rest.Filter {
+	params := rest.ExtractParams(ctx)
+	return func(value interface{}) bool {
+		t := value.(*Todo)
+		if values, ok := params["priority"]; ok {
+			found := false
+			for _, param := range values {
+				if parsed, err := strconv.ParseInt(param, 10, 64); err == nil && int64(t.Priority) == parsed {
+					found = true
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		if values, ok := params["state"]; ok {
+			found := false
+			for _, param := range values {
+				if param == t.Status {
+					found = true
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		if values, ok := params["done"]; ok {
+			found := false
+			for _, param := range values {
+				if parsed, err := strconv.ParseBool(param); err == nil && t.Done == parsed {
+					found = true
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// ConvertTodo converts a stored value to a Todo.
+func ConvertTodo(value interface{}) rest.Model {
+	return value.(*Todo)
+}
+
+// NewTodoDictService creates a DictService for Todo values.
+func NewTodoDictService(opts ...rest.DictServiceOption) rest.Service {
+	opts = append([]rest.DictServiceOption{rest.WithFilterParams("priority", "state", "done")}, opts...)
+	return rest.NewDictService(NewTodo, FilterTodo, ConvertTodo, opts...)
+}
+
+// TodoResource describes the Todo collection for an OpenAPI document.
+func TodoResource() rest.Resource {
+	return rest.Resource{
+		Path:  TodoPath,
+		Name:  "Todo",
+		Build: NewTodo,
+		Params: []rest.Parameter{
+			{Name: "priority", Type: "integer"},
+			{Name: "state", Type: "string"},
+			{Name: "done", Type: "boolean"},
+		},
+	}
+}
+
+// RegisterTodo routes the Todo collection at TodoPath on the
+// mux to the Interface.
+func RegisterTodo(mux *http.ServeMux, iface rest.Interface) {
+	withPK := func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), rest.PK, r.PathValue(rest.PK))
+			handler(w, r.WithContext(ctx))
+		}
+	}
+
+	item := TodoPath + "/{" + rest.PK + "}"
+	mux.HandleFunc("GET "+TodoPath, iface.Browse)
+	mux.HandleFunc("DELETE "+TodoPath, iface.Delete)
+	mux.HandleFunc("POST "+TodoPath, iface.Create)
+	mux.HandleFunc("GET "+item, withPK(iface.Select))
+	mux.HandleFunc("DELETE "+item, withPK(iface.Remove))
+	mux.HandleFunc("PUT "+item, withPK(iface.Update))
+	mux.HandleFunc("PATCH "+item, withPK(iface.Modify))
+}
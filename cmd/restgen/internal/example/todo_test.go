@@ -0,0 +1,102 @@
+package example_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/ktnyt/go-rest/cmd/restgen/internal/example"
+	"github.com/ktnyt/go-rest/resttest"
+	"github.com/stretchr/testify/require"
+)
+
+var count int64
+
+func mustMarshal(v interface{}) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func validTodo() []byte {
+	n := atomic.AddInt64(&count, 1)
+	return mustMarshal(example.Todo{
+		Content:   "todo " + strconv.FormatInt(n, 10),
+		Status:    "open",
+		CreatedAt: time.Now(),
+		Done:      n&1 == 1,
+	})
+}
+
+var fixtures = resttest.Fixtures{
+	Valid:   validTodo,
+	Invalid: mustMarshal(example.Todo{Status: "open", CreatedAt: time.Now()}),
+	Build:   example.NewTodo,
+	Key:     func(model rest.Model) string { return model.(*example.Todo).Key },
+	Filter: func(ctx context.Context) context.Context {
+		return rest.InjectParams(ctx, url.Values{"done": {"true"}})
+	},
+	Match: func(model rest.Model) bool { return model.(*example.Todo).Done },
+}
+
+func TestTodo(t *testing.T) {
+	t.Run("conforms to Service", func(t *testing.T) {
+		resttest.RunServiceConformance(t, func() rest.Service { return example.NewTodoDictService() }, fixtures)
+	})
+
+	t.Run("validates tags", func(t *testing.T) {
+		todo := example.Todo{Content: "foo", Priority: 6, Status: "open", CreatedAt: time.Now()}
+		require.EqualError(t, todo.Validate(), "todo priority is greater than 5")
+
+		todo.Priority, todo.Status = 1, "stale"
+		require.EqualError(t, todo.Validate(), "todo status must be one of open, closed")
+
+		todo.Status, todo.CreatedAt = "closed", time.Time{}
+		require.EqualError(t, todo.Validate(), "todo created at is not set")
+	})
+
+	t.Run("keeps read only fields", func(t *testing.T) {
+		created := time.Now()
+		todo := example.Todo{Key: "0", Content: "foo", CreatedAt: created}
+		require.NoError(t, todo.Merge(&example.Todo{Key: "1", Content: "bar"}))
+		require.Equal(t, example.Todo{Key: "0", Content: "bar", CreatedAt: created}, todo)
+		require.Error(t, todo.Merge(struct{}{}))
+	})
+
+	t.Run("filters by parameters", func(t *testing.T) {
+		todo := &example.Todo{Priority: 2, Status: "open", Done: true}
+		match := func(params url.Values) bool {
+			return example.FilterTodo(rest.InjectParams(context.Background(), params))(todo)
+		}
+
+		require.True(t, match(url.Values{}))
+		require.True(t, match(url.Values{"priority": {"1", "2"}, "state": {"open"}}))
+		require.False(t, match(url.Values{"priority": {"x"}}))
+		require.False(t, match(url.Values{"done": {"false"}}))
+	})
+
+	t.Run("registers routes", func(t *testing.T) {
+		resttest.RunServiceConformance(t, func() rest.Service {
+			mux := http.NewServeMux()
+			iface := rest.NewServiceInterface(example.NewTodoDictService(), rest.AllowUnfilteredDelete())
+			example.RegisterTodo(mux, iface)
+			server := httptest.NewServer(mux)
+			t.Cleanup(server.Close)
+			return rest.NewClient[*example.Todo](server.URL + example.TodoPath)
+		}, fixtures)
+	})
+
+	t.Run("documents the resource", func(t *testing.T) {
+		document := rest.NewOpenAPI("Todos", "1.0.0").Register(example.TodoResource()).Document()
+		require.Contains(t, document["paths"], example.TodoPath)
+	})
+}
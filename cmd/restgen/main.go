@@ -0,0 +1,94 @@
+// Command restgen generates the boilerplate of a resource from an annotated
+// struct: the Model methods Validate, MakeKey and Merge, a constructor, a
+// FilterFactory, a Converter, a DictService constructor, an OpenAPI Resource
+// and the registration of its routes on an http.ServeMux.
+//
+// It is meant to be run by go generate next to the struct:
+//
+//	//go:generate restgen -type Todo
+//
+//	type Todo struct {
+//		Key       string    `rest:"key"`
+//		Content   string    `rest:"required,max=140"`
+//		CreatedAt time.Time `rest:"readonly"`
+//		Done      bool      `rest:"filter"`
+//	}
+//
+// which writes the file todo_rest.go. The options in the rest tag are:
+//
+//	key              the string field set by MakeKey, Key by default
+//	readonly         the field is not changed by Merge
+//	required         the field must not be empty or zero
+//	min=N, max=N     bounds of a number, or of the length of a string,
+//	                 slice or map
+//	oneof=a|b        the string field must have one of the values
+//	filter[=name]    values can be filtered by the URL parameter, named after
+//	                 the JSON name of the field by default
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const usage = `usage: restgen -type name [-path path] [-output file] [directory]
+
+Generates the boilerplate of the resource for the annotated struct in the Go
+package in the directory, which defaults to the current directory.
+
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
+
+func run(args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("restgen", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	typeName := flags.String("type", "", "name of the struct type")
+	path := flags.String("path", "", "path of the collection, /<type>s in lower case by default")
+	output := flags.String("output", "", "output file name, <type>_rest.go in lower case by default")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *typeName == "" || flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+
+	dir := "."
+	if flags.NArg() == 1 {
+		dir = flags.Arg(0)
+	}
+
+	if *path == "" {
+		*path = "/" + strings.ToLower(*typeName) + "s"
+	}
+	if *output == "" {
+		*output = strings.ToLower(*typeName) + "_rest.go"
+	}
+	if !filepath.IsAbs(*output) {
+		*output = filepath.Join(dir, *output)
+	}
+
+	src, err := generate(dir, *typeName, *path)
+	if err != nil {
+		fmt.Fprintf(stderr, "restgen: %v\n", err)
+		return 1
+	}
+
+	if err := os.WriteFile(*output, src, 0644); err != nil {
+		fmt.Fprintf(stderr, "restgen: %v\n", err)
+		return 1
+	}
+	return 0
+}
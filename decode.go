@@ -0,0 +1,136 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DecodeError describes a request body which could not be decoded.
+type DecodeError struct {
+	Field  string
+	Offset int64
+	Err    error
+}
+
+// Error satisfies the error interface.
+func (e DecodeError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("invalid body at offset %d (field '%s'): %s", e.Offset, e.Field, e.Err.Error())
+	}
+	return fmt.Sprintf("invalid body at offset %d: %s", e.Offset, e.Err.Error())
+}
+
+// BodyTooLargeError represents a request body exceeding the size limit.
+type BodyTooLargeError struct {
+	limit int64
+}
+
+// Error satisfies the error interface.
+func (e BodyTooLargeError) Error() string {
+	return fmt.Sprintf("request body exceeds %d bytes", e.limit)
+}
+
+// DecodeOptions configures how request bodies are decoded.
+type DecodeOptions struct {
+	// MaxBodySize limits the size of the request body in bytes. A
+	// non-positive value does not limit the size.
+	MaxBodySize int64
+
+	// DisallowUnknownFields rejects bodies with fields that do not exist in
+	// the destination value.
+	DisallowUnknownFields bool
+}
+
+// Decode a single JSON value from the reader into v. The returned error is a
+// ServiceError with status code 413 if the body is too large or 400 with a
+// DecodeError if the body is not a valid JSON value for v or has trailing
+// data after the value.
+func (o DecodeOptions) Decode(reader io.Reader, v interface{}) error {
+	if o.MaxBodySize > 0 {
+		reader = &limitedReader{reader: reader, limit: o.MaxBodySize, n: o.MaxBodySize}
+	}
+
+	decoder := json.NewDecoder(reader)
+	if o.DisallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+
+	if err := decoder.Decode(v); err != nil {
+		return decodeError(err, decoder)
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		if tooLarge, ok := err.(BodyTooLargeError); ok {
+			return NewServiceError(tooLarge, http.StatusRequestEntityTooLarge)
+		}
+		err := DecodeError{
+			Offset: decoder.InputOffset(),
+			Err:    fmt.Errorf("unexpected data after JSON value"),
+		}
+		return NewServiceError(err, http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+// unknownFieldPrefix prefixes the error encoding/json returns for unknown
+// fields when DisallowUnknownFields is set. The error has no type of its
+// own, so the message is matched; TestDecodeOptions pins it, and bodies with
+// unknown fields are still rejected, only without the Field, if it changes.
+const unknownFieldPrefix = "json: unknown field "
+
+func decodeError(err error, decoder *json.Decoder) error {
+	switch e := err.(type) {
+	case BodyTooLargeError:
+		return NewServiceError(e, http.StatusRequestEntityTooLarge)
+	case *json.SyntaxError:
+		err = DecodeError{Offset: e.Offset, Err: err}
+	case *json.UnmarshalTypeError:
+		err = DecodeError{Field: e.Field, Offset: e.Offset, Err: err}
+	default:
+		switch {
+		case err == io.EOF:
+			err = DecodeError{Err: fmt.Errorf("request body is empty")}
+		case strings.HasPrefix(err.Error(), unknownFieldPrefix):
+			field := strings.TrimPrefix(err.Error(), unknownFieldPrefix)
+			err = DecodeError{
+				Field:  strings.Trim(field, `"`),
+				Offset: decoder.InputOffset(),
+				Err:    err,
+			}
+		default:
+			err = DecodeError{Offset: decoder.InputOffset(), Err: err}
+		}
+	}
+	return NewServiceError(err, http.StatusBadRequest)
+}
+
+// limitedReader reads at most limit bytes, failing with a BodyTooLargeError
+// if the underlying reader has more.
+type limitedReader struct {
+	reader io.Reader
+	limit  int64
+	n      int64
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		var probe [1]byte
+		n, err := r.reader.Read(probe[:])
+		if n > 0 {
+			return 0, BodyTooLargeError{limit: r.limit}
+		}
+		return 0, err
+	}
+
+	if int64(len(p)) > r.n {
+		p = p[:r.n]
+	}
+
+	n, err := r.reader.Read(p)
+	r.n -= int64(n)
+	return n, err
+}
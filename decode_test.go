@@ -0,0 +1,100 @@
+package rest_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeOptions(t *testing.T) {
+	decode := func(options rest.DecodeOptions, body string) (rest.ServiceError, bool) {
+		todo := &Todo{}
+		err := options.Decode(strings.NewReader(body), todo)
+		if err == nil {
+			return rest.ServiceError{}, false
+		}
+		return err.(rest.ServiceError), true
+	}
+
+	t.Run("decodes valid bodies", func(t *testing.T) {
+		_, failed := decode(rest.DecodeOptions{}, `{"Content": "foo"} `)
+		require.False(t, failed)
+	})
+
+	t.Run("rejects trailing data", func(t *testing.T) {
+		err, failed := decode(rest.DecodeOptions{}, `{"Content": "foo"} {}`)
+		require.True(t, failed)
+		require.Equal(t, http.StatusBadRequest, err.Code)
+
+		_, failed = decode(rest.DecodeOptions{}, `{"Content": "foo"} garbage`)
+		require.True(t, failed)
+	})
+
+	t.Run("rejects unknown fields", func(t *testing.T) {
+		options := rest.DecodeOptions{DisallowUnknownFields: true}
+		err, failed := decode(options, `{"Content": "foo", "Bar": 1}`)
+		require.True(t, failed)
+		require.Equal(t, http.StatusBadRequest, err.Code)
+		require.Equal(t, "Bar", err.Err.(rest.DecodeError).Field)
+
+		_, failed = decode(rest.DecodeOptions{}, `{"Content": "foo", "Bar": 1}`)
+		require.False(t, failed)
+	})
+
+	t.Run("matches the unknown field error of encoding/json", func(t *testing.T) {
+		decoder := json.NewDecoder(strings.NewReader(`{"Bar": 1}`))
+		decoder.DisallowUnknownFields()
+		err := decoder.Decode(&Todo{})
+		require.EqualError(t, err, `json: unknown field "Bar"`)
+	})
+
+	t.Run("points at invalid fields", func(t *testing.T) {
+		err, failed := decode(rest.DecodeOptions{}, `{"Content": 1}`)
+		require.True(t, failed)
+		require.Equal(t, "Content", err.Err.(rest.DecodeError).Field)
+		require.NotZero(t, err.Err.(rest.DecodeError).Offset)
+	})
+
+	t.Run("limits body size", func(t *testing.T) {
+		options := rest.DecodeOptions{MaxBodySize: 16}
+		err, failed := decode(options, `{"Content": "foobarbaz"}`)
+		require.True(t, failed)
+		require.Equal(t, http.StatusRequestEntityTooLarge, err.Code)
+
+		_, failed = decode(options, `{"Done": true}`)
+		require.False(t, failed)
+	})
+}
+
+func TestDictServiceDecoding(t *testing.T) {
+	service := rest.NewDictService(NewTodo, Filter, Convert,
+		rest.WithMaxBodySize(1024),
+		rest.WithDisallowUnknownFields(),
+	)
+	iface := rest.NewServiceInterface(service)
+
+	t.Run("responds with a problem", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"Content": "foo", "Bar": 1}`))
+		iface.Create(w, r)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+
+		var problem rest.Problem
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+		require.Equal(t, "Bar", problem.Extensions["field"])
+		require.NotNil(t, problem.Extensions["offset"])
+	})
+
+	t.Run("responds with 413 for large bodies", func(t *testing.T) {
+		body := `{"Content": "` + strings.Repeat("a", 1024) + `"}`
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		iface.Create(w, r)
+		require.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	})
+}
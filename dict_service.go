@@ -7,6 +7,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"reflect"
+	"sync"
+	"time"
 )
 
 func init() {
@@ -40,49 +43,252 @@ type Converter func(interface{}) Model
 
 // DictService provides a Dict service interface.
 type DictService struct {
-	Dict  *Dict
-	Count int
+	Dict    *Dict
+	Count   int
+	Deleted map[string]time.Time
+	History map[string][]Revision
+	Expires map[string]time.Time
+
+	mu      sync.Mutex
+	expired []Expired
+	unsaved int
 
 	build   ModelBuilder
 	factory FilterFactory
 	convert Converter
+
+	softDelete bool
+	retention  time.Duration
+
+	history bool
+	limit   int
+
+	onExpire func(Expired)
+
+	hooks *Hooks
+	outer *Hooks
+
+	decoding DecodeOptions
+
+	migrations *Migrations
+
+	filterParams []string
+}
+
+// DictServiceOption configures optional behavior of a DictService.
+type DictServiceOption func(*DictService)
+
+// WithSoftDelete makes the DictService tombstone removed values instead of
+// dropping them. Tombstoned values are purged once they have been deleted for
+// longer than the retention period. A non-positive retention keeps them until
+// explicitly purged.
+func WithSoftDelete(retention time.Duration) DictServiceOption {
+	return func(s *DictService) {
+		s.softDelete = true
+		s.retention = retention
+	}
+}
+
+// WithHistory makes the DictService keep a revision history for each key,
+// recording every Create, Update and Modify. At most limit revisions are kept
+// per key, or all of them if limit is non-positive.
+func WithHistory(limit int) DictServiceOption {
+	return func(s *DictService) {
+		s.history = true
+		s.limit = limit
+	}
+}
+
+// WithExpiryHandler registers a function called for every value removed from
+// the DictService because its time-to-live has passed.
+func WithExpiryHandler(handler func(Expired)) DictServiceOption {
+	return func(s *DictService) {
+		s.onExpire = handler
+	}
+}
+
+// WithHooks registers Hooks to run around the DictService operations, after
+// the hook methods implemented by the Model itself. Hooks run while the
+// DictService is locked, so that a failing hook can roll the operation back,
+// and must not call back into the DictService.
+func WithHooks(hooks *Hooks) DictServiceOption {
+	return func(s *DictService) {
+		s.hooks = hooks
+	}
+}
+
+// WithMaxBodySize limits the size of the request bodies decoded by the
+// DictService to the given number of bytes.
+func WithMaxBodySize(n int64) DictServiceOption {
+	return func(s *DictService) {
+		s.decoding.MaxBodySize = n
+	}
+}
+
+// WithDisallowUnknownFields makes the DictService reject request bodies with
+// fields that do not exist in the Model.
+func WithDisallowUnknownFields() DictServiceOption {
+	return func(s *DictService) {
+		s.decoding.DisallowUnknownFields = true
+	}
+}
+
+// WithFilterParams declares the URL parameters the FilterFactory of the
+// DictService filters values by. GuardDelete only accepts these as filters,
+// so without them every Delete through an Interface needs the AllParam.
+func WithFilterParams(names ...string) DictServiceOption {
+	return func(s *DictService) {
+		s.filterParams = append([]string{}, names...)
+	}
 }
 
 // NewDictService returns a new Dict service.
-func NewDictService(build ModelBuilder, factory FilterFactory, convert Converter) Service {
-	return &DictService{
+func NewDictService(build ModelBuilder, factory FilterFactory, convert Converter, opts ...DictServiceOption) Service {
+	s := &DictService{
 		Dict:    NewDict(),
 		Count:   0,
+		Deleted: make(map[string]time.Time),
+		History: make(map[string][]Revision),
+		Expires: make(map[string]time.Time),
 		build:   build,
 		factory: factory,
 		convert: convert,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-// Browse Dict values filtered by URL parameters.
+// lock the DictService for an operation.
+func (s *DictService) lock() {
+	s.mu.Lock()
+
+	if s.Deleted == nil {
+		s.Deleted = make(map[string]time.Time)
+	}
+	if s.History == nil {
+		s.History = make(map[string][]Revision)
+	}
+	if s.Expires == nil {
+		s.Expires = make(map[string]time.Time)
+	}
+}
+
+// unlock the DictService and dispatch the expiry events queued during the
+// operation.
+func (s *DictService) unlock() {
+	expired := s.expired
+	s.expired = nil
+	s.mu.Unlock()
+
+	if s.onExpire != nil {
+		for _, e := range expired {
+			s.onExpire(e)
+		}
+	}
+}
+
+// sweep removes expired values and purges tombstoned values past retention.
+func (s *DictService) sweep() {
+	s.expire(time.Now())
+	s.purgeExpired()
+}
+
+// deleted tests if the value for the given key is tombstoned.
+func (s *DictService) deleted(key string) bool {
+	_, ok := s.Deleted[key]
+	return ok
+}
+
+// tombstone marks the value for the given key as deleted.
+func (s *DictService) tombstone(key string) {
+	s.Deleted[key] = time.Now()
+}
+
+// runHooks runs the hook method of the Model and the Hooks for the event,
+// followed by the Hooks of a wrapping service and the Hooks in the context.
+func (s *DictService) runHooks(ctx context.Context, event HookEvent, model Model) error {
+	if err := runModelHook(ctx, event, model); err != nil {
+		return hookError(event, err)
+	}
+	if err := s.hooks.Run(ctx, event, model); err != nil {
+		return err
+	}
+	if err := s.outer.Run(ctx, event, model); err != nil {
+		return err
+	}
+	return runContextHooks(ctx, event, model)
+}
+
+// FilterParams returns the URL parameters declared by WithFilterParams.
+func (s *DictService) FilterParams() []string {
+	return s.filterParams
+}
+
+// Browse Dict values filtered by URL parameters. Tombstoned values are only
+// included if the IncludeDeletedParam is set.
 func (s *DictService) Browse(ctx context.Context) ([]Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	s.sweep()
+
+	include := ParamEnabled(ctx, IncludeDeletedParam)
 	indices := s.Dict.Search(s.factory(ctx))
-	list := make([]Model, len(indices))
-	for j, i := range indices {
-		list[j] = s.convert(s.Dict.Values[i])
+	list := make([]Model, 0, len(indices))
+	for _, i := range indices {
+		if include || !s.deleted(s.Dict.Keys[i]) {
+			list = append(list, s.convert(s.Dict.Values[i]))
+		}
 	}
 	return list, nil
 }
 
 // Delete Dict values filtered by URL parameters.
 func (s *DictService) Delete(ctx context.Context) ([]Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	s.sweep()
+
 	indices := s.Dict.Search(s.factory(ctx))
 
-	keys := make([]string, len(indices))
-	for j, i := range indices {
-		keys[j] = s.Dict.Keys[i]
+	keys := make([]string, 0, len(indices))
+	for _, i := range indices {
+		if key := s.Dict.Keys[i]; !s.deleted(key) {
+			keys = append(keys, key)
+		}
 	}
 
-	list := make([]Model, len(indices))
+	list := make([]Model, len(keys))
+	for i, key := range keys {
+		list[i] = s.convert(s.Dict.Get(key))
+		if err := s.runHooks(ctx, HookBeforeRemove, list[i]); err != nil {
+			return nil, err
+		}
+	}
 
+	entries := make([]entry, len(keys))
 	for i, key := range keys {
-		if value := s.Dict.Remove(key); value != nil {
-			list[i] = s.convert(value)
+		entries[i] = s.capture(key)
+		s.remove(key)
+	}
+
+	for _, model := range list {
+		if err := s.runHooks(ctx, HookAfterRemove, model); err != nil {
+			for _, e := range entries {
+				s.restore(e)
+			}
+			return nil, err
 		}
 	}
 
@@ -90,90 +296,605 @@ func (s *DictService) Delete(ctx context.Context) ([]Model, error) {
 }
 
 // Create and store a new value.
-func (s *DictService) Create(reader io.Reader) (Model, error) {
+func (s *DictService) Create(ctx context.Context, reader io.Reader) (Model, error) {
+	return s.CreateWithTTL(ctx, reader, 0)
+}
+
+// CreateWithTTL creates and stores a new value which expires after the given
+// time-to-live. A non-positive ttl falls back to the TTL of the Model if it
+// implements TTLModel.
+func (s *DictService) CreateWithTTL(ctx context.Context, reader io.Reader, ttl time.Duration) (Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
 	model := s.build()
-	if err := json.NewDecoder(reader).Decode(&model); err != nil {
-		return nil, NewServiceError(err, http.StatusBadRequest)
+	if err := s.decoding.Decode(reader, &model); err != nil {
+		return nil, err
 	}
 
+	s.lock()
+	defer s.unlock()
+
+	s.sweep()
+
 	key := model.MakeKey(s.Count)
-	if err := model.Validate(); err != nil {
+	if err := s.runHooks(ctx, HookBeforeCreate, model); err != nil {
 		return nil, err
 	}
 
+	if err := model.Validate(); err != nil {
+		return nil, NewServiceError(err, http.StatusBadRequest)
+	}
+
 	if !s.Dict.Insert(key, model) {
 		err := NewKeyError(key, false)
 		return nil, NewServiceError(err, http.StatusBadRequest)
 	}
 
+	if err := s.runHooks(ctx, HookAfterCreate, model); err != nil {
+		s.Dict.Remove(key)
+		return nil, err
+	}
+
 	s.Count++
 
+	if err := s.record(key, RevisionCreate, model); err != nil {
+		return nil, err
+	}
+
+	s.setTTL(key, model, ttl)
+
 	return model, nil
 }
 
 // Select a value identified by the given key.
-func (s *DictService) Select(key string) (Model, error) {
+func (s *DictService) Select(ctx context.Context, key string) (Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	s.sweep()
+
 	value := s.Dict.Get(key)
-	if value == nil {
+	if value == nil || s.deleted(key) {
 		err := NewKeyError(key, true)
 		return nil, NewServiceError(err, http.StatusBadRequest)
 	}
 	return s.convert(value), nil
 }
 
+// SelectMany selects the values identified by the given keys at once. Missing
+// keys are left out of the result.
+func (s *DictService) SelectMany(ctx context.Context, keys []string) (map[string]Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	s.sweep()
+
+	values := make(map[string]Model, len(keys))
+	for _, key := range keys {
+		if value := s.Dict.Get(key); value != nil && !s.deleted(key) {
+			values[key] = s.convert(value)
+		}
+	}
+	return values, nil
+}
+
 // Remove a value identified by the given key.
-func (s *DictService) Remove(key string) (Model, error) {
-	value := s.Dict.Remove(key)
-	if value == nil {
+func (s *DictService) Remove(ctx context.Context, key string) (Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	s.sweep()
+
+	value := s.Dict.Get(key)
+	if value == nil || s.deleted(key) {
 		err := NewKeyError(key, true)
 		return nil, NewServiceError(err, http.StatusBadRequest)
 	}
-	return s.convert(value), nil
+
+	model := s.convert(value)
+	if err := s.runHooks(ctx, HookBeforeRemove, model); err != nil {
+		return nil, err
+	}
+
+	e := s.capture(key)
+	s.remove(key)
+
+	if err := s.runHooks(ctx, HookAfterRemove, model); err != nil {
+		s.restore(e)
+		return nil, err
+	}
+
+	return model, nil
 }
 
 // Update an entire value identified by the given key.
-func (s *DictService) Update(key string, reader io.Reader) (Model, error) {
+func (s *DictService) Update(ctx context.Context, key string, reader io.Reader) (Model, error) {
+	return s.UpdateWithTTL(ctx, key, reader, 0)
+}
+
+// UpdateWithTTL updates an entire value identified by the given key and resets
+// its time-to-live. A non-positive ttl falls back to the TTL of the Model if it
+// implements TTLModel, or else keeps the current expiry.
+func (s *DictService) UpdateWithTTL(ctx context.Context, key string, reader io.Reader, ttl time.Duration) (Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
 	value := s.build()
-	if err := json.NewDecoder(reader).Decode(&value); err != nil {
-		return nil, NewServiceError(err, http.StatusBadRequest)
+	if err := s.decoding.Decode(reader, &value); err != nil {
+		return nil, err
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	s.sweep()
+
+	return s.update(ctx, key, value, ttl, RevisionUpdate)
+}
+
+// update replaces the value identified by the given key, recording the
+// revision with the given op.
+func (s *DictService) update(ctx context.Context, key string, value Model, ttl time.Duration, op string) (Model, error) {
+	if err := s.runHooks(ctx, HookBeforeUpdate, value); err != nil {
+		return nil, err
 	}
 
 	if err := value.Validate(); err != nil {
 		return nil, NewServiceError(err, http.StatusBadRequest)
 	}
 
-	if !s.Dict.Set(key, value) {
+	e := s.capture(key)
+	if s.deleted(key) || !s.Dict.Set(key, value) {
 		err := NewKeyError(key, true)
 		return nil, NewServiceError(err, http.StatusBadRequest)
 	}
 
+	if err := s.runHooks(ctx, HookAfterUpdate, value); err != nil {
+		s.restore(e)
+		return nil, err
+	}
+
+	if err := s.record(key, op, value); err != nil {
+		return nil, err
+	}
+
+	s.setTTL(key, value, ttl)
+
 	return value, nil
 }
 
 // Modify part of a value identified by the given key.
-func (s *DictService) Modify(key string, reader io.Reader) (Model, error) {
+func (s *DictService) Modify(ctx context.Context, key string, reader io.Reader) (Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
 	model := s.build()
-	if err := json.NewDecoder(reader).Decode(&model); err != nil {
-		return nil, NewServiceError(err, http.StatusBadRequest)
+	if err := s.decoding.Decode(reader, &model); err != nil {
+		return nil, err
 	}
 
+	s.lock()
+	defer s.unlock()
+
+	s.sweep()
+
 	index := s.Dict.Index(key)
-	if index == s.Dict.Len() || s.Dict.Keys[index] != key {
+	if index == s.Dict.Len() || s.Dict.Keys[index] != key || s.deleted(key) {
 		err := NewKeyError(key, true)
 		return nil, NewServiceError(err, http.StatusBadRequest)
 	}
 
+	// Merge into the stored value so that fields which are not encoded in
+	// JSON are kept, rolling back to the captured state on failure.
+	e := s.capture(key)
 	value := s.convert(s.Dict.Values[index])
 
 	if err := value.Merge(model); err != nil {
+		s.restore(e)
 		return nil, NewServiceError(err, http.StatusBadRequest)
 	}
 
+	if err := s.runHooks(ctx, HookBeforeModify, value); err != nil {
+		s.restore(e)
+		return nil, err
+	}
+
 	if err := value.Validate(); err != nil {
+		s.restore(e)
 		return nil, NewServiceError(err, http.StatusBadRequest)
 	}
 
 	s.Dict.Values[index] = value
 
+	if err := s.runHooks(ctx, HookAfterModify, value); err != nil {
+		s.restore(e)
+		return nil, err
+	}
+
+	if err := s.record(key, RevisionModify, value); err != nil {
+		return nil, err
+	}
+
 	return value, nil
 }
+
+// entry is the state stored for a key, used to roll back an operation.
+type entry struct {
+	key      string
+	value    interface{}
+	contents interface{}
+	deleted  *time.Time
+	expires  *time.Time
+	history  []Revision
+}
+
+// capture the state stored for the given key. Values stored as pointers are
+// copied shallowly as well, so that changes made to them in place can be
+// rolled back.
+func (s *DictService) capture(key string) entry {
+	e := entry{key: key, value: s.Dict.Get(key), history: s.History[key]}
+	if v := reflect.ValueOf(e.value); v.Kind() == reflect.Ptr && !v.IsNil() {
+		contents := reflect.New(v.Elem().Type())
+		contents.Elem().Set(v.Elem())
+		e.contents = contents.Interface()
+	}
+	if at, ok := s.Deleted[key]; ok {
+		e.deleted = &at
+	}
+	if at, ok := s.Expires[key]; ok {
+		e.expires = &at
+	}
+	return e
+}
+
+// restore the state captured for a key.
+func (s *DictService) restore(e entry) {
+	if e.contents != nil {
+		reflect.ValueOf(e.value).Elem().Set(reflect.ValueOf(e.contents).Elem())
+	}
+	if !s.Dict.Set(e.key, e.value) {
+		s.Dict.Insert(e.key, e.value)
+	}
+	delete(s.Deleted, e.key)
+	if e.deleted != nil {
+		s.Deleted[e.key] = *e.deleted
+	}
+	delete(s.Expires, e.key)
+	if e.expires != nil {
+		s.Expires[e.key] = *e.expires
+	}
+	delete(s.History, e.key)
+	if e.history != nil {
+		s.History[e.key] = e.history
+	}
+}
+
+// remove the value for the given key, tombstoning it in soft delete mode.
+func (s *DictService) remove(key string) {
+	if s.softDelete {
+		s.tombstone(key)
+		return
+	}
+	s.Dict.Remove(key)
+	delete(s.History, key)
+	delete(s.Expires, key)
+}
+
+// SelectWithDeleted selects a value identified by the given key even if it is
+// tombstoned.
+func (s *DictService) SelectWithDeleted(ctx context.Context, key string) (Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	s.sweep()
+
+	value := s.Dict.Get(key)
+	if value == nil {
+		err := NewKeyError(key, true)
+		return nil, NewServiceError(err, http.StatusBadRequest)
+	}
+	return s.convert(value), nil
+}
+
+// Restore a tombstoned value identified by the given key.
+func (s *DictService) Restore(ctx context.Context, key string) (Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	s.sweep()
+
+	value := s.Dict.Get(key)
+	if value == nil {
+		err := NewKeyError(key, true)
+		return nil, NewServiceError(err, http.StatusBadRequest)
+	}
+
+	if !s.deleted(key) {
+		err := fmt.Errorf("key '%s' is not deleted", key)
+		return nil, NewServiceError(err, http.StatusBadRequest)
+	}
+
+	delete(s.Deleted, key)
+
+	return s.convert(value), nil
+}
+
+// Purge all tombstoned values regardless of the retention period.
+func (s *DictService) Purge(ctx context.Context) ([]Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	s.expire(time.Now())
+
+	return s.purge(time.Now()), nil
+}
+
+// purgeExpired purges tombstoned values older than the retention period.
+func (s *DictService) purgeExpired() {
+	if s.retention > 0 {
+		s.purge(time.Now().Add(-s.retention))
+	}
+}
+
+// purge physically removes values tombstoned before the given time.
+func (s *DictService) purge(before time.Time) []Model {
+	list := make([]Model, 0)
+	for key, at := range s.Deleted {
+		if at.After(before) {
+			continue
+		}
+		if value := s.Dict.Remove(key); value != nil {
+			list = append(list, s.convert(value))
+		}
+		delete(s.Deleted, key)
+		delete(s.History, key)
+		delete(s.Expires, key)
+	}
+	return list
+}
+
+// Revisions lists the recorded revisions for the given key.
+func (s *DictService) Revisions(ctx context.Context, key string) ([]Revision, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	s.sweep()
+
+	return s.revisions(key)
+}
+
+func (s *DictService) revisions(key string) ([]Revision, error) {
+	if !s.history {
+		return nil, errNotReverter
+	}
+	if s.Dict.Get(key) == nil || s.deleted(key) {
+		err := NewKeyError(key, true)
+		return nil, NewServiceError(err, http.StatusBadRequest)
+	}
+	return s.History[key], nil
+}
+
+// SelectRevision selects the value identified by the given key as of the
+// given revision number.
+func (s *DictService) SelectRevision(ctx context.Context, key string, number int) (Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	s.sweep()
+
+	revision, err := s.revision(key, number)
+	if err != nil {
+		return nil, err
+	}
+	return s.copy(revision.Value)
+}
+
+// Revert the value identified by the given key to the given revision number.
+// The revert runs the Update hooks and validation, and is itself recorded as
+// a new revision.
+func (s *DictService) Revert(ctx context.Context, key string, number int) (Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	s.sweep()
+
+	revision, err := s.revision(key, number)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := s.copy(revision.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.update(ctx, key, value, 0, RevisionRevert)
+}
+
+// revision finds the revision with the given number for the given key.
+func (s *DictService) revision(key string, number int) (Revision, error) {
+	revisions, err := s.revisions(key)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	for _, revision := range revisions {
+		if revision.Number == number {
+			return revision, nil
+		}
+	}
+
+	err = fmt.Errorf("revision %d of key '%s' does not exist", number, key)
+	return Revision{}, NewServiceError(err, http.StatusNotFound)
+}
+
+// record a snapshot of the value as a new revision for the given key.
+func (s *DictService) record(key string, op string, value Model) error {
+	if !s.history {
+		return nil
+	}
+
+	snapshot, err := s.copy(value)
+	if err != nil {
+		return err
+	}
+
+	revisions := s.History[key]
+
+	number := 1
+	if n := len(revisions); n > 0 {
+		number = revisions[n-1].Number + 1
+	}
+
+	revisions = append(revisions, Revision{
+		Number: number,
+		Time:   time.Now(),
+		Op:     op,
+		Value:  snapshot,
+	})
+
+	if s.limit > 0 && len(revisions) > s.limit {
+		revisions = append([]Revision(nil), revisions[len(revisions)-s.limit:]...)
+	}
+
+	s.History[key] = revisions
+
+	return nil
+}
+
+// copy a value so that later modifications do not affect it.
+func (s *DictService) copy(value Model) (Model, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	model := s.build()
+	if err := json.Unmarshal(data, &model); err != nil {
+		return nil, err
+	}
+
+	return model, nil
+}
+
+// Expiry returns the time at which the value identified by the given key
+// expires. Returns false if the value does not expire.
+func (s *DictService) Expiry(key string) (time.Time, bool) {
+	s.lock()
+	defer s.unlock()
+
+	at, ok := s.Expires[key]
+	return at, ok
+}
+
+// StartJanitor starts a goroutine removing expired values at the given
+// interval until the context is done. The returned channel is closed once the
+// janitor has stopped.
+func (s *DictService) StartJanitor(ctx context.Context, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				s.lock()
+				s.expire(now)
+				s.unlock()
+			}
+		}
+	}()
+
+	return done
+}
+
+// takeUnsaved returns the number of values expired since the last call, for a
+// persisting service to save them once.
+func (s *DictService) takeUnsaved() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := s.unsaved
+	s.unsaved = 0
+	return n
+}
+
+// setTTL sets the expiry of the value identified by the given key.
+func (s *DictService) setTTL(key string, model Model, ttl time.Duration) {
+	if ttl <= 0 {
+		if m, ok := model.(TTLModel); ok {
+			ttl = m.TTL()
+		}
+	}
+
+	if ttl > 0 {
+		s.Expires[key] = time.Now().Add(ttl)
+	}
+}
+
+// expire removes the values which have expired by the given time and queues
+// their expiry events.
+func (s *DictService) expire(now time.Time) {
+	for key, at := range s.Expires {
+		if at.After(now) {
+			continue
+		}
+		if value := s.Dict.Remove(key); value != nil {
+			s.unsaved++
+			s.expired = append(s.expired, Expired{
+				Key:   key,
+				Model: s.convert(value),
+				Time:  at,
+			})
+		}
+		delete(s.Deleted, key)
+		delete(s.History, key)
+		delete(s.Expires, key)
+	}
+}
@@ -2,10 +2,18 @@ package rest_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
 	rest "github.com/ktnyt/go-rest"
+	"github.com/ktnyt/go-rest/resttest"
 	"github.com/stretchr/testify/require"
 )
 
@@ -23,11 +31,21 @@ func TestDictService(t *testing.T) {
 			data, err := json.Marshal(&todo)
 			require.NoError(t, err)
 
-			_, err = service.Create(bytes.NewReader(data))
+			_, err = service.Create(emptyContext, bytes.NewReader(data))
 			require.NoError(t, err)
 		}
 	})
 
+	t.Run("can create valid data only", func(t *testing.T) {
+		todo := InvalidTodo()
+
+		data, err := json.Marshal(&todo)
+		require.NoError(t, err)
+
+		_, err = service.Create(emptyContext, bytes.NewReader(data))
+		resttest.RequireStatus(t, http.StatusBadRequest, err)
+	})
+
 	t.Run("can browse data", func(t *testing.T) {
 		t.Run("with filters", func(t *testing.T) {
 			trueValues, err := service.Browse(trueContext)
@@ -62,13 +80,13 @@ func TestDictService(t *testing.T) {
 	t.Run("can select data", func(t *testing.T) {
 		t.Run("for existing keys", func(t *testing.T) {
 			for _, key := range keys {
-				_, err := service.Select(key)
+				_, err := service.Select(emptyContext, key)
 				require.NoError(t, err)
 			}
 		})
 
 		t.Run("for existing keys only", func(t *testing.T) {
-			_, err := service.Select("foo")
+			_, err := service.Select(emptyContext, "foo")
 			require.Error(t, err)
 		})
 	})
@@ -81,7 +99,7 @@ func TestDictService(t *testing.T) {
 				data, err := json.Marshal(&todo)
 				require.NoError(t, err)
 
-				_, err = service.Update(key, bytes.NewReader(data))
+				_, err = service.Update(emptyContext, key, bytes.NewReader(data))
 				require.NoError(t, err)
 			}
 		})
@@ -92,7 +110,7 @@ func TestDictService(t *testing.T) {
 			data, err := json.Marshal(&todo)
 			require.NoError(t, err)
 
-			_, err = service.Update("foo", bytes.NewReader(data))
+			_, err = service.Update(emptyContext, "foo", bytes.NewReader(data))
 			require.Error(t, err)
 		})
 
@@ -103,13 +121,13 @@ func TestDictService(t *testing.T) {
 				data, err := json.Marshal(&todo)
 				require.NoError(t, err)
 
-				before, err := service.Select(key)
+				before, err := service.Select(emptyContext, key)
 				require.NoError(t, err)
 
-				_, err = service.Update(key, bytes.NewReader(data))
+				_, err = service.Update(emptyContext, key, bytes.NewReader(data))
 				require.Error(t, err)
 
-				after, err := service.Select(key)
+				after, err := service.Select(emptyContext, key)
 				require.NoError(t, err)
 				require.Equal(t, before, after)
 			}
@@ -124,7 +142,7 @@ func TestDictService(t *testing.T) {
 				data, err := json.Marshal(&todo)
 				require.NoError(t, err)
 
-				_, err = service.Modify(key, bytes.NewReader(data))
+				_, err = service.Modify(emptyContext, key, bytes.NewReader(data))
 				require.NoError(t, err)
 			}
 		})
@@ -135,7 +153,7 @@ func TestDictService(t *testing.T) {
 			data, err := json.Marshal(&todo)
 			require.NoError(t, err)
 
-			_, err = service.Modify("foo", bytes.NewReader(data))
+			_, err = service.Modify(emptyContext, "foo", bytes.NewReader(data))
 			require.Error(t, err)
 		})
 
@@ -146,13 +164,13 @@ func TestDictService(t *testing.T) {
 				data, err := json.Marshal(&todo)
 				require.NoError(t, err)
 
-				before, err := service.Select(key)
+				before, err := service.Select(emptyContext, key)
 				require.NoError(t, err)
 
-				_, err = service.Modify(key, bytes.NewReader(data))
+				_, err = service.Modify(emptyContext, key, bytes.NewReader(data))
 				require.Error(t, err)
 
-				after, err := service.Select(key)
+				after, err := service.Select(emptyContext, key)
 				require.NoError(t, err)
 				require.Equal(t, before, after)
 			}
@@ -162,7 +180,7 @@ func TestDictService(t *testing.T) {
 	t.Run("can remove data", func(t *testing.T) {
 		t.Run("for existing keys", func(t *testing.T) {
 			for _, key := range trueKeys {
-				_, err := service.Remove(key)
+				_, err := service.Remove(emptyContext, key)
 				require.NoError(t, err)
 			}
 
@@ -172,7 +190,7 @@ func TestDictService(t *testing.T) {
 		})
 
 		t.Run("for existing keys only", func(t *testing.T) {
-			_, err := service.Remove("foo")
+			_, err := service.Remove(emptyContext, "foo")
 			require.Error(t, err)
 
 			values, err := service.Browse(emptyContext)
@@ -197,7 +215,7 @@ func TestDictService(t *testing.T) {
 				data, err := json.Marshal(&todo)
 				require.NoError(t, err)
 
-				_, err = service.Create(bytes.NewReader(data))
+				_, err = service.Create(emptyContext, bytes.NewReader(data))
 				require.NoError(t, err)
 			}
 
@@ -211,4 +229,350 @@ func TestDictService(t *testing.T) {
 			require.Len(t, values, count)
 		})
 	})
+
+	t.Run("decodes bodies without locking", func(t *testing.T) {
+		reader, writer := io.Pipe()
+		done := make(chan error)
+		go func() {
+			_, err := service.Create(emptyContext, reader)
+			done <- err
+		}()
+
+		browsed := make(chan error)
+		go func() {
+			_, err := service.Browse(emptyContext)
+			browsed <- err
+		}()
+
+		select {
+		case err := <-browsed:
+			require.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("Browse blocked on a pending request body")
+		}
+
+		_, err := writer.Write(mustMarshal(RandomTodo()))
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+		require.NoError(t, <-done)
+	})
+}
+
+func TestDictServiceConformance(t *testing.T) {
+	fixtures := TodoFixtures
+	fixtures.Concurrency = 20
+	resttest.RunServiceConformance(t, NewTodoDictService, fixtures)
+}
+
+func TestServiceInterfaceConformance(t *testing.T) {
+	resttest.RunInterfaceConformance(t, func() rest.Interface {
+		return rest.NewServiceInterface(NewTodoDictService())
+	}, TodoFixtures)
+}
+
+func TestDictServiceSoftDelete(t *testing.T) {
+	service := rest.NewDictService(NewTodo, Filter, Convert, rest.WithSoftDelete(0))
+	deleter := service.(rest.SoftDeleter)
+	includeContext := rest.InjectParams(emptyContext, url.Values{
+		rest.IncludeDeletedParam: []string{"true"},
+	})
+	count := 4
+
+	for i := 0; i < count; i++ {
+		data, err := json.Marshal(RandomTodo())
+		require.NoError(t, err)
+
+		_, err = service.Create(emptyContext, bytes.NewReader(data))
+		require.NoError(t, err)
+	}
+
+	t.Run("can tombstone data", func(t *testing.T) {
+		_, err := service.Remove(emptyContext, "0")
+		require.NoError(t, err)
+
+		_, err = service.Select(emptyContext, "0")
+		require.Error(t, err)
+
+		_, err = service.Remove(emptyContext, "0")
+		require.Error(t, err)
+
+		models, err := service.Browse(emptyContext)
+		require.NoError(t, err)
+		require.Len(t, models, count-1)
+	})
+
+	t.Run("can include tombstoned data", func(t *testing.T) {
+		models, err := service.Browse(includeContext)
+		require.NoError(t, err)
+		require.Len(t, models, count)
+
+		_, err = deleter.SelectWithDeleted(emptyContext, "0")
+		require.NoError(t, err)
+	})
+
+	t.Run("can restore data", func(t *testing.T) {
+		_, err := deleter.Restore(emptyContext, "0")
+		require.NoError(t, err)
+
+		_, err = deleter.Restore(emptyContext, "0")
+		require.Error(t, err)
+
+		_, err = service.Select(emptyContext, "0")
+		require.NoError(t, err)
+	})
+
+	t.Run("can purge data", func(t *testing.T) {
+		models, err := service.Delete(trueContext)
+		require.NoError(t, err)
+		require.Len(t, models, count/2)
+
+		models, err = service.Browse(includeContext)
+		require.NoError(t, err)
+		require.Len(t, models, count)
+
+		models, err = deleter.Purge(emptyContext)
+		require.NoError(t, err)
+		require.Len(t, models, count/2)
+
+		models, err = service.Browse(includeContext)
+		require.NoError(t, err)
+		require.Len(t, models, count/2)
+	})
+
+	t.Run("purges after the retention period", func(t *testing.T) {
+		service := rest.NewDictService(NewTodo, Filter, Convert, rest.WithSoftDelete(time.Millisecond))
+
+		data, err := json.Marshal(RandomTodo())
+		require.NoError(t, err)
+
+		_, err = service.Create(emptyContext, bytes.NewReader(data))
+		require.NoError(t, err)
+
+		_, err = service.Remove(emptyContext, "0")
+		require.NoError(t, err)
+
+		time.Sleep(2 * time.Millisecond)
+
+		_, err = service.(rest.SoftDeleter).Restore(emptyContext, "0")
+		require.Error(t, err)
+	})
+}
+
+// SecretTodo is a Todo with a field which is not encoded in JSON.
+type SecretTodo struct {
+	Todo
+	Secret string `json:"-"`
+}
+
+func (t *SecretTodo) BeforeCreate(ctx context.Context) error {
+	t.Secret = "secret of " + t.Content
+	return nil
+}
+
+func (t *SecretTodo) Merge(other interface{}) error {
+	switch other := other.(type) {
+	case *SecretTodo:
+		return t.Todo.Merge(&other.Todo)
+	default:
+		return fmt.Errorf("attempted to merge non-SecretTodo object")
+	}
+}
+
+func TestDictServiceModify(t *testing.T) {
+	build := func() rest.Model { return &SecretTodo{} }
+	convert := func(value interface{}) rest.Model { return value.(*SecretTodo) }
+	service := rest.NewDictService(build, Filter, convert)
+
+	todo := RandomTodo()
+	_, err := service.Create(emptyContext, bytes.NewReader(mustMarshal(todo)))
+	require.NoError(t, err)
+
+	t.Run("keeps fields not encoded in JSON", func(t *testing.T) {
+		patch := RandomTodo()
+		model, err := service.Modify(emptyContext, "0", bytes.NewReader(mustMarshal(patch)))
+		require.NoError(t, err)
+		require.Equal(t, patch.Content, model.(*SecretTodo).Content)
+
+		model, err = service.Select(emptyContext, "0")
+		require.NoError(t, err)
+		require.Equal(t, patch.Content, model.(*SecretTodo).Content)
+		require.Equal(t, "secret of "+todo.Content, model.(*SecretTodo).Secret)
+	})
+
+	t.Run("rolls back failed merges", func(t *testing.T) {
+		before, err := service.Select(emptyContext, "0")
+		require.NoError(t, err)
+		expected := *before.(*SecretTodo)
+
+		_, err = service.Modify(emptyContext, "0", bytes.NewReader(mustMarshal(InvalidTodo())))
+		resttest.RequireStatus(t, http.StatusBadRequest, err)
+
+		after, err := service.Select(emptyContext, "0")
+		require.NoError(t, err)
+		require.Equal(t, expected, *after.(*SecretTodo))
+	})
+}
+
+func TestDictServiceHistory(t *testing.T) {
+	service := rest.NewDictService(NewTodo, Filter, Convert, rest.WithHistory(3))
+	reverter := service.(rest.Reverter)
+
+	first := RandomTodo()
+	data, err := json.Marshal(first)
+	require.NoError(t, err)
+
+	_, err = service.Create(emptyContext, bytes.NewReader(data))
+	require.NoError(t, err)
+
+	t.Run("records revisions", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			data, err := json.Marshal(RandomTodo())
+			require.NoError(t, err)
+
+			_, err = service.Update(emptyContext, "0", bytes.NewReader(data))
+			require.NoError(t, err)
+		}
+
+		revisions, err := reverter.Revisions(emptyContext, "0")
+		require.NoError(t, err)
+		require.Len(t, revisions, 3)
+		require.Equal(t, 2, revisions[0].Number)
+		require.Equal(t, 4, revisions[2].Number)
+		require.Equal(t, rest.RevisionUpdate, revisions[2].Op)
+
+		_, err = reverter.Revisions(emptyContext, "foo")
+		require.Error(t, err)
+	})
+
+	t.Run("can select revisions", func(t *testing.T) {
+		model, err := reverter.SelectRevision(emptyContext, "0", 4)
+		require.NoError(t, err)
+
+		current, err := service.Select(emptyContext, "0")
+		require.NoError(t, err)
+		require.Equal(t, current.(*Todo).Content, model.(*Todo).Content)
+
+		_, err = reverter.SelectRevision(emptyContext, "0", 1)
+		require.Error(t, err)
+	})
+
+	t.Run("can revert revisions", func(t *testing.T) {
+		old, err := reverter.SelectRevision(emptyContext, "0", 2)
+		require.NoError(t, err)
+
+		_, err = reverter.Revert(emptyContext, "0", 2)
+		require.NoError(t, err)
+
+		current, err := service.Select(emptyContext, "0")
+		require.NoError(t, err)
+		require.Equal(t, old.(*Todo).Content, current.(*Todo).Content)
+
+		revisions, err := reverter.Revisions(emptyContext, "0")
+		require.NoError(t, err)
+		require.Equal(t, rest.RevisionRevert, revisions[len(revisions)-1].Op)
+	})
+
+	t.Run("reverts through updates", func(t *testing.T) {
+		hooks := rest.NewHooks().On(rest.HookBeforeUpdate, func(ctx context.Context, model rest.Model) error {
+			if model.(*Todo).Content == first.Content {
+				return rest.NewServiceError(fmt.Errorf("cannot go back"), http.StatusConflict)
+			}
+			return nil
+		})
+		service := rest.NewDictService(NewTodo, Filter, Convert, rest.WithHistory(0), rest.WithHooks(hooks))
+		reverter := service.(rest.Reverter)
+
+		_, err := service.Create(emptyContext, bytes.NewReader(mustMarshal(first)))
+		require.NoError(t, err)
+		_, err = service.Update(emptyContext, "0", bytes.NewReader(mustMarshal(RandomTodo())))
+		require.NoError(t, err)
+
+		_, err = reverter.Revert(emptyContext, "0", 1)
+		resttest.RequireStatus(t, http.StatusConflict, err)
+
+		revisions, err := reverter.Revisions(emptyContext, "0")
+		require.NoError(t, err)
+		require.Len(t, revisions, 2)
+	})
+
+	t.Run("is not implemented without history", func(t *testing.T) {
+		service := NewTodoDictService()
+		_, err := service.Create(emptyContext, bytes.NewReader(mustMarshal(RandomTodo())))
+		require.NoError(t, err)
+
+		_, err = service.(rest.Reverter).Revisions(emptyContext, "0")
+		resttest.RequireStatus(t, http.StatusNotImplemented, err)
+
+		_, err = service.(rest.Reverter).Revert(emptyContext, "0", 1)
+		resttest.RequireStatus(t, http.StatusNotImplemented, err)
+	})
+}
+
+func TestDictServiceExpiry(t *testing.T) {
+	events := make(chan rest.Expired, 8)
+	service := rest.NewDictService(NewTodo, Filter, Convert, rest.WithExpiryHandler(func(e rest.Expired) {
+		events <- e
+	}))
+	expirer := service.(rest.Expirer)
+
+	create := func(ttl time.Duration) {
+		data, err := json.Marshal(RandomTodo())
+		require.NoError(t, err)
+
+		_, err = expirer.CreateWithTTL(emptyContext, bytes.NewReader(data), ttl)
+		require.NoError(t, err)
+	}
+
+	t.Run("expires lazily on read", func(t *testing.T) {
+		create(time.Millisecond)
+		create(time.Hour)
+
+		time.Sleep(2 * time.Millisecond)
+
+		_, err := service.Select(emptyContext, "0")
+		require.Error(t, err)
+
+		_, err = service.Select(emptyContext, "1")
+		require.NoError(t, err)
+
+		require.Equal(t, "0", (<-events).Key)
+	})
+
+	t.Run("expires in the background", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(emptyContext)
+		done := service.(*rest.DictService).StartJanitor(ctx, time.Millisecond)
+
+		create(time.Millisecond)
+
+		select {
+		case e := <-events:
+			require.Equal(t, "2", e.Key)
+		case <-time.After(time.Second):
+			t.Fatal("janitor did not expire value")
+		}
+
+		cancel()
+		<-done
+
+		models, err := service.Browse(emptyContext)
+		require.NoError(t, err)
+		require.Len(t, models, 1)
+	})
+
+	t.Run("rejects non-positive TTL headers", func(t *testing.T) {
+		iface := rest.NewServiceInterface(service)
+		for _, ttl := range []string{"0", "-5", "-1m", "0s", "soon"} {
+			r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(mustMarshal(RandomTodo())))
+			r.Header.Set(rest.TTLHeader, ttl)
+			w := httptest.NewRecorder()
+			iface.Create(w, r)
+			require.Equal(t, http.StatusBadRequest, w.Code, ttl)
+		}
+
+		r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(mustMarshal(RandomTodo())))
+		r.Header.Set(rest.TTLHeader, "60")
+		w := httptest.NewRecorder()
+		iface.Create(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+	})
 }
@@ -0,0 +1,307 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ExpandParam is the URL parameter listing the references to expand.
+const ExpandParam = "expand"
+
+// IncludeParam is an alias of the ExpandParam.
+const IncludeParam = "include"
+
+// Reference declares a field of a Model holding the key, or a list of keys,
+// of values of another Service in a Registry.
+type Reference struct {
+	// Name is used in the ExpandParam and as the JSON field the referenced
+	// values are embedded in. It may be the same as Field to replace the
+	// keys with the values.
+	Name string
+
+	// Field is the JSON field holding the key or keys.
+	Field string
+
+	// Service is the name of the referenced Service in the Registry.
+	Service string
+}
+
+// Referencer is implemented by Models which reference values of other
+// Services.
+type Referencer interface {
+	References() []Reference
+}
+
+// BatchSelector is implemented by Services which can select many values at
+// once. Missing keys are left out of the result.
+type BatchSelector interface {
+	SelectMany(ctx context.Context, keys []string) (map[string]Model, error)
+}
+
+// Registry is a set of Services by name which references can be resolved
+// against. Referenced values are selected through the registered Services,
+// so register the Services wrapped with Authorize as they are served, or
+// give the Registry an Authorizer with WithRegistryAuthorizer.
+type Registry struct {
+	mu         sync.RWMutex
+	services   map[string]Service
+	authorizer Authorizer
+}
+
+// RegistryOption configures a Registry created by NewRegistry.
+type RegistryOption func(*Registry)
+
+// WithRegistryAuthorizer makes the Registry wrap every registered Service
+// which is not already wrapped with Authorize with Authorize(authorizer), so
+// that referenced values the Principal may not select expand to null.
+func WithRegistryAuthorizer(authorizer Authorizer) RegistryOption {
+	return func(r *Registry) {
+		r.authorizer = authorizer
+	}
+}
+
+// NewRegistry creates a new Registry.
+func NewRegistry(opts ...RegistryOption) *Registry {
+	r := &Registry{services: make(map[string]Service)}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Register a Service by name.
+func (r *Registry) Register(name string, service Service) *Registry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := service.(authorizedService); !ok && r.authorizer != nil {
+		service = Authorize(r.authorizer)(service)
+	}
+	r.services[name] = service
+	return r
+}
+
+// Service returns the Service registered by the name.
+func (r *Registry) Service(name string) (Service, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	service, ok := r.services[name]
+	return service, ok
+}
+
+// Names returns the names of the registered Services in order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.services))
+	for name := range r.services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseExpand parses the values of the ExpandParam and IncludeParam in the
+// context, which are comma separated reference names.
+func ParseExpand(ctx context.Context) []string {
+	params := ExtractParams(ctx)
+	values := make([]string, 0, len(params[ExpandParam])+len(params[IncludeParam]))
+	values = append(values, params[ExpandParam]...)
+	values = append(values, params[IncludeParam]...)
+
+	seen := make(map[string]bool)
+	names := make([]string, 0, len(values))
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name != "" && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// Expand resolves the named references of the Model, or list of Models, and
+// embeds the referenced values into its JSON representation. The keys of
+// every reference are collected from all Models first and looked up in a
+// single batch per Service. Keys which do not resolve embed null.
+func (r *Registry) Expand(ctx context.Context, v interface{}, names []string) (interface{}, error) {
+	var models []Model
+	switch v := v.(type) {
+	case []Model:
+		models = v
+	case Model:
+		models = []Model{v}
+	default:
+		return v, nil
+	}
+
+	objects := make([]map[string]interface{}, len(models))
+	for i, model := range models {
+		object, err := toObject(model)
+		if err != nil {
+			return nil, err
+		}
+		objects[i] = object
+	}
+
+	for _, name := range names {
+		if err := r.expand(ctx, models, objects, name); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, ok := v.(Model); ok {
+		return objects[0], nil
+	}
+
+	list := make([]interface{}, len(objects))
+	for i := range objects {
+		list[i] = objects[i]
+	}
+	return list, nil
+}
+
+// expand resolves the named reference for every object.
+func (r *Registry) expand(ctx context.Context, models []Model, objects []map[string]interface{}, name string) error {
+	refs := make([]*Reference, len(models))
+	services := make(map[string][]string)
+	for i, model := range models {
+		ref := findReference(model, name)
+		if ref == nil {
+			err := fmt.Errorf("'%s' is not a reference", name)
+			return NewServiceError(err, http.StatusBadRequest)
+		}
+		refs[i] = ref
+
+		key, ok := lookupKey(objects[i], ref.Field)
+		if !ok {
+			continue
+		}
+		services[ref.Service] = append(services[ref.Service], referenceKeys(objects[i][key])...)
+	}
+
+	resolved := make(map[string]map[string]Model, len(services))
+	for serviceName, keys := range services {
+		service, ok := r.Service(serviceName)
+		if !ok {
+			err := fmt.Errorf("service '%s' is not registered", serviceName)
+			return NewServiceError(err, http.StatusInternalServerError)
+		}
+
+		values, err := SelectMany(ctx, service, keys)
+		if err != nil {
+			return errors.Wrapf(err, "while expanding %s", name)
+		}
+		resolved[serviceName] = values
+	}
+
+	for i, object := range objects {
+		ref := refs[i]
+		values := resolved[ref.Service]
+
+		key, ok := lookupKey(object, ref.Field)
+		if !ok {
+			object[ref.Name] = nil
+			continue
+		}
+
+		switch field := object[key].(type) {
+		case []interface{}:
+			keys := referenceKeys(field)
+			list := make([]interface{}, len(keys))
+			for j, key := range keys {
+				list[j] = embed(values, key)
+			}
+			object[ref.Name] = list
+		default:
+			keys := referenceKeys(field)
+			if len(keys) == 0 {
+				object[ref.Name] = nil
+			} else {
+				object[ref.Name] = embed(values, keys[0])
+			}
+		}
+	}
+
+	return nil
+}
+
+// SelectMany selects the values for the distinct keys using a BatchSelector
+// if the Service is one, and one Select per key otherwise. Missing keys are
+// left out of the result.
+func SelectMany(ctx context.Context, service Service, keys []string) (map[string]Model, error) {
+	unique := make([]string, 0, len(keys))
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, key)
+		}
+	}
+
+	if batch, ok := service.(BatchSelector); ok {
+		return batch.SelectMany(ctx, unique)
+	}
+
+	values := make(map[string]Model, len(unique))
+	for _, key := range unique {
+		model, err := service.Select(ctx, key)
+		if err != nil {
+			if e, ok := errors.Cause(err).(ServiceError); ok && e.Code < http.StatusInternalServerError {
+				continue
+			}
+			return nil, err
+		}
+		values[key] = model
+	}
+	return values, nil
+}
+
+func findReference(model Model, name string) *Reference {
+	referencer, ok := model.(Referencer)
+	if !ok {
+		return nil
+	}
+	for _, ref := range referencer.References() {
+		if ref.Name == name {
+			return &ref
+		}
+	}
+	return nil
+}
+
+// referenceKeys extracts the keys from a JSON decoded field value.
+func referenceKeys(v interface{}) []string {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []string{v}
+	case []interface{}:
+		keys := make([]string, 0, len(v))
+		for _, item := range v {
+			keys = append(keys, referenceKeys(item)...)
+		}
+		return keys
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+func embed(values map[string]Model, key string) interface{} {
+	if model, ok := values[key]; ok {
+		return model
+	}
+	return nil
+}
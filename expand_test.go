@@ -0,0 +1,177 @@
+package rest_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/stretchr/testify/require"
+)
+
+type Task struct {
+	Key   string   `json:"key"`
+	Title string   `json:"title"`
+	List  string   `json:"list"`
+	Tags  []string `json:"tags"`
+}
+
+func (t *Task) Validate() error {
+	if len(t.Title) == 0 {
+		return fmt.Errorf("task title is empty")
+	}
+	return nil
+}
+
+func (t *Task) MakeKey(i int) string {
+	t.Key = strconv.Itoa(i)
+	return t.Key
+}
+
+func (t *Task) Merge(other interface{}) error {
+	switch other := other.(type) {
+	case *Task:
+		t.Title = other.Title
+		t.List = other.List
+		t.Tags = other.Tags
+		return nil
+	default:
+		return fmt.Errorf("attempted to merge non-Task object")
+	}
+}
+
+func (t *Task) References() []rest.Reference {
+	return []rest.Reference{
+		{Name: "list", Field: "list", Service: "lists"},
+		{Name: "labels", Field: "tags", Service: "lists"},
+	}
+}
+
+func NewTaskService() rest.Service {
+	return rest.NewDictService(
+		func() rest.Model { return &Task{} },
+		func(context.Context) rest.Filter { return func(interface{}) bool { return true } },
+		func(value interface{}) rest.Model { return value.(*Task) },
+	)
+}
+
+func TestExpand(t *testing.T) {
+	lists := NewListService()
+	createJSON(t, emptyContext, lists, `{"name":"foo"}`)
+	createJSON(t, emptyContext, lists, `{"name":"bar"}`)
+
+	selects := 0
+	counted := rest.ServiceFuncs{
+		Service: lists,
+		SelectFunc: func(ctx context.Context, key string) (rest.Model, error) {
+			selects++
+			return lists.Select(ctx, key)
+		},
+	}
+
+	tasks := NewTaskService()
+	createJSON(t, emptyContext, tasks, `{"title":"a","list":"0","tags":["0","1"]}`)
+	createJSON(t, emptyContext, tasks, `{"title":"b","list":"0"}`)
+	createJSON(t, emptyContext, tasks, `{"title":"c","list":"5"}`)
+
+	registry := rest.NewRegistry().Register("lists", counted).Register("tasks", tasks)
+	iface := rest.NewServiceInterface(tasks, rest.WithRegistry(registry))
+
+	t.Run("expands references in batches", func(t *testing.T) {
+		selects = 0
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/?expand=list,labels", nil)
+		iface.Browse(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var result []struct {
+			Key    string  `json:"key"`
+			List   *List   `json:"list"`
+			Labels []*List `json:"labels"`
+		}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&result))
+		require.Len(t, result, 3)
+
+		require.Equal(t, "foo", result[0].List.Name)
+		require.Len(t, result[0].Labels, 2)
+		require.Equal(t, "bar", result[0].Labels[1].Name)
+		require.Equal(t, "foo", result[1].List.Name)
+		require.Nil(t, result[2].List)
+
+		require.Equal(t, 4, selects)
+	})
+
+	t.Run("expands selected values", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/?include=list&fields=title,list", nil)
+		iface.Select(w, r.WithContext(context.WithValue(r.Context(), rest.PK, "0")))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var result map[string]interface{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&result))
+		require.Len(t, result, 2)
+		require.Equal(t, "foo", result["list"].(map[string]interface{})["name"])
+	})
+
+	t.Run("rejects unknown references", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/?expand=owner", nil)
+		iface.Browse(w, r)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/?expand=list", nil)
+		rest.NewServiceInterface(tasks).Browse(w, r)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("checks fields before expanding", func(t *testing.T) {
+		for _, query := range []string{"expand=list&fields=titel", "expand=list&fields=title.x"} {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+			iface.Browse(w, r)
+			require.Equal(t, http.StatusBadRequest, w.Code, query)
+		}
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/?expand=labels&fields=title,labels.name", nil)
+		iface.Browse(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("authorizes expanded values", func(t *testing.T) {
+		authorizer := rest.AuthorizerFunc(func(ctx context.Context, op rest.Operation, model rest.Model) error {
+			if list, ok := model.(*List); ok && list.Name == "bar" {
+				return rest.ErrForbidden
+			}
+			return nil
+		})
+		registry := rest.NewRegistry(rest.WithRegistryAuthorizer(authorizer)).Register("lists", lists)
+		iface := rest.NewServiceInterface(tasks, rest.WithRegistry(registry))
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/?expand=labels", nil)
+		iface.Select(w, r.WithContext(context.WithValue(r.Context(), rest.PK, "0")))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var result struct {
+			Labels []*List `json:"labels"`
+		}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&result))
+		require.Len(t, result.Labels, 2)
+		require.Equal(t, "foo", result.Labels[0].Name)
+		require.Nil(t, result.Labels[1])
+	})
+
+	t.Run("selects many values from dict services", func(t *testing.T) {
+		values, err := lists.(rest.BatchSelector).SelectMany(emptyContext, []string{"0", "1", "2"})
+		require.NoError(t, err)
+		require.Len(t, values, 2)
+		require.Equal(t, "bar", values["1"].(*List).Name)
+	})
+}
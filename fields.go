@@ -0,0 +1,311 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// FieldsParam is the URL parameter used to request a sparse fieldset.
+const FieldsParam = "fields"
+
+// FieldError represents a request for a field that does not exist.
+type FieldError struct {
+	path string
+}
+
+// NewFieldError creates a new FieldError.
+func NewFieldError(path string) error {
+	return FieldError{path: path}
+}
+
+// Error satisfies the error interface.
+func (e FieldError) Error() string {
+	return fmt.Sprintf("field '%s' does not exist", e.path)
+}
+
+// Fieldset is a tree of JSON field names selected for encoding. A nil
+// subtree selects the entire value of the field.
+type Fieldset map[string]Fieldset
+
+// ParseFieldset parses a comma separated list of dotted field paths, e.g.
+// "content,owner.name". Returns nil if no fields are given.
+func ParseFieldset(values ...string) Fieldset {
+	var fields Fieldset
+	for _, value := range values {
+		for _, path := range strings.Split(value, ",") {
+			if path = strings.TrimSpace(path); path != "" {
+				if fields == nil {
+					fields = make(Fieldset)
+				}
+				fields.add(strings.Split(path, "."))
+			}
+		}
+	}
+	return fields
+}
+
+func (f Fieldset) add(names []string) {
+	sub, ok := f[names[0]]
+	if len(names) == 1 {
+		f[names[0]] = nil
+		return
+	}
+	if ok && sub == nil {
+		return
+	}
+	if sub == nil {
+		sub = make(Fieldset)
+		f[names[0]] = sub
+	}
+	sub.add(names[1:])
+}
+
+// Check the fieldset against the JSON encoding of the given type.
+func (f Fieldset) Check(t reflect.Type) error {
+	return f.check(t, "")
+}
+
+func (f Fieldset) check(t reflect.Type, prefix string) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+		if prefix == "" {
+			return nil
+		}
+		return NewFieldError(prefix + f.first())
+	}
+
+	switch t.Kind() {
+	case reflect.Interface, reflect.Map:
+		return nil
+	case reflect.Slice, reflect.Array:
+		return f.check(t.Elem(), prefix)
+	case reflect.Struct:
+		fields := jsonFields(t)
+		for name, sub := range f {
+			field, ok := lookupField(fields, name)
+			if !ok {
+				return NewFieldError(prefix + name)
+			}
+			if sub != nil {
+				if err := sub.check(field, prefix+name+"."); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	default:
+		return NewFieldError(prefix + f.first())
+	}
+}
+
+func (f Fieldset) first() string {
+	for name := range f {
+		return name
+	}
+	return ""
+}
+
+// Project a JSON decoded value onto the fieldset.
+func (f Fieldset) Project(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(f))
+		for name, sub := range f {
+			key, ok := lookupKey(v, name)
+			if !ok {
+				continue
+			}
+			if sub == nil {
+				m[key] = v[key]
+			} else {
+				m[key] = sub.Project(v[key])
+			}
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i := range v {
+			l[i] = f.Project(v[i])
+		}
+		return l
+	default:
+		return v
+	}
+}
+
+// Apply the fieldset to the given value, checking the fields against the
+// types of the value (or of its elements for a list of Models).
+func (f Fieldset) Apply(v interface{}) (interface{}, error) {
+	if f == nil {
+		return v, nil
+	}
+
+	if err := f.checkValue(v); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+
+	return f.Project(generic), nil
+}
+
+// checkValue checks the fieldset against the type of the value, or of its
+// elements for a list of Models. Returns a ServiceError with status code 400
+// for unknown fields.
+func (f Fieldset) checkValue(v interface{}) error {
+	if f == nil {
+		return nil
+	}
+
+	switch v := v.(type) {
+	case []Model:
+		checked := make(map[reflect.Type]bool)
+		for _, model := range v {
+			t := reflect.TypeOf(model)
+			if t == nil || checked[t] {
+				continue
+			}
+			if err := f.Check(t); err != nil {
+				return NewServiceError(err, http.StatusBadRequest)
+			}
+			checked[t] = true
+		}
+	default:
+		if t := reflect.TypeOf(v); t != nil {
+			if err := f.Check(t); err != nil {
+				return NewServiceError(err, http.StatusBadRequest)
+			}
+		}
+	}
+	return nil
+}
+
+// without returns a copy of the fieldset without the named fields.
+func (f Fieldset) without(names []string) Fieldset {
+	if f == nil {
+		return nil
+	}
+
+	fields := make(Fieldset, len(f))
+	for name, sub := range f {
+		fields[name] = sub
+	}
+	for _, name := range names {
+		delete(fields, name)
+	}
+	return fields
+}
+
+var marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// jsonFields lists the JSON field names of a struct type and their types,
+// following the encoding/json rules for tags and embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				for name, t := range jsonFields(embedded) {
+					if _, ok := fields[name]; !ok {
+						fields[name] = t
+					}
+				}
+				continue
+			}
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// lookupField finds a field by name, falling back to a case-insensitive match
+// the same way encoding/json does when decoding.
+func lookupField(fields map[string]reflect.Type, name string) (reflect.Type, bool) {
+	if t, ok := fields[name]; ok {
+		return t, true
+	}
+	for key, t := range fields {
+		if strings.EqualFold(key, name) {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+func lookupKey(m map[string]interface{}, name string) (string, bool) {
+	if _, ok := m[name]; ok {
+		return name, true
+	}
+	for key := range m {
+		if strings.EqualFold(key, name) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// toObject converts the Model into its JSON object representation. Numbers
+// are decoded as json.Number to keep their textual representation.
+func toObject(model Model) (map[string]interface{}, error) {
+	data, err := json.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+// modelField extracts the value of the named JSON field of the model.
+func modelField(model Model, name string) (interface{}, bool) {
+	object, err := toObject(model)
+	if err != nil {
+		return nil, false
+	}
+
+	key, ok := lookupKey(object, name)
+	if !ok {
+		return nil, false
+	}
+	return object[key], true
+}
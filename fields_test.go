@@ -0,0 +1,110 @@
+package rest_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/stretchr/testify/require"
+)
+
+type Owner struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type Note struct {
+	Title  string  `json:"title"`
+	Owner  Owner   `json:"owner"`
+	Tags   []Owner `json:"tags"`
+	Hidden string  `json:"-"`
+}
+
+func TestFieldset(t *testing.T) {
+	note := Note{
+		Title: "title",
+		Owner: Owner{Name: "name", Email: "email"},
+		Tags:  []Owner{{Name: "a"}, {Name: "b"}},
+	}
+
+	t.Run("can parse paths", func(t *testing.T) {
+		fields := rest.ParseFieldset("title,owner.name", "owner.email")
+		require.Equal(t, rest.Fieldset{
+			"title": nil,
+			"owner": rest.Fieldset{"name": nil, "email": nil},
+		}, fields)
+		require.Nil(t, rest.ParseFieldset(""))
+	})
+
+	t.Run("can check paths", func(t *testing.T) {
+		typ := reflect.TypeOf(&note)
+		require.NoError(t, rest.ParseFieldset("title,owner.name,tags.name").Check(typ))
+		require.Error(t, rest.ParseFieldset("foo").Check(typ))
+		require.Error(t, rest.ParseFieldset("Hidden").Check(typ))
+		require.Error(t, rest.ParseFieldset("title.foo").Check(typ))
+		require.Error(t, rest.ParseFieldset("owner.foo").Check(typ))
+	})
+
+	t.Run("can project values", func(t *testing.T) {
+		v, err := rest.ParseFieldset("title,owner.name,tags.name").Apply(&note)
+		require.NoError(t, err)
+		require.Equal(t, map[string]interface{}{
+			"title": "title",
+			"owner": map[string]interface{}{"name": "name"},
+			"tags": []interface{}{
+				map[string]interface{}{"name": "a"},
+				map[string]interface{}{"name": "b"},
+			},
+		}, v)
+	})
+}
+
+func TestServiceInterfaceFields(t *testing.T) {
+	service := NewTodoDictService()
+	iface := rest.NewServiceInterface(service)
+
+	todo := RandomTodo()
+	data, err := json.Marshal(&todo)
+	require.NoError(t, err)
+	_, err = service.Create(emptyContext, bytes.NewReader(data))
+	require.NoError(t, err)
+
+	t.Run("projects browsed models", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/?fields=content,done", nil)
+		iface.Browse(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var list []map[string]interface{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&list))
+		require.Len(t, list, 1)
+		require.Equal(t, map[string]interface{}{
+			"Content": todo.Content,
+			"Done":    false,
+		}, list[0])
+	})
+
+	t.Run("projects a selected model", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/0?fields=key", nil)
+		r = r.WithContext(context.WithValue(r.Context(), rest.PK, "0"))
+		iface.Select(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var item map[string]interface{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&item))
+		require.Equal(t, map[string]interface{}{"Key": "0"}, item)
+	})
+
+	t.Run("rejects unknown fields", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/?fields=content,foo", nil)
+		iface.Browse(w, r)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,87 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// AllParam is the URL parameter confirming a Delete on a whole collection.
+const AllParam = "all"
+
+// DryRunParam is the URL parameter for listing the values a Delete would
+// remove without removing them.
+const DryRunParam = "dryRun"
+
+// ErrUnfilteredDelete is returned when a Delete without any filter parameters
+// is not confirmed.
+var ErrUnfilteredDelete = errors.Errorf("deleting all values requires the %s=true parameter", AllParam)
+
+// controlParams are URL parameters which control how a request is served
+// rather than which values it affects.
+var controlParams = map[string]bool{
+	AllParam:            true,
+	DryRunParam:         true,
+	ExpandParam:         true,
+	IncludeParam:        true,
+	FieldsParam:         true,
+	IncludeDeletedParam: true,
+	RevisionParam:       true,
+	SortParam:           true,
+	LimitParam:          true,
+	OffsetParam:         true,
+	AfterParam:          true,
+	FormatParam:         true,
+	ModeParam:           true,
+}
+
+// Filterer is implemented by Services which know the URL parameters they
+// filter values by.
+type Filterer interface {
+	FilterParams() []string
+}
+
+// filterParams returns the URL parameters the Service filters values by, or
+// nil if it does not report them.
+func filterParams(service Service) []string {
+	if filterer, ok := service.(Filterer); ok {
+		return filterer.FilterParams()
+	}
+	return nil
+}
+
+// Filtered tests if the URL parameters in the context narrow down the values
+// affected by a collection operation on the Service. Only the FilterParams
+// reported by the Service count, so that a misspelled parameter does not
+// pass for a filter. A Service which does not report them is never Filtered.
+func Filtered(ctx context.Context, service Service) bool {
+	params := ExtractParams(ctx)
+	for _, name := range filterParams(service) {
+		if _, ok := params[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// GuardDelete creates a ServiceMiddleware protecting against accidentally
+// deleting a whole collection. A Delete which is not Filtered is rejected
+// with a 400 unless the AllParam is set or allowUnfiltered is true. A Delete
+// with the DryRunParam set returns the values it would remove instead.
+func GuardDelete(allowUnfiltered bool) ServiceMiddleware {
+	return func(service Service) Service {
+		return ServiceFuncs{
+			Service: service,
+			DeleteFunc: func(ctx context.Context) ([]Model, error) {
+				if !allowUnfiltered && !Filtered(ctx, service) && !ParamEnabled(ctx, AllParam) {
+					return nil, NewServiceError(ErrUnfilteredDelete, http.StatusBadRequest)
+				}
+				if ParamEnabled(ctx, DryRunParam) {
+					return service.Browse(ctx)
+				}
+				return service.Delete(ctx)
+			},
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package rest_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuardDelete(t *testing.T) {
+	populate := func(t *testing.T) rest.Service {
+		t.Helper()
+		service := NewTodoDictService()
+		for i := 0; i < 4; i++ {
+			_, err := create(t, service, RandomTodo())
+			require.NoError(t, err)
+		}
+		return service
+	}
+
+	remove := func(iface rest.Interface, target string) (*httptest.ResponseRecorder, []Todo) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodDelete, target, nil)
+		iface.Delete(w, r)
+
+		var todos []Todo
+		if w.Code == http.StatusOK {
+			json.NewDecoder(w.Body).Decode(&todos)
+		}
+		return w, todos
+	}
+
+	t.Run("rejects unfiltered deletes", func(t *testing.T) {
+		service := populate(t)
+		iface := rest.NewServiceInterface(service)
+
+		w, _ := remove(iface, "/")
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		require.Equal(t, rest.ProblemContentType, w.Header().Get("Content-Type"))
+
+		w, _ = remove(iface, "/?fields=key")
+		require.Equal(t, http.StatusBadRequest, w.Code)
+
+		// Without declared FilterParams no parameter counts as a filter.
+		w, _ = remove(iface, "/?dnoe=true")
+		require.Equal(t, http.StatusBadRequest, w.Code)
+
+		w, _ = remove(iface, "/?done=true")
+		require.Equal(t, http.StatusBadRequest, w.Code)
+
+		models, err := service.Browse(emptyContext)
+		require.NoError(t, err)
+		require.Len(t, models, 4)
+	})
+
+	t.Run("allows confirmed deletes", func(t *testing.T) {
+		service := populate(t)
+		iface := rest.NewServiceInterface(service)
+
+		w, todos := remove(iface, "/?all=true")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, todos, 4)
+
+		models, err := service.Browse(emptyContext)
+		require.NoError(t, err)
+		require.Len(t, models, 0)
+	})
+
+	t.Run("allows filtered deletes", func(t *testing.T) {
+		filter := func(ctx context.Context) rest.Filter {
+			done := rest.ExtractParams(ctx).Get("done")
+			return func(value interface{}) bool {
+				return done == "" || strconv.FormatBool(value.(*Todo).Done) == done
+			}
+		}
+		service := rest.NewDictService(NewTodo, filter, Convert, rest.WithFilterParams("done"))
+		for i := 0; i < 4; i++ {
+			todo := RandomTodo()
+			todo.Done = i%2 == 0
+			_, err := create(t, service, todo)
+			require.NoError(t, err)
+		}
+		iface := rest.NewServiceInterface(service)
+
+		for _, target := range []string{"/?dnoe=true", "/?x=1", "/?offset=0"} {
+			w, _ := remove(iface, target)
+			require.Equal(t, http.StatusBadRequest, w.Code, target)
+		}
+
+		w, todos := remove(iface, "/?done=true")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, todos, 2)
+		for _, todo := range todos {
+			require.True(t, todo.Done)
+		}
+
+		models, err := service.Browse(emptyContext)
+		require.NoError(t, err)
+		require.Len(t, models, 2)
+		for _, model := range models {
+			require.False(t, model.(*Todo).Done)
+		}
+	})
+
+	t.Run("ignores paging parameters", func(t *testing.T) {
+		iface := rest.NewServiceInterface(populate(t))
+
+		for _, target := range []string{"/?limit=1", "/?offset=0", "/?after=1"} {
+			w, _ := remove(iface, target)
+			require.Equal(t, http.StatusBadRequest, w.Code, target)
+		}
+	})
+
+	t.Run("allows configured unfiltered deletes", func(t *testing.T) {
+		iface := rest.NewServiceInterface(populate(t), rest.AllowUnfilteredDelete())
+
+		w, todos := remove(iface, "/")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, todos, 4)
+	})
+
+	t.Run("lists values in dry runs", func(t *testing.T) {
+		service := populate(t)
+		iface := rest.NewServiceInterface(service)
+
+		w, _ := remove(iface, "/?dryRun=true")
+		require.Equal(t, http.StatusBadRequest, w.Code)
+
+		w, todos := remove(iface, "/?all=true&dryRun=true")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, todos, 4)
+
+		models, err := service.Browse(emptyContext)
+		require.NoError(t, err)
+		require.Len(t, models, 4)
+	})
+
+	t.Run("guards services", func(t *testing.T) {
+		service := rest.GuardDelete(false)(populate(t))
+
+		_, err := service.Delete(emptyContext)
+		require.Equal(t, http.StatusBadRequest, err.(rest.ServiceError).Code)
+	})
+}
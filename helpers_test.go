@@ -3,12 +3,14 @@ package rest_test
 import (
 	"context"
 	"encoding/gob"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"time"
 
 	"github.com/gofrs/uuid"
 	rest "github.com/ktnyt/go-rest"
+	"github.com/ktnyt/go-rest/resttest"
 )
 
 func init() {
@@ -98,3 +100,22 @@ var falseContext = context.WithValue(emptyContext, "done", "false")
 func NewTodoDictService() rest.Service {
 	return rest.NewDictService(NewTodo, Filter, Convert)
 }
+
+func mustMarshal(v interface{}) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+var TodoFixtures = resttest.Fixtures{
+	Valid:   func() []byte { return mustMarshal(RandomTodo()) },
+	Invalid: mustMarshal(InvalidTodo()),
+	Build:   NewTodo,
+	Key:     func(model rest.Model) string { return model.(*Todo).Key },
+	Filter: func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, "done", "true")
+	},
+	Match: func(model rest.Model) bool { return model.(*Todo).Done },
+}
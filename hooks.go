@@ -0,0 +1,191 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+)
+
+// HookEvent identifies the point in a Service operation where a Hook runs.
+type HookEvent string
+
+// Hook events.
+const (
+	HookBeforeCreate = HookEvent("BeforeCreate")
+	HookAfterCreate  = HookEvent("AfterCreate")
+	HookBeforeUpdate = HookEvent("BeforeUpdate")
+	HookAfterUpdate  = HookEvent("AfterUpdate")
+	HookBeforeModify = HookEvent("BeforeModify")
+	HookAfterModify  = HookEvent("AfterModify")
+	HookBeforeRemove = HookEvent("BeforeRemove")
+	HookAfterRemove  = HookEvent("AfterRemove")
+)
+
+// BeforeCreator is implemented by Models which run code before being created.
+type BeforeCreator interface {
+	BeforeCreate(context.Context) error
+}
+
+// AfterCreator is implemented by Models which run code after being created.
+type AfterCreator interface {
+	AfterCreate(context.Context) error
+}
+
+// BeforeUpdater is implemented by Models which run code before replacing an
+// existing value.
+type BeforeUpdater interface {
+	BeforeUpdate(context.Context) error
+}
+
+// AfterUpdater is implemented by Models which run code after replacing an
+// existing value.
+type AfterUpdater interface {
+	AfterUpdate(context.Context) error
+}
+
+// BeforeModifier is implemented by Models which run code before being
+// modified.
+type BeforeModifier interface {
+	BeforeModify(context.Context) error
+}
+
+// AfterModifier is implemented by Models which run code after being modified.
+type AfterModifier interface {
+	AfterModify(context.Context) error
+}
+
+// BeforeRemover is implemented by Models which run code before being removed.
+type BeforeRemover interface {
+	BeforeRemove(context.Context) error
+}
+
+// AfterRemover is implemented by Models which run code after being removed.
+type AfterRemover interface {
+	AfterRemove(context.Context) error
+}
+
+// Hook runs code on a Model during a Service operation. A returned error
+// aborts the operation. Return a ServiceError to control the status code.
+// Services may run Hooks while holding their lock, as the DictService does,
+// so a Hook must not call back into the Service running it.
+type Hook func(context.Context, Model) error
+
+// Hooks is a set of Hooks registered by event.
+type Hooks struct {
+	hooks map[HookEvent][]Hook
+}
+
+// NewHooks creates a new Hooks object.
+func NewHooks() *Hooks {
+	return &Hooks{hooks: make(map[HookEvent][]Hook)}
+}
+
+// On registers a Hook for the given event. Hooks run in registration order.
+func (h *Hooks) On(event HookEvent, hook Hook) *Hooks {
+	h.hooks[event] = append(h.hooks[event], hook)
+	return h
+}
+
+// Run the Hooks registered for the given event, stopping at the first error.
+// Errors from hooks which are not ServiceErrors are mapped to a status code
+// of 400 for Before events and 500 for After events.
+func (h *Hooks) Run(ctx context.Context, event HookEvent, model Model) error {
+	if h == nil {
+		return nil
+	}
+	for _, hook := range h.hooks[event] {
+		if err := hook(ctx, model); err != nil {
+			return hookError(event, err)
+		}
+	}
+	return nil
+}
+
+type hooksKey struct{}
+
+// WithContextHooks injects Hooks into the given context, so that a
+// ServiceMiddleware can run code on the values an operation writes or removes.
+// They run after the Hooks registered with the Service, and Hooks injected
+// earlier run first.
+func WithContextHooks(ctx context.Context, hooks *Hooks) context.Context {
+	outer, _ := ctx.Value(hooksKey{}).([]*Hooks)
+	return context.WithValue(ctx, hooksKey{}, append(outer[:len(outer):len(outer)], hooks))
+}
+
+// withoutContextHooks drops the Hooks injected by WithContextHooks, for
+// operations a Service runs on other Services on behalf of the caller.
+func withoutContextHooks(ctx context.Context) context.Context {
+	return context.WithValue(ctx, hooksKey{}, []*Hooks(nil))
+}
+
+// runHooks runs the hook method of the Model for the event followed by the
+// Hooks registered for the event and the Hooks in the context.
+func runHooks(ctx context.Context, hooks *Hooks, event HookEvent, model Model) error {
+	if err := runModelHook(ctx, event, model); err != nil {
+		return hookError(event, err)
+	}
+	if err := hooks.Run(ctx, event, model); err != nil {
+		return err
+	}
+	return runContextHooks(ctx, event, model)
+}
+
+// runContextHooks runs the Hooks injected by WithContextHooks for the event.
+func runContextHooks(ctx context.Context, event HookEvent, model Model) error {
+	list, _ := ctx.Value(hooksKey{}).([]*Hooks)
+	for _, hooks := range list {
+		if err := hooks.Run(ctx, event, model); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runModelHook(ctx context.Context, event HookEvent, model Model) error {
+	switch event {
+	case HookBeforeCreate:
+		if m, ok := model.(BeforeCreator); ok {
+			return m.BeforeCreate(ctx)
+		}
+	case HookAfterCreate:
+		if m, ok := model.(AfterCreator); ok {
+			return m.AfterCreate(ctx)
+		}
+	case HookBeforeUpdate:
+		if m, ok := model.(BeforeUpdater); ok {
+			return m.BeforeUpdate(ctx)
+		}
+	case HookAfterUpdate:
+		if m, ok := model.(AfterUpdater); ok {
+			return m.AfterUpdate(ctx)
+		}
+	case HookBeforeModify:
+		if m, ok := model.(BeforeModifier); ok {
+			return m.BeforeModify(ctx)
+		}
+	case HookAfterModify:
+		if m, ok := model.(AfterModifier); ok {
+			return m.AfterModify(ctx)
+		}
+	case HookBeforeRemove:
+		if m, ok := model.(BeforeRemover); ok {
+			return m.BeforeRemove(ctx)
+		}
+	case HookAfterRemove:
+		if m, ok := model.(AfterRemover); ok {
+			return m.AfterRemove(ctx)
+		}
+	}
+	return nil
+}
+
+func hookError(event HookEvent, err error) error {
+	if _, ok := err.(ServiceError); ok {
+		return err
+	}
+	switch event {
+	case HookAfterCreate, HookAfterUpdate, HookAfterModify, HookAfterRemove:
+		return NewServiceError(err, http.StatusInternalServerError)
+	default:
+		return NewServiceError(err, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,179 @@
+package rest_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/ktnyt/go-rest/resttest"
+	"github.com/stretchr/testify/require"
+)
+
+type StampedTodo struct {
+	Todo
+	UpdatedAt time.Time
+}
+
+func (t *StampedTodo) BeforeCreate(ctx context.Context) error {
+	t.UpdatedAt = time.Now()
+	return nil
+}
+
+func NewStampedTodo() rest.Model {
+	return &StampedTodo{}
+}
+
+func ConvertStamped(value interface{}) rest.Model {
+	return value.(*StampedTodo)
+}
+
+func forbidDone(ctx context.Context, model rest.Model) error {
+	if model.(*Todo).Done {
+		err := errors.New("cannot remove done todos")
+		return rest.NewServiceError(err, http.StatusForbidden)
+	}
+	return nil
+}
+
+func normalize(ctx context.Context, model rest.Model) error {
+	todo := model.(*Todo)
+	todo.Content = strings.TrimSpace(todo.Content)
+	return nil
+}
+
+// memoryIOHandler is an IOHandler keeping a service as is.
+type memoryIOHandler struct {
+	service rest.Service
+}
+
+func (h memoryIOHandler) Save(rest.Service) error {
+	return nil
+}
+
+func (h memoryIOHandler) Load() (rest.Service, error) {
+	return h.service, nil
+}
+
+func create(t *testing.T, service rest.Service, todo *Todo) (rest.Model, error) {
+	t.Helper()
+	data, err := json.Marshal(todo)
+	require.NoError(t, err)
+	return service.Create(emptyContext, bytes.NewReader(data))
+}
+
+func TestHooks(t *testing.T) {
+	t.Run("runs model hooks", func(t *testing.T) {
+		service := rest.NewDictService(NewStampedTodo, Filter, ConvertStamped)
+
+		model, err := create(t, service, RandomTodo())
+		require.NoError(t, err)
+		require.False(t, model.(*StampedTodo).UpdatedAt.IsZero())
+	})
+
+	t.Run("runs service hooks", func(t *testing.T) {
+		hooks := rest.NewHooks().
+			On(rest.HookBeforeCreate, normalize).
+			On(rest.HookBeforeRemove, forbidDone)
+		service := rest.NewDictService(NewTodo, Filter, Convert, rest.WithHooks(hooks))
+
+		todo := RandomTodo()
+		content := todo.Content
+		todo.Content = "  " + content + "  "
+
+		model, err := create(t, service, todo)
+		require.NoError(t, err)
+		require.Equal(t, content, model.(*Todo).Content)
+
+		_, err = create(t, service, RandomTodo())
+		require.NoError(t, err)
+
+		_, err = service.Remove(emptyContext, "1")
+		require.Equal(t, http.StatusForbidden, err.(rest.ServiceError).Code)
+
+		_, err = service.Select(emptyContext, "1")
+		require.NoError(t, err)
+
+		_, err = service.Delete(emptyContext)
+		require.Error(t, err)
+
+		models, err := service.Browse(emptyContext)
+		require.NoError(t, err)
+		require.Len(t, models, 2)
+	})
+
+	t.Run("rolls back after hook errors", func(t *testing.T) {
+		hooks := rest.NewHooks().On(rest.HookAfterCreate, func(context.Context, rest.Model) error {
+			return errors.New("failed")
+		})
+		service := rest.NewDictService(NewTodo, Filter, Convert, rest.WithHooks(hooks))
+
+		_, err := create(t, service, RandomTodo())
+		require.Equal(t, http.StatusInternalServerError, err.(rest.ServiceError).Code)
+
+		models, err := service.Browse(emptyContext)
+		require.NoError(t, err)
+		require.Len(t, models, 0)
+	})
+
+	t.Run("runs IO service hooks", func(t *testing.T) {
+		hooks := rest.NewHooks().On(rest.HookBeforeRemove, forbidDone)
+		handler := NewBufferIOHandler(NewTodoDictService)
+		service := rest.NewIOServiceWithHooks(handler, hooks)
+
+		for i := 0; i < 2; i++ {
+			_, err := create(t, service, RandomTodo())
+			require.NoError(t, err)
+		}
+
+		_, err := service.Remove(emptyContext, "0")
+		require.NoError(t, err)
+
+		_, err = service.Remove(emptyContext, "1")
+		require.Error(t, err)
+
+		_, err = service.Select(emptyContext, "1")
+		require.NoError(t, err)
+	})
+
+	t.Run("runs IO service hooks before validation", func(t *testing.T) {
+		untitled := func(ctx context.Context, model rest.Model) error {
+			if todo := model.(*Todo); todo.Content == "" {
+				todo.Content = "untitled"
+			}
+			return nil
+		}
+		clear := func(ctx context.Context, model rest.Model) error {
+			model.(*Todo).Content = ""
+			return nil
+		}
+		hooks := rest.NewHooks().
+			On(rest.HookBeforeCreate, untitled).
+			On(rest.HookBeforeUpdate, clear)
+		handler := NewBufferIOHandler(NewTodoDictService)
+		service := rest.NewIOServiceWithHooks(handler, hooks)
+
+		model, err := create(t, service, InvalidTodo())
+		require.NoError(t, err)
+		require.Equal(t, "untitled", model.(*Todo).Content)
+
+		_, err = service.Update(emptyContext, "0", bytes.NewReader(mustMarshal(RandomTodo())))
+		resttest.RequireStatus(t, http.StatusBadRequest, err)
+
+		model, err = service.Select(emptyContext, "0")
+		require.NoError(t, err)
+		require.Equal(t, "untitled", model.(*Todo).Content)
+	})
+
+	t.Run("requires a DictService for IO service hooks", func(t *testing.T) {
+		hooks := rest.NewHooks().On(rest.HookBeforeCreate, normalize)
+		handler := memoryIOHandler{resttest.NewFakeService()}
+		_, err := create(t, rest.NewIOServiceWithHooks(handler, hooks), RandomTodo())
+		require.Error(t, err)
+	})
+}
@@ -25,3 +25,20 @@ type Interface interface {
 	// Modify part of an object identified by a primary key. (PATCH)
 	Modify(http.ResponseWriter, *http.Request)
 }
+
+// RestoreInterface defines an endpoint handler for soft deleted objects.
+type RestoreInterface interface {
+	// Restore a soft deleted object identified by a primary key. (POST)
+	Restore(http.ResponseWriter, *http.Request)
+}
+
+// RevisionInterface defines endpoint handlers for object revisions.
+type RevisionInterface interface {
+	// Revisions lists the revisions of an object identified by a primary key.
+	// (GET)
+	Revisions(http.ResponseWriter, *http.Request)
+
+	// Revert an object identified by a primary key to the revision given by
+	// the URL parameters. (POST)
+	Revert(http.ResponseWriter, *http.Request)
+}
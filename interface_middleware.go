@@ -0,0 +1,300 @@
+package rest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// Operation identifies an endpoint handler of an Interface.
+type Operation string
+
+// Interface operations.
+const (
+	OpBrowse    = Operation("Browse")
+	OpDelete    = Operation("Delete")
+	OpCreate    = Operation("Create")
+	OpSelect    = Operation("Select")
+	OpRemove    = Operation("Remove")
+	OpUpdate    = Operation("Update")
+	OpModify    = Operation("Modify")
+	OpRestore   = Operation("Restore")
+	OpRevisions = Operation("Revisions")
+	OpRevert    = Operation("Revert")
+	OpPurge     = Operation("Purge")
+)
+
+// InterfaceMiddleware decorates an Interface with additional behavior.
+type InterfaceMiddleware func(Interface) Interface
+
+// ChainInterface composes the given middlewares into a single
+// InterfaceMiddleware. The first middleware is the outermost.
+func ChainInterface(middlewares ...InterfaceMiddleware) InterfaceMiddleware {
+	return func(iface Interface) Interface {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			iface = middlewares[i](iface)
+		}
+		return iface
+	}
+}
+
+// HandlerMiddleware decorates the handler of an operation.
+type HandlerMiddleware func(Operation, http.HandlerFunc) http.HandlerFunc
+
+// WrapInterface applies the HandlerMiddleware to every handler of the
+// Interface, including the optional RestoreInterface and RevisionInterface
+// handlers.
+func WrapInterface(iface Interface, wrap HandlerMiddleware) Interface {
+	return wrappedInterface{iface: iface, wrap: wrap}
+}
+
+// InterfaceMiddlewareFunc creates an InterfaceMiddleware from a
+// HandlerMiddleware.
+func InterfaceMiddlewareFunc(wrap HandlerMiddleware) InterfaceMiddleware {
+	return func(iface Interface) Interface {
+		return WrapInterface(iface, wrap)
+	}
+}
+
+type wrappedInterface struct {
+	iface Interface
+	wrap  HandlerMiddleware
+}
+
+func (i wrappedInterface) Browse(w http.ResponseWriter, r *http.Request) {
+	i.wrap(OpBrowse, i.iface.Browse)(w, r)
+}
+
+func (i wrappedInterface) Delete(w http.ResponseWriter, r *http.Request) {
+	i.wrap(OpDelete, i.iface.Delete)(w, r)
+}
+
+func (i wrappedInterface) Create(w http.ResponseWriter, r *http.Request) {
+	i.wrap(OpCreate, i.iface.Create)(w, r)
+}
+
+func (i wrappedInterface) Select(w http.ResponseWriter, r *http.Request) {
+	i.wrap(OpSelect, i.iface.Select)(w, r)
+}
+
+func (i wrappedInterface) Remove(w http.ResponseWriter, r *http.Request) {
+	i.wrap(OpRemove, i.iface.Remove)(w, r)
+}
+
+func (i wrappedInterface) Update(w http.ResponseWriter, r *http.Request) {
+	i.wrap(OpUpdate, i.iface.Update)(w, r)
+}
+
+func (i wrappedInterface) Modify(w http.ResponseWriter, r *http.Request) {
+	i.wrap(OpModify, i.iface.Modify)(w, r)
+}
+
+func (i wrappedInterface) Restore(w http.ResponseWriter, r *http.Request) {
+	i.wrap(OpRestore, i.optional(func(w http.ResponseWriter, r *http.Request) bool {
+		if iface, ok := i.iface.(RestoreInterface); ok {
+			iface.Restore(w, r)
+			return true
+		}
+		return false
+	}))(w, r)
+}
+
+func (i wrappedInterface) Revisions(w http.ResponseWriter, r *http.Request) {
+	i.wrap(OpRevisions, i.optional(func(w http.ResponseWriter, r *http.Request) bool {
+		if iface, ok := i.iface.(RevisionInterface); ok {
+			iface.Revisions(w, r)
+			return true
+		}
+		return false
+	}))(w, r)
+}
+
+func (i wrappedInterface) Revert(w http.ResponseWriter, r *http.Request) {
+	i.wrap(OpRevert, i.optional(func(w http.ResponseWriter, r *http.Request) bool {
+		if iface, ok := i.iface.(RevisionInterface); ok {
+			iface.Revert(w, r)
+			return true
+		}
+		return false
+	}))(w, r)
+}
+
+// optional creates a handler calling an optional handler of the wrapped
+// Interface, responding with 501 if the wrapped Interface does not have it.
+func (i wrappedInterface) optional(call func(http.ResponseWriter, *http.Request) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !call(w, r) {
+			WriteProblem(w, NewProblem(http.StatusNotImplemented, "operation is not supported"))
+		}
+	}
+}
+
+// responseRecorder records the status code and size of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	if rec, ok := w.(*responseRecorder); ok {
+		return rec
+	}
+	return &responseRecorder{ResponseWriter: w}
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.size += n
+	return n, err
+}
+
+// Unwrap returns the underlying http.ResponseWriter.
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Recovery recovers from panics in the handlers and responds with a 500
+// Problem if no response has been written yet.
+func Recovery(logger *slog.Logger) InterfaceMiddleware {
+	return InterfaceMiddlewareFunc(func(op Operation, next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			rec := newResponseRecorder(w)
+
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+
+				if logger != nil {
+					logger.ErrorContext(r.Context(), "panic in handler",
+						slog.String("op", string(op)),
+						slog.String("request_id", RequestIDFromContext(r.Context())),
+						slog.Any("panic", v),
+						slog.String("stack", string(debug.Stack())),
+					)
+				}
+
+				if rec.status == 0 {
+					problem := NewProblem(http.StatusInternalServerError, fmt.Sprintf("%s panicked", op))
+					if id := RequestIDFromContext(r.Context()); id != "" {
+						problem = problem.With("requestId", id)
+					}
+					WriteProblem(rec, problem)
+				}
+			}()
+
+			next(rec, r)
+		}
+	})
+}
+
+// Logging logs an entry for every request with its operation, status code,
+// response size and duration.
+func Logging(logger *slog.Logger) InterfaceMiddleware {
+	return InterfaceMiddlewareFunc(func(op Operation, next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			rec := newResponseRecorder(w)
+			start := time.Now()
+
+			next(rec, r)
+
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			logger.LogAttrs(r.Context(), slog.LevelInfo, "request",
+				slog.String("op", string(op)),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.Int("size", rec.size),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("request_id", RequestIDFromContext(r.Context())),
+			)
+		}
+	})
+}
+
+// RequestIDHeader is the header carrying the request ID.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// WithRequestID injects the request ID into the given context.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext extracts the request ID from the given context.
+// Returns an empty string if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// MaxRequestIDLength is the maximum length of a request ID accepted from the
+// RequestIDHeader.
+const MaxRequestIDLength = 128
+
+// RequestID propagates the request ID given by the RequestIDHeader, or a
+// newly generated one, into the request context and the response header.
+// Request IDs longer than MaxRequestIDLength or containing characters other
+// than ASCII letters, digits, dots, dashes, underscores, colons and slashes
+// are replaced by a generated one, so that they are safe to log and echo.
+func RequestID() InterfaceMiddleware {
+	return InterfaceMiddlewareFunc(func(op Operation, next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+
+			w.Header().Set(RequestIDHeader, id)
+			next(w, r.WithContext(WithRequestID(r.Context(), id)))
+		}
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > MaxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '.' || c == '-' || c == '_' || c == ':' || c == '/':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	p := make([]byte, 16)
+	if _, err := rand.Read(p); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(p)
+}
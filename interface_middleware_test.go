@@ -0,0 +1,107 @@
+package rest_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterfaceMiddleware(t *testing.T) {
+	var requestID string
+	service := rest.ServiceFuncs{
+		Service: NewTodoDictService(),
+		BrowseFunc: func(ctx context.Context) ([]rest.Model, error) {
+			requestID = rest.RequestIDFromContext(ctx)
+			return nil, nil
+		},
+		DeleteFunc: func(ctx context.Context) ([]rest.Model, error) {
+			panic("boom")
+		},
+	}
+
+	buffer := new(bytes.Buffer)
+	logger := slog.New(slog.NewJSONHandler(buffer, nil))
+
+	iface := rest.ChainInterface(
+		rest.RequestID(),
+		rest.Logging(logger),
+		rest.Recovery(logger),
+	)(rest.NewServiceInterface(service))
+
+	t.Run("propagates request IDs", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(rest.RequestIDHeader, "foo")
+		iface.Browse(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "foo", w.Header().Get(rest.RequestIDHeader))
+		require.Equal(t, "foo", requestID)
+
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/", nil)
+		iface.Browse(w, r)
+
+		require.NotEmpty(t, w.Header().Get(rest.RequestIDHeader))
+		require.Equal(t, w.Header().Get(rest.RequestIDHeader), requestID)
+	})
+
+	t.Run("replaces invalid request IDs", func(t *testing.T) {
+		for _, id := range []string{"foo\x00bar", "foo bar", "<script>", strings.Repeat("a", rest.MaxRequestIDLength+1)} {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set(rest.RequestIDHeader, id)
+			iface.Browse(w, r)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			require.NotEqual(t, id, requestID)
+			require.NotEmpty(t, requestID)
+			require.Equal(t, requestID, w.Header().Get(rest.RequestIDHeader))
+		}
+	})
+
+	t.Run("logs requests", func(t *testing.T) {
+		buffer.Reset()
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(rest.RequestIDHeader, "bar")
+		iface.Browse(w, r)
+
+		entry := make(map[string]interface{})
+		require.NoError(t, json.Unmarshal(buffer.Bytes(), &entry))
+		require.Equal(t, "Browse", entry["op"])
+		require.Equal(t, float64(http.StatusOK), entry["status"])
+		require.Equal(t, "bar", entry["request_id"])
+	})
+
+	t.Run("recovers from panics", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodDelete, "/?all=true", nil)
+		iface.Delete(w, r)
+
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+		require.Equal(t, rest.ProblemContentType, w.Header().Get("Content-Type"))
+
+		var problem rest.Problem
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+		require.Equal(t, http.StatusInternalServerError, problem.Status)
+		require.Equal(t, w.Header().Get(rest.RequestIDHeader), problem.Extensions["requestId"])
+	})
+
+	t.Run("handles missing primary keys", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/0", nil)
+		iface.Select(w, r)
+
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
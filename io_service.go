@@ -3,6 +3,7 @@ package rest
 import (
 	"context"
 	"io"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -15,24 +16,75 @@ type IOHandler interface {
 
 type ioService struct {
 	handler IOHandler
+	hooks   *Hooks
 }
 
-// NewIOService returns a new IO service.
+// NewIOService returns a new IO service. It is a Snapshotter if the loaded
+// service is one, saving the service after an Import.
 func NewIOService(handler IOHandler) Service {
-	return ioService{handler: handler}
+	return NewIOServiceWithHooks(handler, nil)
 }
 
-func (s ioService) Browse(ctx context.Context) ([]Model, error) {
+// NewIOServiceWithHooks returns a new IO service running the given Hooks.
+// The hooks are given to the loaded service, which must be a *DictService,
+// so that they run in its usual order after any Hooks it has itself. A hook
+// error discards the change as the loaded service is not saved. The hooks
+// must not call back into the IO service, see WithHooks.
+func NewIOServiceWithHooks(handler IOHandler, hooks *Hooks) Service {
+	return ioService{handler: handler, hooks: hooks}
+}
+
+// load the service from the handler, giving it the Hooks.
+func (s ioService) load() (Service, error) {
 	service, err := s.handler.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.hooks != nil {
+		dict, ok := service.(*DictService)
+		if !ok {
+			return nil, errors.Errorf("hooks require a *DictService, got %T", service)
+		}
+		dict.outer = s.hooks
+	}
+
+	return service, nil
+}
+
+// save the service, which also persists the values expired while it was
+// loaded.
+func (s ioService) save(service Service) error {
+	if dict, ok := service.(*DictService); ok {
+		dict.takeUnsaved()
+	}
+	return s.handler.Save(service)
+}
+
+// saveExpired saves the service after a read if values expired while it was
+// loaded or read, so that they only expire once, and returns the error of the
+// read otherwise.
+func (s ioService) saveExpired(service Service, op string, err error) error {
+	if dict, ok := service.(*DictService); ok && dict.takeUnsaved() > 0 {
+		if err := s.handler.Save(service); err != nil {
+			return errors.Wrapf(err, "in IO Service %s", op)
+		}
+	}
+	return err
+}
+
+func (s ioService) Browse(ctx context.Context) ([]Model, error) {
+	service, err := s.load()
 	if err != nil {
 		return nil, errors.Wrap(err, "in IO Service Browse")
 	}
 
-	return service.Browse(ctx)
+	list, err := service.Browse(ctx)
+	return list, s.saveExpired(service, "Browse", err)
 }
 
 func (s ioService) Delete(ctx context.Context) ([]Model, error) {
-	service, err := s.handler.Load()
+	service, err := s.load()
 	if err != nil {
 		return nil, errors.Wrap(err, "in IO Service Delete")
 	}
@@ -42,90 +94,343 @@ func (s ioService) Delete(ctx context.Context) ([]Model, error) {
 		return nil, errors.Wrap(err, "in IO Service Delete")
 	}
 
-	if err := s.handler.Save(service); err != nil {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := s.save(service); err != nil {
 		return nil, errors.Wrap(err, "in IO Service Delete")
 	}
 
 	return list, nil
 }
 
-func (s ioService) Create(reader io.Reader) (Model, error) {
-	service, err := s.handler.Load()
+func (s ioService) Create(ctx context.Context, reader io.Reader) (Model, error) {
+	service, err := s.load()
 	if err != nil {
 		return nil, errors.Wrap(err, "in IO Service Create")
 	}
 
-	model, err := service.Create(reader)
+	model, err := service.Create(ctx, reader)
 	if err != nil {
 		return nil, errors.Wrap(err, "in IO Service Create")
 	}
 
-	if err := s.handler.Save(service); err != nil {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := s.save(service); err != nil {
 		return nil, errors.Wrap(err, "in IO Service Create")
 	}
 
 	return model, nil
 }
 
-func (s ioService) Select(key string) (Model, error) {
-	service, err := s.handler.Load()
+func (s ioService) Select(ctx context.Context, key string) (Model, error) {
+	service, err := s.load()
 	if err != nil {
 		return nil, errors.Wrap(err, "in IO Service Select")
 	}
 
-	return service.Select(key)
+	model, err := service.Select(ctx, key)
+	return model, s.saveExpired(service, "Select", err)
 }
 
-func (s ioService) Remove(key string) (Model, error) {
-	service, err := s.handler.Load()
+func (s ioService) SelectMany(ctx context.Context, keys []string) (map[string]Model, error) {
+	service, err := s.load()
+	if err != nil {
+		return nil, errors.Wrap(err, "in IO Service SelectMany")
+	}
+
+	values, err := SelectMany(ctx, service, keys)
+	return values, s.saveExpired(service, "SelectMany", err)
+}
+
+func (s ioService) Remove(ctx context.Context, key string) (Model, error) {
+	service, err := s.load()
 	if err != nil {
 		return nil, errors.Wrap(err, "in IO Service Remove")
 	}
 
-	model, err := service.Remove(key)
+	model, err := service.Remove(ctx, key)
 	if err != nil {
 		return nil, errors.Wrap(err, "in IO Service Remove")
 	}
 
-	if err := s.handler.Save(service); err != nil {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := s.save(service); err != nil {
 		return nil, errors.Wrap(err, "in IO Service Remove")
 	}
 
 	return model, nil
 }
 
-func (s ioService) Update(key string, reader io.Reader) (Model, error) {
-	service, err := s.handler.Load()
+func (s ioService) Update(ctx context.Context, key string, reader io.Reader) (Model, error) {
+	service, err := s.load()
 	if err != nil {
 		return nil, errors.Wrap(err, "in IO Service Update")
 	}
 
-	model, err := service.Update(key, reader)
+	model, err := service.Update(ctx, key, reader)
 	if err != nil {
 		return nil, errors.Wrap(err, "in IO Service Update")
 	}
 
-	if err := s.handler.Save(service); err != nil {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := s.save(service); err != nil {
 		return nil, errors.Wrap(err, "in IO Service Update")
 	}
 
 	return model, nil
 }
 
-func (s ioService) Modify(key string, reader io.Reader) (Model, error) {
-	service, err := s.handler.Load()
+func (s ioService) Modify(ctx context.Context, key string, reader io.Reader) (Model, error) {
+	service, err := s.load()
 	if err != nil {
 		return nil, errors.Wrap(err, "in IO Service Modify")
 	}
 
-	model, err := service.Modify(key, reader)
+	model, err := service.Modify(ctx, key, reader)
 	if err != nil {
 		return nil, errors.Wrap(err, "in IO Service Modify")
 	}
 
-	if err := s.handler.Save(service); err != nil {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := s.save(service); err != nil {
 		return nil, errors.Wrap(err, "in IO Service Modify")
 	}
 
 	return model, nil
 }
+
+func (s ioService) SelectWithDeleted(ctx context.Context, key string) (Model, error) {
+	service, err := s.load()
+	if err != nil {
+		return nil, errors.Wrap(err, "in IO Service SelectWithDeleted")
+	}
+
+	deleter, ok := service.(SoftDeleter)
+	if !ok {
+		return nil, errNotSoftDeleter
+	}
+
+	model, err := deleter.SelectWithDeleted(ctx, key)
+	return model, s.saveExpired(service, "SelectWithDeleted", err)
+}
+
+func (s ioService) Restore(ctx context.Context, key string) (Model, error) {
+	service, err := s.load()
+	if err != nil {
+		return nil, errors.Wrap(err, "in IO Service Restore")
+	}
+
+	deleter, ok := service.(SoftDeleter)
+	if !ok {
+		return nil, errNotSoftDeleter
+	}
+
+	model, err := deleter.Restore(ctx, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "in IO Service Restore")
+	}
+
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := s.save(service); err != nil {
+		return nil, errors.Wrap(err, "in IO Service Restore")
+	}
+
+	return model, nil
+}
+
+func (s ioService) Purge(ctx context.Context) ([]Model, error) {
+	service, err := s.load()
+	if err != nil {
+		return nil, errors.Wrap(err, "in IO Service Purge")
+	}
+
+	deleter, ok := service.(SoftDeleter)
+	if !ok {
+		return nil, errNotSoftDeleter
+	}
+
+	list, err := deleter.Purge(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "in IO Service Purge")
+	}
+
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := s.save(service); err != nil {
+		return nil, errors.Wrap(err, "in IO Service Purge")
+	}
+
+	return list, nil
+}
+
+func (s ioService) Revisions(ctx context.Context, key string) ([]Revision, error) {
+	service, err := s.load()
+	if err != nil {
+		return nil, errors.Wrap(err, "in IO Service Revisions")
+	}
+
+	reverter, ok := service.(Reverter)
+	if !ok {
+		return nil, errNotReverter
+	}
+
+	revisions, err := reverter.Revisions(ctx, key)
+	return revisions, s.saveExpired(service, "Revisions", err)
+}
+
+func (s ioService) SelectRevision(ctx context.Context, key string, number int) (Model, error) {
+	service, err := s.load()
+	if err != nil {
+		return nil, errors.Wrap(err, "in IO Service SelectRevision")
+	}
+
+	reverter, ok := service.(Reverter)
+	if !ok {
+		return nil, errNotReverter
+	}
+
+	model, err := reverter.SelectRevision(ctx, key, number)
+	return model, s.saveExpired(service, "SelectRevision", err)
+}
+
+func (s ioService) Revert(ctx context.Context, key string, number int) (Model, error) {
+	service, err := s.load()
+	if err != nil {
+		return nil, errors.Wrap(err, "in IO Service Revert")
+	}
+
+	reverter, ok := service.(Reverter)
+	if !ok {
+		return nil, errNotReverter
+	}
+
+	model, err := reverter.Revert(ctx, key, number)
+	if err != nil {
+		return nil, errors.Wrap(err, "in IO Service Revert")
+	}
+
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := s.save(service); err != nil {
+		return nil, errors.Wrap(err, "in IO Service Revert")
+	}
+
+	return model, nil
+}
+
+func (s ioService) CreateWithTTL(ctx context.Context, reader io.Reader, ttl time.Duration) (Model, error) {
+	service, err := s.load()
+	if err != nil {
+		return nil, errors.Wrap(err, "in IO Service CreateWithTTL")
+	}
+
+	expirer, ok := service.(Expirer)
+	if !ok {
+		return nil, errNotExpirer
+	}
+
+	model, err := expirer.CreateWithTTL(ctx, reader, ttl)
+	if err != nil {
+		return nil, errors.Wrap(err, "in IO Service CreateWithTTL")
+	}
+
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := s.save(service); err != nil {
+		return nil, errors.Wrap(err, "in IO Service CreateWithTTL")
+	}
+
+	return model, nil
+}
+
+func (s ioService) UpdateWithTTL(ctx context.Context, key string, reader io.Reader, ttl time.Duration) (Model, error) {
+	service, err := s.load()
+	if err != nil {
+		return nil, errors.Wrap(err, "in IO Service UpdateWithTTL")
+	}
+
+	expirer, ok := service.(Expirer)
+	if !ok {
+		return nil, errNotExpirer
+	}
+
+	model, err := expirer.UpdateWithTTL(ctx, key, reader, ttl)
+	if err != nil {
+		return nil, errors.Wrap(err, "in IO Service UpdateWithTTL")
+	}
+
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := s.save(service); err != nil {
+		return nil, errors.Wrap(err, "in IO Service UpdateWithTTL")
+	}
+
+	return model, nil
+}
+
+func (s ioService) Snapshot(ctx context.Context) (Snapshot, error) {
+	service, err := s.load()
+	if err != nil {
+		return Snapshot{}, errors.Wrap(err, "in IO Service Snapshot")
+	}
+
+	snapshotter, ok := service.(Snapshotter)
+	if !ok {
+		return Snapshot{}, errNotSnapshotter
+	}
+
+	snapshot, err := snapshotter.Snapshot(ctx)
+	return snapshot, s.saveExpired(service, "Snapshot", err)
+}
+
+func (s ioService) Import(ctx context.Context, r io.Reader, format SnapshotFormat, mode ImportMode) (ImportResult, error) {
+	service, err := s.load()
+	if err != nil {
+		return ImportResult{}, errors.Wrap(err, "in IO Service Import")
+	}
+
+	snapshotter, ok := service.(Snapshotter)
+	if !ok {
+		return ImportResult{}, errNotSnapshotter
+	}
+
+	result, err := snapshotter.Import(ctx, r, format, mode)
+	if err != nil {
+		return ImportResult{}, errors.Wrap(err, "in IO Service Import")
+	}
+
+	if err := CheckContext(ctx); err != nil {
+		return ImportResult{}, err
+	}
+
+	if err := s.save(service); err != nil {
+		return ImportResult{}, errors.Wrap(err, "in IO Service Import")
+	}
+
+	return result, nil
+}
@@ -6,8 +6,10 @@ import (
 	"encoding/json"
 	"log"
 	"testing"
+	"time"
 
 	rest "github.com/ktnyt/go-rest"
+	"github.com/ktnyt/go-rest/resttest"
 	"github.com/stretchr/testify/require"
 )
 
@@ -45,6 +47,12 @@ func (h *BufferIOHandler) Load() (rest.Service, error) {
 	return service, nil
 }
 
+func TestIOServiceConformance(t *testing.T) {
+	resttest.RunServiceConformance(t, func() rest.Service {
+		return rest.NewIOService(NewBufferIOHandler(NewTodoDictService))
+	}, TodoFixtures)
+}
+
 func TestIOService(t *testing.T) {
 	handler := NewBufferIOHandler(NewTodoDictService)
 	service := rest.NewIOService(handler)
@@ -60,7 +68,7 @@ func TestIOService(t *testing.T) {
 			data, err := json.Marshal(&todo)
 			require.NoError(t, err)
 
-			_, err = service.Create(bytes.NewReader(data))
+			_, err = service.Create(emptyContext, bytes.NewReader(data))
 			require.NoError(t, err)
 		}
 	})
@@ -99,13 +107,13 @@ func TestIOService(t *testing.T) {
 	t.Run("can select data", func(t *testing.T) {
 		t.Run("for existing keys", func(t *testing.T) {
 			for _, key := range keys {
-				_, err := service.Select(key)
+				_, err := service.Select(emptyContext, key)
 				require.NoError(t, err)
 			}
 		})
 
 		t.Run("for existing keys only", func(t *testing.T) {
-			_, err := service.Select("foo")
+			_, err := service.Select(emptyContext, "foo")
 			require.Error(t, err)
 		})
 	})
@@ -118,7 +126,7 @@ func TestIOService(t *testing.T) {
 				data, err := json.Marshal(&todo)
 				require.NoError(t, err)
 
-				_, err = service.Update(key, bytes.NewReader(data))
+				_, err = service.Update(emptyContext, key, bytes.NewReader(data))
 				require.NoError(t, err)
 			}
 		})
@@ -129,7 +137,7 @@ func TestIOService(t *testing.T) {
 			data, err := json.Marshal(&todo)
 			require.NoError(t, err)
 
-			_, err = service.Update("foo", bytes.NewReader(data))
+			_, err = service.Update(emptyContext, "foo", bytes.NewReader(data))
 			require.Error(t, err)
 		})
 
@@ -140,13 +148,13 @@ func TestIOService(t *testing.T) {
 				data, err := json.Marshal(&todo)
 				require.NoError(t, err)
 
-				before, err := service.Select(key)
+				before, err := service.Select(emptyContext, key)
 				require.NoError(t, err)
 
-				_, err = service.Update(key, bytes.NewReader(data))
+				_, err = service.Update(emptyContext, key, bytes.NewReader(data))
 				require.Error(t, err)
 
-				after, err := service.Select(key)
+				after, err := service.Select(emptyContext, key)
 				require.NoError(t, err)
 				require.Equal(t, before, after)
 			}
@@ -161,7 +169,7 @@ func TestIOService(t *testing.T) {
 				data, err := json.Marshal(&todo)
 				require.NoError(t, err)
 
-				_, err = service.Modify(key, bytes.NewReader(data))
+				_, err = service.Modify(emptyContext, key, bytes.NewReader(data))
 				require.NoError(t, err)
 			}
 		})
@@ -172,7 +180,7 @@ func TestIOService(t *testing.T) {
 			data, err := json.Marshal(&todo)
 			require.NoError(t, err)
 
-			_, err = service.Modify("foo", bytes.NewReader(data))
+			_, err = service.Modify(emptyContext, "foo", bytes.NewReader(data))
 			require.Error(t, err)
 		})
 
@@ -183,13 +191,13 @@ func TestIOService(t *testing.T) {
 				data, err := json.Marshal(&todo)
 				require.NoError(t, err)
 
-				before, err := service.Select(key)
+				before, err := service.Select(emptyContext, key)
 				require.NoError(t, err)
 
-				_, err = service.Modify(key, bytes.NewReader(data))
+				_, err = service.Modify(emptyContext, key, bytes.NewReader(data))
 				require.Error(t, err)
 
-				after, err := service.Select(key)
+				after, err := service.Select(emptyContext, key)
 				require.NoError(t, err)
 				require.Equal(t, before, after)
 			}
@@ -199,7 +207,7 @@ func TestIOService(t *testing.T) {
 	t.Run("can remove data", func(t *testing.T) {
 		t.Run("for existing keys", func(t *testing.T) {
 			for _, key := range trueKeys {
-				_, err := service.Remove(key)
+				_, err := service.Remove(emptyContext, key)
 				require.NoError(t, err)
 			}
 
@@ -209,7 +217,7 @@ func TestIOService(t *testing.T) {
 		})
 
 		t.Run("for existing keys only", func(t *testing.T) {
-			_, err := service.Remove("foo")
+			_, err := service.Remove(emptyContext, "foo")
 			require.Error(t, err)
 
 			models, err := service.Browse(emptyContext)
@@ -234,7 +242,7 @@ func TestIOService(t *testing.T) {
 				data, err := json.Marshal(&todo)
 				require.NoError(t, err)
 
-				_, err = service.Create(bytes.NewReader(data))
+				_, err = service.Create(emptyContext, bytes.NewReader(data))
 				require.NoError(t, err)
 			}
 
@@ -249,3 +257,31 @@ func TestIOService(t *testing.T) {
 		})
 	})
 }
+
+func TestIOServiceExpiry(t *testing.T) {
+	var expired []string
+	handler := NewBufferIOHandler(func() rest.Service {
+		return rest.NewDictService(NewTodo, Filter, Convert, rest.WithExpiryHandler(func(e rest.Expired) {
+			expired = append(expired, e.Key)
+		}))
+	})
+	service := rest.NewIOService(handler)
+
+	_, err := service.(rest.Expirer).CreateWithTTL(emptyContext, bytes.NewReader(mustMarshal(RandomTodo())), time.Millisecond)
+	require.NoError(t, err)
+
+	time.Sleep(2 * time.Millisecond)
+
+	t.Run("saves values expired on read", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			models, err := service.Browse(emptyContext)
+			require.NoError(t, err)
+			require.Empty(t, models)
+
+			_, err = service.Select(emptyContext, "0")
+			require.Error(t, err)
+		}
+
+		require.Equal(t, []string{"0"}, expired)
+	})
+}
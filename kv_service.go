@@ -0,0 +1,480 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// AfterParam is the URL parameter for browsing the values with keys after the
+// given key in key order, e.g. to fetch the next page of values.
+const AfterParam = "after"
+
+// KVStore is an embedded, ordered key-value store with transactions, such as
+// a bbolt database.
+type KVStore interface {
+	// View runs the function in a read-only transaction.
+	View(func(KVTx) error) error
+
+	// Update runs the function in a read-write transaction, which is
+	// committed if the function returns nil and rolled back otherwise.
+	Update(func(KVTx) error) error
+}
+
+// KVTx is a transaction of a KVStore. Slices passed to and returned from a
+// KVTx are only valid until the transaction ends.
+type KVTx interface {
+	// Get the value for the key, or nil if the key does not exist.
+	Get(key []byte) []byte
+
+	// Put the value for the key.
+	Put(key, value []byte) error
+
+	// Delete the key.
+	Delete(key []byte) error
+
+	// Scan the keys with the prefix in ascending order starting at the first
+	// key not less than start, until the function returns false.
+	Scan(prefix, start []byte, f func(key, value []byte) bool) error
+}
+
+// KVService provides a Service for models stored as JSON in a KVStore. Each
+// value is stored under the name of the service and its key, so that several
+// KVServices can share a KVStore. Browse and Delete scan the values in key
+// order and filter them with the FilterFactory, starting after the key in the
+// AfterParam and stopping at the number of values in the LimitParam if they
+// are set.
+type KVService struct {
+	store   KVStore
+	prefix  []byte
+	counter []byte
+
+	build   ModelBuilder
+	factory FilterFactory
+
+	hooks    *Hooks
+	decoding DecodeOptions
+
+	filterParams []string
+}
+
+// KVServiceOption configures optional behavior of a KVService.
+type KVServiceOption func(*KVService)
+
+// WithKVHooks registers Hooks to run around the KVService operations, after
+// the hook methods implemented by the Model itself. An error from an After
+// hook rolls back the transaction of the operation.
+func WithKVHooks(hooks *Hooks) KVServiceOption {
+	return func(s *KVService) {
+		s.hooks = hooks
+	}
+}
+
+// WithKVDecoding sets the options for decoding request bodies.
+func WithKVDecoding(decoding DecodeOptions) KVServiceOption {
+	return func(s *KVService) {
+		s.decoding = decoding
+	}
+}
+
+// WithKVFilterParams declares the URL parameters the FilterFactory of the
+// KVService filters values by. GuardDelete only accepts these as filters,
+// so without them every Delete through an Interface needs the AllParam.
+func WithKVFilterParams(names ...string) KVServiceOption {
+	return func(s *KVService) {
+		s.filterParams = append([]string{}, names...)
+	}
+}
+
+// NewKVService returns a new KV service storing its values under the given
+// name in the KVStore.
+func NewKVService(store KVStore, name string, build ModelBuilder, factory FilterFactory, opts ...KVServiceOption) Service {
+	s := &KVService{
+		store:   store,
+		prefix:  append([]byte(name), 0),
+		counter: append([]byte(name), 1),
+		build:   build,
+		factory: factory,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// FilterParams returns the URL parameters declared by WithKVFilterParams.
+func (s *KVService) FilterParams() []string {
+	return s.filterParams
+}
+
+// Browse the values filtered by URL parameters.
+func (s *KVService) Browse(ctx context.Context) ([]Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	var list []Model
+	err := s.store.View(func(tx KVTx) error {
+		var err error
+		_, list, err = s.scan(ctx, tx)
+		return err
+	})
+	if err != nil {
+		return nil, s.fail("Browse", err)
+	}
+	return list, nil
+}
+
+// Delete the values filtered by URL parameters.
+func (s *KVService) Delete(ctx context.Context) ([]Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	var list []Model
+	err := s.store.Update(func(tx KVTx) error {
+		keys, models, err := s.scan(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		for _, model := range models {
+			if err := runHooks(ctx, s.hooks, HookBeforeRemove, model); err != nil {
+				return err
+			}
+		}
+
+		for _, key := range keys {
+			if err := tx.Delete(s.key(key)); err != nil {
+				return err
+			}
+		}
+
+		for _, model := range models {
+			if err := runHooks(ctx, s.hooks, HookAfterRemove, model); err != nil {
+				return err
+			}
+		}
+
+		list = models
+		return nil
+	})
+	if err != nil {
+		return nil, s.fail("Delete", err)
+	}
+	return list, nil
+}
+
+// Create and store a new value.
+func (s *KVService) Create(ctx context.Context, reader io.Reader) (Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	model := s.build()
+	if err := s.decoding.Decode(reader, &model); err != nil {
+		return nil, err
+	}
+
+	err := s.store.Update(func(tx KVTx) error {
+		count, err := s.count(tx)
+		if err != nil {
+			return err
+		}
+
+		key := model.MakeKey(count)
+		if err := runHooks(ctx, s.hooks, HookBeforeCreate, model); err != nil {
+			return err
+		}
+
+		if err := model.Validate(); err != nil {
+			return NewServiceError(err, http.StatusBadRequest)
+		}
+
+		if tx.Get(s.key(key)) != nil {
+			err := NewKeyError(key, false)
+			return NewServiceError(err, http.StatusBadRequest)
+		}
+
+		if err := s.put(tx, key, model); err != nil {
+			return err
+		}
+
+		if err := tx.Put(s.counter, []byte(strconv.Itoa(count+1))); err != nil {
+			return err
+		}
+
+		return runHooks(ctx, s.hooks, HookAfterCreate, model)
+	})
+	if err != nil {
+		return nil, s.fail("Create", err)
+	}
+	return model, nil
+}
+
+// Select a value identified by the given key.
+func (s *KVService) Select(ctx context.Context, key string) (Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	var model Model
+	err := s.store.View(func(tx KVTx) error {
+		var err error
+		model, err = s.get(tx, key)
+		return err
+	})
+	if err != nil {
+		return nil, s.fail("Select", err)
+	}
+	return model, nil
+}
+
+// SelectMany selects the values identified by the given keys at once. Missing
+// keys are left out of the result.
+func (s *KVService) SelectMany(ctx context.Context, keys []string) (map[string]Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]Model, len(keys))
+	err := s.store.View(func(tx KVTx) error {
+		for _, key := range keys {
+			data := tx.Get(s.key(key))
+			if data == nil {
+				continue
+			}
+			model, err := s.decode(data)
+			if err != nil {
+				return err
+			}
+			values[key] = model
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, s.fail("SelectMany", err)
+	}
+	return values, nil
+}
+
+// Remove a value identified by the given key.
+func (s *KVService) Remove(ctx context.Context, key string) (Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	var model Model
+	err := s.store.Update(func(tx KVTx) error {
+		var err error
+		if model, err = s.get(tx, key); err != nil {
+			return err
+		}
+
+		if err := runHooks(ctx, s.hooks, HookBeforeRemove, model); err != nil {
+			return err
+		}
+
+		if err := tx.Delete(s.key(key)); err != nil {
+			return err
+		}
+
+		return runHooks(ctx, s.hooks, HookAfterRemove, model)
+	})
+	if err != nil {
+		return nil, s.fail("Remove", err)
+	}
+	return model, nil
+}
+
+// Update an entire value identified by the given key.
+func (s *KVService) Update(ctx context.Context, key string, reader io.Reader) (Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	value := s.build()
+	if err := s.decoding.Decode(reader, &value); err != nil {
+		return nil, err
+	}
+
+	if err := runHooks(ctx, s.hooks, HookBeforeUpdate, value); err != nil {
+		return nil, err
+	}
+
+	if err := value.Validate(); err != nil {
+		return nil, NewServiceError(err, http.StatusBadRequest)
+	}
+
+	err := s.store.Update(func(tx KVTx) error {
+		if tx.Get(s.key(key)) == nil {
+			err := NewKeyError(key, true)
+			return NewServiceError(err, http.StatusBadRequest)
+		}
+
+		if err := s.put(tx, key, value); err != nil {
+			return err
+		}
+
+		return runHooks(ctx, s.hooks, HookAfterUpdate, value)
+	})
+	if err != nil {
+		return nil, s.fail("Update", err)
+	}
+	return value, nil
+}
+
+// Modify part of a value identified by the given key.
+func (s *KVService) Modify(ctx context.Context, key string, reader io.Reader) (Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	model := s.build()
+	if err := s.decoding.Decode(reader, &model); err != nil {
+		return nil, err
+	}
+
+	var value Model
+	err := s.store.Update(func(tx KVTx) error {
+		var err error
+		if value, err = s.get(tx, key); err != nil {
+			return err
+		}
+
+		if err := value.Merge(model); err != nil {
+			return NewServiceError(err, http.StatusBadRequest)
+		}
+
+		if err := runHooks(ctx, s.hooks, HookBeforeModify, value); err != nil {
+			return err
+		}
+
+		if err := value.Validate(); err != nil {
+			return NewServiceError(err, http.StatusBadRequest)
+		}
+
+		if err := s.put(tx, key, value); err != nil {
+			return err
+		}
+
+		return runHooks(ctx, s.hooks, HookAfterModify, value)
+	})
+	if err != nil {
+		return nil, s.fail("Modify", err)
+	}
+	return value, nil
+}
+
+// key returns the store key for the value identified by the given key.
+func (s *KVService) key(key string) []byte {
+	return append(append([]byte(nil), s.prefix...), key...)
+}
+
+// count returns the number of values ever created.
+func (s *KVService) count(tx KVTx) (int, error) {
+	data := tx.Get(s.counter)
+	if data == nil {
+		return 0, nil
+	}
+	return strconv.Atoi(string(data))
+}
+
+// scan the values matching the URL parameters in key order, returning their
+// keys and values.
+func (s *KVService) scan(ctx context.Context, tx KVTx) ([]string, []Model, error) {
+	params := ExtractParams(ctx)
+
+	limit := -1
+	if value := params.Get(LimitParam); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			err := errors.Errorf("parameter '%s' must be a non-negative integer", LimitParam)
+			return nil, nil, NewServiceError(err, http.StatusBadRequest)
+		}
+		limit = n
+	}
+
+	start := s.prefix
+	after, hasAfter := params[AfterParam]
+	if hasAfter {
+		start = s.key(after[0])
+	}
+
+	filter := s.factory(ctx)
+	keys := make([]string, 0)
+	list := make([]Model, 0)
+
+	var err error
+	scanErr := tx.Scan(s.prefix, start, func(key, value []byte) bool {
+		if limit >= 0 && len(list) >= limit {
+			return false
+		}
+		if hasAfter && bytes.Equal(key, start) {
+			return true
+		}
+		if err = CheckContext(ctx); err != nil {
+			return false
+		}
+
+		var model Model
+		if model, err = s.decode(value); err != nil {
+			return false
+		}
+
+		if filter(model) {
+			keys = append(keys, string(key[len(s.prefix):]))
+			list = append(list, model)
+		}
+		return true
+	})
+	if scanErr != nil {
+		return nil, nil, scanErr
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return keys, list, nil
+}
+
+// get the value identified by the given key.
+func (s *KVService) get(tx KVTx, key string) (Model, error) {
+	data := tx.Get(s.key(key))
+	if data == nil {
+		err := NewKeyError(key, true)
+		return nil, NewServiceError(err, http.StatusBadRequest)
+	}
+	return s.decode(data)
+}
+
+// put the value for the given key.
+func (s *KVService) put(tx KVTx, key string, model Model) error {
+	data, err := json.Marshal(model)
+	if err != nil {
+		return err
+	}
+	return tx.Put(s.key(key), data)
+}
+
+// decode a stored value.
+func (s *KVService) decode(data []byte) (Model, error) {
+	model := s.build()
+	if err := json.Unmarshal(data, &model); err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+// fail wraps an error from the KVStore.
+func (s *KVService) fail(op string, err error) error {
+	if _, ok := err.(ServiceError); ok {
+		return err
+	}
+	return errors.Wrapf(err, "in KVService %s", op)
+}
@@ -0,0 +1,124 @@
+package rest_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/ktnyt/go-rest/boltkv"
+	"github.com/ktnyt/go-rest/resttest"
+	"github.com/stretchr/testify/require"
+)
+
+func OpenTodoStore(t *testing.T, path string) *boltkv.Store {
+	store, err := boltkv.Open(path, 0600, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func NewTodoKVService(t *testing.T) rest.Service {
+	store := OpenTodoStore(t, filepath.Join(t.TempDir(), "todo.db"))
+	return rest.NewKVService(store, "todo", NewTodo, Filter)
+}
+
+func TestKVServiceConformance(t *testing.T) {
+	fixtures := TodoFixtures
+	fixtures.Concurrency = 20
+	resttest.RunServiceConformance(t, func() rest.Service {
+		return NewTodoKVService(t)
+	}, fixtures)
+}
+
+func TestKVService(t *testing.T) {
+	populate := func(t *testing.T, service rest.Service, n int) {
+		for i := 0; i < n; i++ {
+			_, err := service.Create(emptyContext, bytes.NewReader(mustMarshal(RandomTodo())))
+			require.NoError(t, err)
+		}
+	}
+
+	todoKeys := func(models []rest.Model) []string {
+		keys := make([]string, len(models))
+		for i, model := range models {
+			keys[i] = model.(*Todo).Key
+		}
+		return keys
+	}
+
+	t.Run("browses with cursors", func(t *testing.T) {
+		service := NewTodoKVService(t)
+		populate(t, service, 5)
+
+		models, err := service.Browse(emptyContext)
+		require.NoError(t, err)
+		require.Equal(t, []string{"0", "1", "2", "3", "4"}, todoKeys(models))
+
+		ctx := rest.InjectParams(emptyContext, url.Values{rest.AfterParam: {"1"}, rest.LimitParam: {"2"}})
+		models, err = service.Browse(ctx)
+		require.NoError(t, err)
+		require.Equal(t, []string{"2", "3"}, todoKeys(models))
+
+		ctx = rest.InjectParams(trueContext, url.Values{rest.AfterParam: {"1"}})
+		models, err = service.Browse(ctx)
+		require.NoError(t, err)
+		require.Equal(t, []string{"3"}, todoKeys(models))
+
+		ctx = rest.InjectParams(emptyContext, url.Values{rest.LimitParam: {"all"}})
+		_, err = service.Browse(ctx)
+		resttest.RequireStatus(t, http.StatusBadRequest, err)
+	})
+
+	t.Run("shares stores and persists values", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "todo.db")
+		store := OpenTodoStore(t, path)
+		todos := rest.NewKVService(store, "todo", NewTodo, Filter)
+		others := rest.NewKVService(store, "todo2", NewTodo, Filter)
+		populate(t, todos, 3)
+		populate(t, others, 1)
+
+		_, err := todos.Remove(emptyContext, "2")
+		require.NoError(t, err)
+		require.NoError(t, store.Close())
+
+		store = OpenTodoStore(t, path)
+		todos = rest.NewKVService(store, "todo", NewTodo, Filter)
+		populate(t, todos, 1)
+
+		models, err := todos.Browse(emptyContext)
+		require.NoError(t, err)
+		require.Equal(t, []string{"0", "1", "3"}, todoKeys(models))
+
+		models, err = rest.NewKVService(store, "todo2", NewTodo, Filter).Browse(emptyContext)
+		require.NoError(t, err)
+		require.Len(t, models, 1)
+	})
+
+	t.Run("rolls back failed hooks", func(t *testing.T) {
+		hooks := rest.NewHooks().On(rest.HookAfterRemove, func(ctx context.Context, model rest.Model) error {
+			if model.(*Todo).Done {
+				return rest.NewServiceError(fmt.Errorf("todo is in use"), http.StatusConflict)
+			}
+			return nil
+		})
+		store := OpenTodoStore(t, filepath.Join(t.TempDir(), "todo.db"))
+		service := rest.NewKVService(store, "todo", NewTodo, Filter, rest.WithKVHooks(hooks))
+		populate(t, service, 4)
+
+		_, err := service.Delete(emptyContext)
+		resttest.RequireStatus(t, http.StatusConflict, err)
+
+		models, err := service.Delete(falseContext)
+		require.NoError(t, err)
+		require.Equal(t, []string{"0", "2"}, todoKeys(models))
+
+		models, err = service.Browse(emptyContext)
+		require.NoError(t, err)
+		require.Equal(t, []string{"1", "3"}, todoKeys(models))
+	})
+}
@@ -0,0 +1,78 @@
+package rest
+
+import (
+	"context"
+	"io"
+)
+
+// LegacyService is the Service interface from before every method took a
+// context. Only Browse and Delete receive the request context.
+type LegacyService interface {
+	Browse(context.Context) ([]Model, error)
+	Delete(context.Context) ([]Model, error)
+	Create(io.Reader) (Model, error)
+	Select(string) (Model, error)
+	Remove(string) (Model, error)
+	Update(string, io.Reader) (Model, error)
+	Modify(string, io.Reader) (Model, error)
+}
+
+type legacyService struct {
+	service LegacyService
+}
+
+// AdaptLegacyService creates a Service from a LegacyService. The context is
+// checked before calling the LegacyService, so a request canceled before it
+// reaches the backend is not executed.
+func AdaptLegacyService(service LegacyService) Service {
+	return legacyService{service: service}
+}
+
+func (s legacyService) Browse(ctx context.Context) ([]Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+	return s.service.Browse(ctx)
+}
+
+func (s legacyService) Delete(ctx context.Context) ([]Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+	return s.service.Delete(ctx)
+}
+
+func (s legacyService) Create(ctx context.Context, reader io.Reader) (Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+	return s.service.Create(reader)
+}
+
+func (s legacyService) Select(ctx context.Context, key string) (Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+	return s.service.Select(key)
+}
+
+func (s legacyService) Remove(ctx context.Context, key string) (Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+	return s.service.Remove(key)
+}
+
+func (s legacyService) Update(ctx context.Context, key string, reader io.Reader) (Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+	return s.service.Update(key, reader)
+}
+
+func (s legacyService) Modify(ctx context.Context, key string, reader io.Reader) (Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+	return s.service.Modify(key, reader)
+}
@@ -0,0 +1,73 @@
+package rest_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/stretchr/testify/require"
+)
+
+type LegacyTodoService struct {
+	service rest.Service
+}
+
+func (s LegacyTodoService) Browse(ctx context.Context) ([]rest.Model, error) {
+	return s.service.Browse(ctx)
+}
+
+func (s LegacyTodoService) Delete(ctx context.Context) ([]rest.Model, error) {
+	return s.service.Delete(ctx)
+}
+
+func (s LegacyTodoService) Create(reader io.Reader) (rest.Model, error) {
+	return s.service.Create(emptyContext, reader)
+}
+
+func (s LegacyTodoService) Select(key string) (rest.Model, error) {
+	return s.service.Select(emptyContext, key)
+}
+
+func (s LegacyTodoService) Remove(key string) (rest.Model, error) {
+	return s.service.Remove(emptyContext, key)
+}
+
+func (s LegacyTodoService) Update(key string, reader io.Reader) (rest.Model, error) {
+	return s.service.Update(emptyContext, key, reader)
+}
+
+func (s LegacyTodoService) Modify(key string, reader io.Reader) (rest.Model, error) {
+	return s.service.Modify(emptyContext, key, reader)
+}
+
+func TestLegacyService(t *testing.T) {
+	service := rest.AdaptLegacyService(LegacyTodoService{NewTodoDictService()})
+
+	t.Run("adapts a legacy service", func(t *testing.T) {
+		model, err := create(t, service, RandomTodo())
+		require.NoError(t, err)
+
+		selected, err := service.Select(emptyContext, model.(*Todo).Key)
+		require.NoError(t, err)
+		require.Equal(t, model, selected)
+	})
+
+	t.Run("honors canceled contexts", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(emptyContext)
+		cancel()
+
+		_, err := service.Select(ctx, "0")
+		require.Equal(t, rest.StatusClientClosedRequest, err.(rest.ServiceError).Code)
+
+		_, err = NewTodoDictService().Browse(ctx)
+		require.Equal(t, rest.StatusClientClosedRequest, err.(rest.ServiceError).Code)
+
+		ctx, cancel = context.WithTimeout(emptyContext, 0)
+		defer cancel()
+
+		_, err = NewTodoDictService().Browse(ctx)
+		require.Equal(t, http.StatusGatewayTimeout, err.(rest.ServiceError).Code)
+	})
+}
@@ -0,0 +1,217 @@
+package rest
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// ServiceMiddleware decorates a Service with additional behavior.
+type ServiceMiddleware func(Service) Service
+
+// Chain composes the given middlewares into a single ServiceMiddleware. The
+// first middleware is the outermost, i.e. it sees each call first.
+func Chain(middlewares ...ServiceMiddleware) ServiceMiddleware {
+	return func(service Service) Service {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			service = middlewares[i](service)
+		}
+		return service
+	}
+}
+
+// ServiceFuncs is a Service which calls the function set for each method and
+// falls back to the wrapped Service otherwise, so that a decorator only needs
+// to override the methods it cares about.
+//
+// Restore, Revert, CreateWithTTL and UpdateWithTTL write values like Remove,
+// Update, Create and Update respectively, and SelectWithDeleted, Revisions
+// and SelectRevision read values like Select. If the function of such a
+// method is not set but the function of its counterpart is, the method
+// responds with a 501 rather than bypass the decorator. SelectMany selects
+// each key with SelectFunc if it is set. Purge is always forwarded to the
+// wrapped Service unless PurgeFunc is set.
+type ServiceFuncs struct {
+	Service Service
+
+	BrowseFunc func(context.Context) ([]Model, error)
+	DeleteFunc func(context.Context) ([]Model, error)
+	CreateFunc func(context.Context, io.Reader) (Model, error)
+	SelectFunc func(context.Context, string) (Model, error)
+	RemoveFunc func(context.Context, string) (Model, error)
+	UpdateFunc func(context.Context, string, io.Reader) (Model, error)
+	ModifyFunc func(context.Context, string, io.Reader) (Model, error)
+
+	SelectWithDeletedFunc func(context.Context, string) (Model, error)
+	RestoreFunc           func(context.Context, string) (Model, error)
+	PurgeFunc             func(context.Context) ([]Model, error)
+	RevisionsFunc         func(context.Context, string) ([]Revision, error)
+	SelectRevisionFunc    func(context.Context, string, int) (Model, error)
+	RevertFunc            func(context.Context, string, int) (Model, error)
+	CreateWithTTLFunc     func(context.Context, io.Reader, time.Duration) (Model, error)
+	UpdateWithTTLFunc     func(context.Context, string, io.Reader, time.Duration) (Model, error)
+	SelectManyFunc        func(context.Context, []string) (map[string]Model, error)
+}
+
+// Browse calls BrowseFunc or the wrapped Service.
+func (s ServiceFuncs) Browse(ctx context.Context) ([]Model, error) {
+	if s.BrowseFunc != nil {
+		return s.BrowseFunc(ctx)
+	}
+	return s.Service.Browse(ctx)
+}
+
+// Delete calls DeleteFunc or the wrapped Service.
+func (s ServiceFuncs) Delete(ctx context.Context) ([]Model, error) {
+	if s.DeleteFunc != nil {
+		return s.DeleteFunc(ctx)
+	}
+	return s.Service.Delete(ctx)
+}
+
+// Create calls CreateFunc or the wrapped Service.
+func (s ServiceFuncs) Create(ctx context.Context, reader io.Reader) (Model, error) {
+	if s.CreateFunc != nil {
+		return s.CreateFunc(ctx, reader)
+	}
+	return s.Service.Create(ctx, reader)
+}
+
+// Select calls SelectFunc or the wrapped Service.
+func (s ServiceFuncs) Select(ctx context.Context, key string) (Model, error) {
+	if s.SelectFunc != nil {
+		return s.SelectFunc(ctx, key)
+	}
+	return s.Service.Select(ctx, key)
+}
+
+// Remove calls RemoveFunc or the wrapped Service.
+func (s ServiceFuncs) Remove(ctx context.Context, key string) (Model, error) {
+	if s.RemoveFunc != nil {
+		return s.RemoveFunc(ctx, key)
+	}
+	return s.Service.Remove(ctx, key)
+}
+
+// Update calls UpdateFunc or the wrapped Service.
+func (s ServiceFuncs) Update(ctx context.Context, key string, reader io.Reader) (Model, error) {
+	if s.UpdateFunc != nil {
+		return s.UpdateFunc(ctx, key, reader)
+	}
+	return s.Service.Update(ctx, key, reader)
+}
+
+// Modify calls ModifyFunc or the wrapped Service.
+func (s ServiceFuncs) Modify(ctx context.Context, key string, reader io.Reader) (Model, error) {
+	if s.ModifyFunc != nil {
+		return s.ModifyFunc(ctx, key, reader)
+	}
+	return s.Service.Modify(ctx, key, reader)
+}
+
+// FilterParams forwards to the wrapped Service.
+func (s ServiceFuncs) FilterParams() []string {
+	return filterParams(s.Service)
+}
+
+// SelectWithDeleted calls SelectWithDeletedFunc or the wrapped Service unless
+// SelectFunc is set.
+func (s ServiceFuncs) SelectWithDeleted(ctx context.Context, key string) (Model, error) {
+	switch {
+	case s.SelectWithDeletedFunc != nil:
+		return s.SelectWithDeletedFunc(ctx, key)
+	case s.SelectFunc != nil:
+		return nil, errNotSoftDeleter
+	}
+	return asSoftDeleter(s.Service).SelectWithDeleted(ctx, key)
+}
+
+// Restore calls RestoreFunc or the wrapped Service unless RemoveFunc is set.
+func (s ServiceFuncs) Restore(ctx context.Context, key string) (Model, error) {
+	switch {
+	case s.RestoreFunc != nil:
+		return s.RestoreFunc(ctx, key)
+	case s.RemoveFunc != nil:
+		return nil, errNotSoftDeleter
+	}
+	return asSoftDeleter(s.Service).Restore(ctx, key)
+}
+
+// Purge calls PurgeFunc or the wrapped Service.
+func (s ServiceFuncs) Purge(ctx context.Context) ([]Model, error) {
+	if s.PurgeFunc != nil {
+		return s.PurgeFunc(ctx)
+	}
+	return asSoftDeleter(s.Service).Purge(ctx)
+}
+
+// Revisions calls RevisionsFunc or the wrapped Service unless SelectFunc is
+// set.
+func (s ServiceFuncs) Revisions(ctx context.Context, key string) ([]Revision, error) {
+	switch {
+	case s.RevisionsFunc != nil:
+		return s.RevisionsFunc(ctx, key)
+	case s.SelectFunc != nil:
+		return nil, errNotReverter
+	}
+	return asReverter(s.Service).Revisions(ctx, key)
+}
+
+// SelectRevision calls SelectRevisionFunc or the wrapped Service unless
+// SelectFunc is set.
+func (s ServiceFuncs) SelectRevision(ctx context.Context, key string, number int) (Model, error) {
+	switch {
+	case s.SelectRevisionFunc != nil:
+		return s.SelectRevisionFunc(ctx, key, number)
+	case s.SelectFunc != nil:
+		return nil, errNotReverter
+	}
+	return asReverter(s.Service).SelectRevision(ctx, key, number)
+}
+
+// Revert calls RevertFunc or the wrapped Service unless UpdateFunc is set.
+func (s ServiceFuncs) Revert(ctx context.Context, key string, number int) (Model, error) {
+	switch {
+	case s.RevertFunc != nil:
+		return s.RevertFunc(ctx, key, number)
+	case s.UpdateFunc != nil:
+		return nil, errNotReverter
+	}
+	return asReverter(s.Service).Revert(ctx, key, number)
+}
+
+// CreateWithTTL calls CreateWithTTLFunc or the wrapped Service unless
+// CreateFunc is set.
+func (s ServiceFuncs) CreateWithTTL(ctx context.Context, reader io.Reader, ttl time.Duration) (Model, error) {
+	switch {
+	case s.CreateWithTTLFunc != nil:
+		return s.CreateWithTTLFunc(ctx, reader, ttl)
+	case s.CreateFunc != nil:
+		return nil, errNotExpirer
+	}
+	return asExpirer(s.Service).CreateWithTTL(ctx, reader, ttl)
+}
+
+// UpdateWithTTL calls UpdateWithTTLFunc or the wrapped Service unless
+// UpdateFunc is set.
+func (s ServiceFuncs) UpdateWithTTL(ctx context.Context, key string, reader io.Reader, ttl time.Duration) (Model, error) {
+	switch {
+	case s.UpdateWithTTLFunc != nil:
+		return s.UpdateWithTTLFunc(ctx, key, reader, ttl)
+	case s.UpdateFunc != nil:
+		return nil, errNotExpirer
+	}
+	return asExpirer(s.Service).UpdateWithTTL(ctx, key, reader, ttl)
+}
+
+// SelectMany calls SelectManyFunc, or selects each key with SelectFunc if it
+// is set and with the wrapped Service otherwise.
+func (s ServiceFuncs) SelectMany(ctx context.Context, keys []string) (map[string]Model, error) {
+	switch {
+	case s.SelectManyFunc != nil:
+		return s.SelectManyFunc(ctx, keys)
+	case s.SelectFunc != nil:
+		return SelectMany(ctx, struct{ Service }{s}, keys)
+	}
+	return SelectMany(ctx, s.Service, keys)
+}
@@ -0,0 +1,148 @@
+package rest_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/ktnyt/go-rest/resttest"
+	"github.com/stretchr/testify/require"
+)
+
+func tracer(name string, trace *[]string) rest.ServiceMiddleware {
+	return func(service rest.Service) rest.Service {
+		return rest.ServiceFuncs{
+			Service: service,
+			BrowseFunc: func(ctx context.Context) ([]rest.Model, error) {
+				*trace = append(*trace, name)
+				return service.Browse(ctx)
+			},
+		}
+	}
+}
+
+func TestServiceMiddleware(t *testing.T) {
+	trace := make([]string, 0)
+	service := rest.Chain(
+		tracer("outer", &trace),
+		tracer("inner", &trace),
+	)(NewTodoDictService())
+
+	t.Run("runs middlewares in order", func(t *testing.T) {
+		_, err := service.Browse(emptyContext)
+		require.NoError(t, err)
+		require.Equal(t, []string{"outer", "inner"}, trace)
+	})
+
+	t.Run("falls back to the wrapped service", func(t *testing.T) {
+		model, err := create(t, service, RandomTodo())
+		require.NoError(t, err)
+
+		selected, err := service.Select(emptyContext, model.(*Todo).Key)
+		require.NoError(t, err)
+		require.Equal(t, model, selected)
+	})
+
+	t.Run("forwards optional interfaces", func(t *testing.T) {
+		service := tracer("outer", &trace)(
+			rest.NewDictService(NewTodo, Filter, Convert, rest.WithHistory(0)),
+		)
+
+		_, err := create(t, service, RandomTodo())
+		require.NoError(t, err)
+
+		revisions, err := service.(rest.Reverter).Revisions(emptyContext, "0")
+		require.NoError(t, err)
+		require.Len(t, revisions, 1)
+	})
+
+	t.Run("does not bypass overridden writes", func(t *testing.T) {
+		inner := rest.NewDictService(NewTodo, Filter, Convert, rest.WithHistory(0))
+		model, err := create(t, inner, RandomTodo())
+		require.NoError(t, err)
+		key := model.(*Todo).Key
+
+		written := 0
+		service := rest.ServiceFuncs{
+			Service: inner,
+			CreateFunc: func(ctx context.Context, reader io.Reader) (rest.Model, error) {
+				written++
+				return inner.Create(ctx, reader)
+			},
+			UpdateFunc: func(ctx context.Context, key string, reader io.Reader) (rest.Model, error) {
+				written++
+				return inner.Update(ctx, key, reader)
+			},
+			CreateWithTTLFunc: func(ctx context.Context, reader io.Reader, ttl time.Duration) (rest.Model, error) {
+				written++
+				return inner.(rest.Expirer).CreateWithTTL(ctx, reader, ttl)
+			},
+		}
+
+		_, err = service.UpdateWithTTL(emptyContext, key, bytes.NewReader(mustMarshal(RandomTodo())), time.Hour)
+		resttest.RequireStatus(t, http.StatusNotImplemented, err)
+
+		_, err = service.Revert(emptyContext, key, 1)
+		resttest.RequireStatus(t, http.StatusNotImplemented, err)
+
+		_, err = service.CreateWithTTL(emptyContext, bytes.NewReader(mustMarshal(RandomTodo())), time.Hour)
+		require.NoError(t, err)
+		require.Equal(t, 1, written)
+	})
+
+	t.Run("does not bypass overridden reads", func(t *testing.T) {
+		inner := rest.NewDictService(NewTodo, Filter, Convert, rest.WithSoftDelete(0), rest.WithHistory(0))
+		model, err := create(t, inner, RandomTodo())
+		require.NoError(t, err)
+		key := model.(*Todo).Key
+
+		service := rest.ServiceFuncs{
+			Service: inner,
+			SelectFunc: func(ctx context.Context, key string) (rest.Model, error) {
+				return nil, rest.NewServiceError(rest.ErrForbidden, http.StatusForbidden)
+			},
+		}
+
+		_, err = service.SelectWithDeleted(emptyContext, key)
+		resttest.RequireStatus(t, http.StatusNotImplemented, err)
+
+		_, err = service.Revisions(emptyContext, key)
+		resttest.RequireStatus(t, http.StatusNotImplemented, err)
+
+		_, err = service.SelectRevision(emptyContext, key, 1)
+		resttest.RequireStatus(t, http.StatusNotImplemented, err)
+
+		service.RevisionsFunc = inner.(rest.Reverter).Revisions
+		revisions, err := service.Revisions(emptyContext, key)
+		require.NoError(t, err)
+		require.Len(t, revisions, 1)
+	})
+
+	t.Run("forwards batch selects", func(t *testing.T) {
+		inner := NewTodoDictService()
+		model, err := create(t, inner, RandomTodo())
+		require.NoError(t, err)
+		key := model.(*Todo).Key
+
+		values, err := rest.ServiceFuncs{Service: inner}.SelectMany(emptyContext, []string{key, "missing"})
+		require.NoError(t, err)
+		require.Equal(t, map[string]rest.Model{key: model}, values)
+
+		selected := 0
+		service := rest.ServiceFuncs{
+			Service: inner,
+			SelectFunc: func(ctx context.Context, key string) (rest.Model, error) {
+				selected++
+				return inner.Select(ctx, key)
+			},
+		}
+		values, err = service.SelectMany(emptyContext, []string{key, key, "missing"})
+		require.NoError(t, err)
+		require.Len(t, values, 1)
+		require.Equal(t, 2, selected)
+	})
+}
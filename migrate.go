@@ -0,0 +1,398 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MigrationFunc migrates a value stored in a snapshot, given as its decoded
+// JSON object, to the next schema version by modifying it in place. Numbers
+// are decoded as json.Number.
+type MigrationFunc func(value map[string]interface{}) error
+
+// Migration migrates values to a schema version.
+type Migration struct {
+	Version int
+	Name    string
+	Migrate MigrationFunc
+}
+
+// MigrationStep reports the values changed by a Migration.
+type MigrationStep struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	Touched int    `json:"touched"`
+}
+
+// MigrationReport reports the Migrations applied to a snapshot.
+type MigrationReport struct {
+	From    int             `json:"from"`
+	To      int             `json:"to"`
+	Records int             `json:"records"`
+	Steps   []MigrationStep `json:"steps"`
+}
+
+// Migrations is a set of Migrations defining the schema versions of a Model.
+// A snapshot without a schema version is at version 0.
+type Migrations struct {
+	mu         sync.RWMutex
+	migrations map[int]Migration
+}
+
+// NewMigrations creates a new Migrations object.
+func NewMigrations() *Migrations {
+	return &Migrations{migrations: make(map[int]Migration)}
+}
+
+// Register the Migration of values from the previous schema version to the
+// given version.
+func (m *Migrations) Register(version int, name string, migrate MigrationFunc) *Migrations {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.migrations[version] = Migration{Version: version, Name: name, Migrate: migrate}
+	return m
+}
+
+// Latest returns the latest schema version.
+func (m *Migrations) Latest() int {
+	if m == nil {
+		return 0
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	latest := 0
+	for version := range m.migrations {
+		if version > latest {
+			latest = version
+		}
+	}
+	return latest
+}
+
+// pending returns the Migrations after the given schema version in order.
+func (m *Migrations) pending(version int) []Migration {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := make([]Migration, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		if migration.Version > version {
+			list = append(list, migration)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list
+}
+
+// Migrate the values in the snapshot and their revisions to the latest schema
+// version, applying the pending Migrations in order. Only changed values of
+// records count as touched. The given snapshot is left unchanged, so that the
+// report can be used as a dry run. Returns a ServiceError with status code
+// 400 if the snapshot has a newer schema version or a Migration fails.
+func (m *Migrations) Migrate(snapshot Snapshot) (Snapshot, MigrationReport, error) {
+	from, to := snapshot.Header.Schema, m.Latest()
+	report := MigrationReport{From: from, To: to, Records: len(snapshot.Records), Steps: []MigrationStep{}}
+
+	if from > to {
+		err := errors.Errorf("snapshot has schema version %d but the latest is %d", from, to)
+		return Snapshot{}, report, NewServiceError(err, http.StatusBadRequest)
+	}
+
+	pending := m.pending(from)
+	if len(pending) == 0 {
+		return snapshot, report, nil
+	}
+
+	records := make([]SnapshotRecord, len(snapshot.Records))
+	copy(records, snapshot.Records)
+
+	for _, migration := range pending {
+		step := MigrationStep{Version: migration.Version, Name: migration.Name}
+
+		for i, record := range records {
+			value, err := migrateValue(migration, record.Value)
+			if err != nil {
+				err = errors.Wrapf(err, "migration %d (%s) of key '%s'", migration.Version, migration.Name, record.Key)
+				return Snapshot{}, report, NewServiceError(err, http.StatusBadRequest)
+			}
+
+			if !bytes.Equal(value, record.Value) {
+				records[i].Value = value
+				step.Touched++
+			}
+
+			if len(record.History) == 0 {
+				continue
+			}
+			history := make([]SnapshotRevision, len(record.History))
+			copy(history, record.History)
+			for j, revision := range history {
+				value, err := migrateValue(migration, revision.Value)
+				if err != nil {
+					err = errors.Wrapf(err, "migration %d (%s) of revision %d of key '%s'", migration.Version, migration.Name, revision.Number, record.Key)
+					return Snapshot{}, report, NewServiceError(err, http.StatusBadRequest)
+				}
+				history[j].Value = value
+			}
+			records[i].History = history
+		}
+
+		report.Steps = append(report.Steps, step)
+	}
+
+	migrated := Snapshot{Header: snapshot.Header, Records: records}
+	migrated.Header.Schema = to
+	return migrated, report, nil
+}
+
+// migrateValue applies the Migration to an encoded value, returning the value
+// unchanged if the Migration did not change it.
+func migrateValue(migration Migration, data json.RawMessage) (json.RawMessage, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value map[string]interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	before, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migration.Migrate(value); err != nil {
+		return nil, err
+	}
+
+	after, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(before, after) {
+		return data, nil
+	}
+	return after, nil
+}
+
+// WithMigrations sets the Migrations defining the schema versions of the
+// Model. Snapshots are taken at the latest schema version and loaded
+// snapshots are migrated to it.
+func WithMigrations(migrations *Migrations) DictServiceOption {
+	return func(s *DictService) {
+		s.migrations = migrations
+	}
+}
+
+// Migrations returns the Migrations of the DictService, which may be nil.
+func (s *DictService) Migrations() *Migrations {
+	return s.migrations
+}
+
+// SnapshotFile is an IOHandler persisting a DictService as an NDJSON snapshot
+// in a file. Loading a snapshot migrates its values with the Migrations of
+// the DictService.
+type SnapshotFile struct {
+	path  string
+	build ServiceBuilder
+}
+
+// NewSnapshotFile creates a SnapshotFile for the file at the given path. The
+// builder must create an empty *DictService.
+func NewSnapshotFile(path string, build ServiceBuilder) *SnapshotFile {
+	return &SnapshotFile{path: path, build: build}
+}
+
+// Save the DictService, replacing the file atomically.
+func (f *SnapshotFile) Save(service Service) error {
+	dict, ok := service.(*DictService)
+	if !ok {
+		return errors.Errorf("in SnapshotFile Save: expected a *DictService, got %T", service)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return errors.Wrap(err, "in SnapshotFile Save")
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := dict.Export(context.Background(), tmp, SnapshotNDJSON); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "in SnapshotFile Save")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "in SnapshotFile Save")
+	}
+
+	return errors.Wrap(os.Rename(tmp.Name(), f.path), "in SnapshotFile Save")
+}
+
+// Load the DictService, which is empty if the file does not exist.
+func (f *SnapshotFile) Load() (Service, error) {
+	dict, snapshot, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+	if snapshot == nil {
+		return dict, nil
+	}
+
+	if _, err := dict.Load(context.Background(), *snapshot, ImportReplace); err != nil {
+		return nil, errors.Wrap(err, "in SnapshotFile Load")
+	}
+	return dict, nil
+}
+
+// ImportGob replaces the file with a snapshot of the DictService encoded with
+// encoding/gob in the reader, to move a store persisted by an IOHandler
+// encoding the DictService itself to the SnapshotFile. The values are
+// migrated from the given schema version, see ReadGobSnapshot.
+func (f *SnapshotFile) ImportGob(r io.Reader, schema int) error {
+	snapshot, err := ReadGobSnapshot(r, schema)
+	if err != nil {
+		return errors.Wrap(err, "in SnapshotFile ImportGob")
+	}
+
+	dict, ok := f.build().(*DictService)
+	if !ok {
+		return errors.New("in SnapshotFile: builder must create a *DictService")
+	}
+	if _, err := dict.Load(context.Background(), snapshot, ImportReplace); err != nil {
+		return errors.Wrap(err, "in SnapshotFile ImportGob")
+	}
+	return f.Save(dict)
+}
+
+// DryRun reports the Migrations loading the file would apply without
+// changing the file.
+func (f *SnapshotFile) DryRun() (MigrationReport, error) {
+	dict, snapshot, err := f.read()
+	if err != nil {
+		return MigrationReport{}, err
+	}
+	if snapshot == nil {
+		to := dict.migrations.Latest()
+		return MigrationReport{From: to, To: to, Steps: []MigrationStep{}}, nil
+	}
+
+	_, report, err := dict.migrations.Migrate(*snapshot)
+	return report, err
+}
+
+// read builds an empty DictService and reads the snapshot in the file, which
+// is nil if the file does not exist.
+func (f *SnapshotFile) read() (*DictService, *Snapshot, error) {
+	dict, ok := f.build().(*DictService)
+	if !ok {
+		return nil, nil, errors.New("in SnapshotFile: builder must create a *DictService")
+	}
+
+	file, err := os.Open(f.path)
+	if os.IsNotExist(err) {
+		return dict, nil, nil
+	}
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "in SnapshotFile Load")
+	}
+	defer file.Close()
+
+	snapshot, err := ReadSnapshot(file, SnapshotNDJSON)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "in SnapshotFile Load: %s", f.path)
+	}
+	return dict, &snapshot, nil
+}
+
+// gobStore holds the fields of a DictService encoded with encoding/gob. The
+// values are decoded into the types registered for them, which need not be
+// the current Models, and revision values are not required to be Models.
+type gobStore struct {
+	Dict    *Dict
+	Count   int
+	Deleted map[string]time.Time
+	History map[string][]gobRevision
+	Expires map[string]time.Time
+}
+
+type gobRevision struct {
+	Number int
+	Time   time.Time
+	Op     string
+	Value  interface{}
+}
+
+// ReadGobSnapshot reads a DictService encoded with encoding/gob, as persisted
+// by IOHandlers encoding the DictService itself, and takes a snapshot of it.
+// Gob stores have no schema version, so the snapshot is stamped with the
+// given one, usually 0 for stores saved before a schema change, and loading
+// it migrates the values from there. The values are decoded into the types
+// registered with gob.Register under the names they were saved with, so
+// register the types the store was saved with, e.g. a struct with the former
+// fields, rather than the current Models. Returns a ServiceError with status
+// code 400 if the data cannot be decoded.
+func ReadGobSnapshot(r io.Reader, schema int) (Snapshot, error) {
+	var store gobStore
+	if err := gob.NewDecoder(r).Decode(&store); err != nil {
+		return Snapshot{}, snapshotError(errors.Wrap(err, "gob"))
+	}
+	if store.Dict == nil {
+		store.Dict = NewDict()
+	}
+
+	records := make([]SnapshotRecord, store.Dict.Len())
+	for i, key := range store.Dict.Keys {
+		value, err := json.Marshal(store.Dict.Values[i])
+		if err != nil {
+			return Snapshot{}, errors.Wrapf(err, "in ReadGobSnapshot: key '%s'", key)
+		}
+
+		records[i] = SnapshotRecord{Key: key, Value: value}
+		if at, ok := store.Deleted[key]; ok {
+			records[i].Deleted = &at
+		}
+		if at, ok := store.Expires[key]; ok {
+			records[i].Expires = &at
+		}
+
+		for _, revision := range store.History[key] {
+			value, err := json.Marshal(revision.Value)
+			if err != nil {
+				return Snapshot{}, errors.Wrapf(err, "in ReadGobSnapshot: revision %d of key '%s'", revision.Number, key)
+			}
+			records[i].History = append(records[i].History, SnapshotRevision{
+				Number: revision.Number,
+				Time:   revision.Time,
+				Op:     revision.Op,
+				Value:  value,
+			})
+		}
+	}
+
+	header := SnapshotHeader{
+		Version: SnapshotVersion,
+		Schema:  schema,
+		Count:   store.Count,
+		Records: len(records),
+		Time:    time.Now(),
+	}
+
+	return Snapshot{Header: header, Records: records}, nil
+}
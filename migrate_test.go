@@ -0,0 +1,239 @@
+package rest_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/ktnyt/go-rest/resttest"
+	"github.com/stretchr/testify/require"
+)
+
+// TodoMigrations migrate Todos from a schema with a Text field and a Status
+// of "open" or "closed".
+func TodoMigrations() *rest.Migrations {
+	return rest.NewMigrations().
+		Register(2, "status to done", func(value map[string]interface{}) error {
+			status, ok := value["Status"]
+			if !ok {
+				return nil
+			}
+			switch status {
+			case "open":
+				value["Done"] = false
+			case "closed":
+				value["Done"] = true
+			default:
+				return fmt.Errorf("unknown status %v", status)
+			}
+			delete(value, "Status")
+			return nil
+		}).
+		Register(1, "rename text to content", func(value map[string]interface{}) error {
+			if text, ok := value["Text"]; ok {
+				value["Content"] = text
+				delete(value, "Text")
+			}
+			return nil
+		})
+}
+
+// LegacyTodo is a Todo as saved before the schema changes of TodoMigrations.
+type LegacyTodo struct {
+	Key       string
+	Text      string
+	CreatedAt time.Time
+	Status    string
+}
+
+func init() {
+	gob.Register(&LegacyTodo{})
+}
+
+func NewMigratedTodoDictService() rest.Service {
+	return rest.NewDictService(NewTodo, Filter, Convert, rest.WithMigrations(TodoMigrations()))
+}
+
+const legacyTodos = `{"version":1,"count":3,"records":3}
+{"key":"0","value":{"Key":"0","Text":"foo","CreatedAt":"2020-01-01T00:00:00Z","Status":"open"}}
+{"key":"1","value":{"Key":"1","Text":"bar","CreatedAt":"2020-01-01T00:00:00Z","Status":"closed"}}
+{"key":"2","value":{"Key":"2","Content":"baz","CreatedAt":"2020-01-01T00:00:00Z","Done":true}}
+`
+
+func TestMigrations(t *testing.T) {
+	writeFile := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "todo.ndjson")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+		return path
+	}
+
+	t.Run("reports dry runs", func(t *testing.T) {
+		path := writeFile(t, legacyTodos)
+		file := rest.NewSnapshotFile(path, NewMigratedTodoDictService)
+
+		report, err := file.DryRun()
+		require.NoError(t, err)
+		require.Equal(t, rest.MigrationReport{
+			From:    0,
+			To:      2,
+			Records: 3,
+			Steps: []rest.MigrationStep{
+				{Version: 1, Name: "rename text to content", Touched: 2},
+				{Version: 2, Name: "status to done", Touched: 2},
+			},
+		}, report)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, legacyTodos, string(data))
+	})
+
+	t.Run("migrates values on load", func(t *testing.T) {
+		path := writeFile(t, legacyTodos)
+		file := rest.NewSnapshotFile(path, NewMigratedTodoDictService)
+		service := rest.NewIOService(file)
+
+		model, err := service.Select(emptyContext, "1")
+		require.NoError(t, err)
+		require.Equal(t, "bar", model.(*Todo).Content)
+		require.True(t, model.(*Todo).Done)
+
+		_, err = service.Create(emptyContext, bytes.NewReader(mustMarshal(RandomTodo())))
+		require.NoError(t, err)
+
+		report, err := file.DryRun()
+		require.NoError(t, err)
+		require.Equal(t, 2, report.From)
+		require.Empty(t, report.Steps)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(string(data), `{"version":1,"schema":2,"count":4,"records":4,`))
+	})
+
+	t.Run("starts empty without a file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "todo.ndjson")
+		file := rest.NewSnapshotFile(path, NewMigratedTodoDictService)
+
+		models, err := rest.NewIOService(file).Browse(emptyContext)
+		require.NoError(t, err)
+		require.Empty(t, models)
+
+		report, err := file.DryRun()
+		require.NoError(t, err)
+		require.Equal(t, 2, report.To)
+	})
+
+	t.Run("rejects failed migrations", func(t *testing.T) {
+		path := writeFile(t, strings.Replace(legacyTodos, `"closed"`, `"stale"`, 1))
+		file := rest.NewSnapshotFile(path, NewMigratedTodoDictService)
+
+		_, err := file.DryRun()
+		resttest.RequireStatus(t, http.StatusBadRequest, err)
+
+		_, err = file.Load()
+		resttest.RequireStatus(t, http.StatusBadRequest, err)
+	})
+
+	t.Run("keeps revision histories", func(t *testing.T) {
+		build := func() rest.Service {
+			return rest.NewDictService(NewTodo, Filter, Convert, rest.WithHistory(0), rest.WithMigrations(TodoMigrations()))
+		}
+		path := writeFile(t, strings.Replace(legacyTodos, `"Status":"open"}}`,
+			`"Status":"open"},"history":[{"number":1,"time":"2020-01-01T00:00:00Z","op":"create","value":{"Key":"0","Text":"qux","Status":"open"}}]}`, 1))
+		service := rest.NewIOService(rest.NewSnapshotFile(path, build))
+
+		_, err := service.Update(emptyContext, "0", bytes.NewReader(mustMarshal(RandomTodo())))
+		require.NoError(t, err)
+
+		service = rest.NewIOService(rest.NewSnapshotFile(path, build))
+		revisions, err := service.(rest.Reverter).Revisions(emptyContext, "0")
+		require.NoError(t, err)
+		require.Len(t, revisions, 2)
+		require.Equal(t, "qux", revisions[0].Value.(*Todo).Content)
+
+		model, err := service.(rest.Reverter).Revert(emptyContext, "0", 1)
+		require.NoError(t, err)
+		require.Equal(t, "qux", model.(*Todo).Content)
+	})
+
+	t.Run("imports gob stores", func(t *testing.T) {
+		build := func() rest.Service {
+			return rest.NewDictService(NewTodo, Filter, Convert, rest.WithHistory(0))
+		}
+		handler := NewBufferIOHandler(build)
+		for i := 0; i < 2; i++ {
+			_, err := rest.NewIOService(handler).Create(emptyContext, bytes.NewReader(mustMarshal(RandomTodo())))
+			require.NoError(t, err)
+		}
+		data := handler.(*BufferIOHandler).buffer
+
+		snapshot, err := rest.ReadGobSnapshot(bytes.NewReader(data), 0)
+		require.NoError(t, err)
+		require.Len(t, snapshot.Records, 2)
+		require.Len(t, snapshot.Records[0].History, 1)
+
+		file := rest.NewSnapshotFile(filepath.Join(t.TempDir(), "todo.ndjson"), build)
+		require.NoError(t, file.ImportGob(bytes.NewReader(data), 0))
+
+		service := rest.NewIOService(file)
+		models, err := service.Browse(emptyContext)
+		require.NoError(t, err)
+		require.Len(t, models, 2)
+
+		revisions, err := service.(rest.Reverter).Revisions(emptyContext, "1")
+		require.NoError(t, err)
+		require.Len(t, revisions, 1)
+
+		_, err = rest.ReadGobSnapshot(strings.NewReader("{}"), 0)
+		resttest.RequireStatus(t, http.StatusBadRequest, err)
+	})
+
+	t.Run("migrates gob stores", func(t *testing.T) {
+		store := &rest.DictService{Dict: rest.NewDict(), Count: 2}
+		store.Dict.Insert("0", &LegacyTodo{Key: "0", Text: "foo", Status: "open"})
+		store.Dict.Insert("1", &LegacyTodo{Key: "1", Text: "bar", Status: "closed"})
+
+		var buf bytes.Buffer
+		require.NoError(t, gob.NewEncoder(&buf).Encode(store))
+
+		file := rest.NewSnapshotFile(filepath.Join(t.TempDir(), "todo.ndjson"), NewMigratedTodoDictService)
+		require.NoError(t, file.ImportGob(&buf, 0))
+
+		service, err := file.Load()
+		require.NoError(t, err)
+
+		model, err := service.Select(emptyContext, "0")
+		require.NoError(t, err)
+		require.Equal(t, "foo", model.(*Todo).Content)
+		require.False(t, model.(*Todo).Done)
+
+		model, err = service.Select(emptyContext, "1")
+		require.NoError(t, err)
+		require.Equal(t, "bar", model.(*Todo).Content)
+		require.True(t, model.(*Todo).Done)
+
+		report, err := file.DryRun()
+		require.NoError(t, err)
+		require.Equal(t, 2, report.From)
+	})
+
+	t.Run("rejects newer schemas", func(t *testing.T) {
+		path := writeFile(t, strings.Replace(legacyTodos, `"version":1`, `"version":1,"schema":3`, 1))
+		file := rest.NewSnapshotFile(path, NewMigratedTodoDictService)
+
+		_, err := file.Load()
+		resttest.RequireStatus(t, http.StatusBadRequest, err)
+
+		file = rest.NewSnapshotFile(path, NewTodoDictService)
+		_, err = file.Load()
+		resttest.RequireStatus(t, http.StatusBadRequest, err)
+	})
+}
@@ -0,0 +1,376 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ChildService is a Service scoping a collection of child values to a parent
+// value of another Service, e.g. the todos of a list served at
+// /lists/{id}/todos/{pk}. The key of the parent is taken from the request
+// context like the primary key, and every child refers to its parent by a
+// JSON field.
+//
+// Every operation responds with 404 if the parent does not exist. Browse and
+// Delete only see the children of the parent, Create, Update and Modify set
+// the parent field of the value to the parent, and children of other parents
+// are reported as missing.
+//
+// Browse and Delete pass the parent key to the children Service as the URL
+// parameter named after the parent field, so that a children Service which
+// filters by it, like a SQLService, paginates the children of the parent
+// only. Children of other parents are left out either way.
+type ChildService struct {
+	parent   Service
+	children Service
+	param    string
+	field    string
+	key      string
+}
+
+// NewChildService creates a ChildService serving the values of children
+// belonging to a value of parent. The param names the context value holding
+// the parent key, parentField the JSON field of a child holding the key of
+// its parent and keyField the JSON field of a child holding its own key.
+func NewChildService(parent, children Service, param, parentField, keyField string) *ChildService {
+	return &ChildService{
+		parent:   parent,
+		children: children,
+		param:    param,
+		field:    parentField,
+		key:      keyField,
+	}
+}
+
+// checkParent extracts the parent key from the context and checks that the
+// parent exists.
+func (s *ChildService) checkParent(ctx context.Context) (string, error) {
+	if err := CheckContext(ctx); err != nil {
+		return "", err
+	}
+
+	key, ok := ctx.Value(s.param).(string)
+	if !ok {
+		err := fmt.Errorf("parent key parameter '%s' is missing from the request context", s.param)
+		return "", NewServiceError(err, http.StatusInternalServerError)
+	}
+
+	if _, err := s.parent.Select(ctx, key); err != nil {
+		if e, ok := errors.Cause(err).(ServiceError); ok && e.Code >= http.StatusInternalServerError {
+			return "", err
+		}
+		err = errors.Wrapf(NewKeyError(key, true), "parent not found")
+		return "", NewServiceError(err, http.StatusNotFound)
+	}
+
+	return key, nil
+}
+
+// belongs tests if the child belongs to the parent.
+func (s *ChildService) belongs(model Model, parent string) bool {
+	value, ok := modelField(model, s.field)
+	return ok && fmt.Sprint(value) == parent
+}
+
+// scope sets the parent field of the JSON object read from the reader.
+func (s *ChildService) scope(reader io.Reader, parent string) (io.Reader, error) {
+	var object map[string]json.RawMessage
+	if err := (DecodeOptions{}).Decode(reader, &object); err != nil {
+		return nil, err
+	}
+	if object == nil {
+		object = make(map[string]json.RawMessage)
+	}
+
+	name := s.field
+	for key := range object {
+		if strings.EqualFold(key, s.field) {
+			name = key
+		}
+	}
+
+	value, err := json.Marshal(parent)
+	if err != nil {
+		return nil, err
+	}
+	object[name] = value
+
+	data, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// child selects a child of the parent.
+func (s *ChildService) child(ctx context.Context, key string) (string, error) {
+	parent, err := s.checkParent(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	model, err := s.children.Select(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	if !s.belongs(model, parent) {
+		err := NewKeyError(key, true)
+		return "", NewServiceError(err, http.StatusNotFound)
+	}
+
+	return parent, nil
+}
+
+// list the children of the parent with the given key.
+func (s *ChildService) list(ctx context.Context, parent string) ([]Model, error) {
+	params := make(url.Values)
+	for name, values := range ExtractParams(ctx) {
+		params[name] = values
+	}
+	params.Set(s.field, parent)
+
+	models, err := s.children.Browse(InjectParams(ctx, params))
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Model, 0, len(models))
+	for _, model := range models {
+		if s.belongs(model, parent) {
+			list = append(list, model)
+		}
+	}
+	return list, nil
+}
+
+// remove the given children.
+func (s *ChildService) remove(ctx context.Context, models []Model) ([]Model, error) {
+	list := make([]Model, 0, len(models))
+	for _, model := range models {
+		key, ok := modelField(model, s.key)
+		if !ok {
+			err := fmt.Errorf("key field '%s' is missing from child", s.key)
+			return list, NewServiceError(err, http.StatusInternalServerError)
+		}
+
+		removed, err := s.children.Remove(ctx, fmt.Sprint(key))
+		if err != nil {
+			return list, err
+		}
+		list = append(list, removed)
+	}
+	return list, nil
+}
+
+// RemoveChildren removes all children of the parent with the given key,
+// regardless of the URL parameters in the context.
+func (s *ChildService) RemoveChildren(ctx context.Context, parent string) ([]Model, error) {
+	ctx = InjectParams(ctx, url.Values{})
+
+	models, err := s.list(ctx, parent)
+	if err != nil {
+		return nil, err
+	}
+	return s.remove(ctx, models)
+}
+
+// FilterParams forwards to the children Service.
+func (s *ChildService) FilterParams() []string {
+	return filterParams(s.children)
+}
+
+// Browse the children of the parent.
+func (s *ChildService) Browse(ctx context.Context) ([]Model, error) {
+	parent, err := s.checkParent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.list(ctx, parent)
+}
+
+// Delete the children of the parent.
+func (s *ChildService) Delete(ctx context.Context) ([]Model, error) {
+	parent, err := s.checkParent(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	models, err := s.list(ctx, parent)
+	if err != nil {
+		return nil, err
+	}
+	return s.remove(ctx, models)
+}
+
+// Create a child of the parent.
+func (s *ChildService) Create(ctx context.Context, reader io.Reader) (Model, error) {
+	parent, err := s.checkParent(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err = s.scope(reader, parent)
+	if err != nil {
+		return nil, err
+	}
+	return s.children.Create(ctx, reader)
+}
+
+// Select a child of the parent.
+func (s *ChildService) Select(ctx context.Context, key string) (Model, error) {
+	if _, err := s.child(ctx, key); err != nil {
+		return nil, err
+	}
+	return s.children.Select(ctx, key)
+}
+
+// Remove a child of the parent.
+func (s *ChildService) Remove(ctx context.Context, key string) (Model, error) {
+	if _, err := s.child(ctx, key); err != nil {
+		return nil, err
+	}
+	return s.children.Remove(ctx, key)
+}
+
+// Update a child of the parent.
+func (s *ChildService) Update(ctx context.Context, key string, reader io.Reader) (Model, error) {
+	parent, err := s.child(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err = s.scope(reader, parent)
+	if err != nil {
+		return nil, err
+	}
+	return s.children.Update(ctx, key, reader)
+}
+
+// Modify a child of the parent.
+func (s *ChildService) Modify(ctx context.Context, key string, reader io.Reader) (Model, error) {
+	parent, err := s.child(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err = s.scope(reader, parent)
+	if err != nil {
+		return nil, err
+	}
+	return s.children.Modify(ctx, key, reader)
+}
+
+// Cascade creates a ServiceMiddleware for a parent Service removing the
+// children of every parent value it removes. The keyField is the JSON field
+// of a parent value holding its key. The children are removed before the
+// parent, so that a failure leaves the parent in place rather than orphaned
+// children. Restore is not implemented, as the children of a restored parent
+// would be gone; use CascadePurge for a parent Service which tombstones
+// removed values.
+func Cascade(keyField string, children ...*ChildService) ServiceMiddleware {
+	return func(service Service) Service {
+		removeChildren := cascade(keyField, children)
+
+		return ServiceFuncs{
+			Service: service,
+			DeleteFunc: func(ctx context.Context) ([]Model, error) {
+				matched, err := service.Browse(ctx)
+				if err != nil {
+					return nil, err
+				}
+				if err := removeChildren(ctx, matched); err != nil {
+					return nil, err
+				}
+
+				list, err := service.Delete(ctx)
+				if err != nil {
+					return nil, err
+				}
+
+				// Remove the children of parents matched after the Browse,
+				// comparing keys as the Service may return copies.
+				removed := make(map[string]bool, len(matched))
+				for _, model := range matched {
+					key, _ := modelField(model, keyField)
+					removed[fmt.Sprint(key)] = true
+				}
+				added := make([]Model, 0)
+				for _, model := range list {
+					key, ok := modelField(model, keyField)
+					if !ok || !removed[fmt.Sprint(key)] {
+						added = append(added, model)
+					}
+				}
+				if err := removeChildren(ctx, added); err != nil {
+					return nil, err
+				}
+				return list, nil
+			},
+			RemoveFunc: func(ctx context.Context, key string) (Model, error) {
+				model, err := service.Select(ctx, key)
+				if err != nil {
+					return nil, err
+				}
+				if err := removeChildren(ctx, []Model{model}); err != nil {
+					return nil, err
+				}
+				return service.Remove(ctx, key)
+			},
+		}
+	}
+}
+
+// CascadePurge creates a ServiceMiddleware for a parent Service which
+// tombstones removed values, removing the children of every parent value it
+// purges. The children of a tombstoned parent are kept, so that they come
+// back when the parent is restored, but cannot be reached through a
+// ChildService in the meantime. Values purged without a call to Purge, e.g.
+// after the retention period of a DictService, keep their children.
+func CascadePurge(keyField string, children ...*ChildService) ServiceMiddleware {
+	return func(service Service) Service {
+		removeChildren := cascade(keyField, children)
+
+		return ServiceFuncs{
+			Service: service,
+			PurgeFunc: func(ctx context.Context) ([]Model, error) {
+				list, err := asSoftDeleter(service).Purge(ctx)
+				if err != nil {
+					return nil, err
+				}
+				if err := removeChildren(ctx, list); err != nil {
+					return nil, err
+				}
+				return list, nil
+			},
+		}
+	}
+}
+
+// cascade creates a function removing the children of the given parents.
+func cascade(keyField string, children []*ChildService) func(context.Context, []Model) error {
+	return func(ctx context.Context, parents []Model) error {
+		ctx = withoutContextHooks(ctx)
+		for _, parent := range parents {
+			key, ok := modelField(parent, keyField)
+			if !ok {
+				err := fmt.Errorf("key field '%s' is missing from parent", keyField)
+				return NewServiceError(err, http.StatusInternalServerError)
+			}
+			for _, child := range children {
+				if _, err := child.RemoveChildren(ctx, fmt.Sprint(key)); err != nil {
+					return errors.Wrapf(err, "while removing children of %v", key)
+				}
+			}
+		}
+		return nil
+	}
+}
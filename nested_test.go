@@ -0,0 +1,312 @@
+package rest_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/ktnyt/go-rest/resttest"
+	"github.com/stretchr/testify/require"
+)
+
+type List struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+}
+
+func (l *List) Validate() error {
+	if len(l.Name) == 0 {
+		return fmt.Errorf("list name is empty")
+	}
+	return nil
+}
+
+func (l *List) MakeKey(i int) string {
+	l.Key = strconv.Itoa(i)
+	return l.Key
+}
+
+func (l *List) Merge(other interface{}) error {
+	switch other := other.(type) {
+	case *List:
+		l.Name = other.Name
+		return nil
+	default:
+		return fmt.Errorf("attempted to merge non-List object")
+	}
+}
+
+type ListItem struct {
+	Key     string `json:"key"`
+	List    string `json:"list"`
+	Content string `json:"content"`
+}
+
+func (i *ListItem) Validate() error {
+	if len(i.Content) == 0 {
+		return fmt.Errorf("item content is empty")
+	}
+	return nil
+}
+
+func (i *ListItem) MakeKey(n int) string {
+	i.Key = strconv.Itoa(n)
+	return i.Key
+}
+
+func (i *ListItem) Merge(other interface{}) error {
+	switch other := other.(type) {
+	case *ListItem:
+		i.List = other.List
+		i.Content = other.Content
+		return nil
+	default:
+		return fmt.Errorf("attempted to merge non-ListItem object")
+	}
+}
+
+func NewListService() rest.Service {
+	return rest.NewDictService(
+		func() rest.Model { return &List{} },
+		func(context.Context) rest.Filter { return func(interface{}) bool { return true } },
+		func(value interface{}) rest.Model { return value.(*List) },
+	)
+}
+
+func NewListItemService() rest.Service {
+	return rest.NewDictService(
+		func() rest.Model { return &ListItem{} },
+		func(context.Context) rest.Filter { return func(interface{}) bool { return true } },
+		func(value interface{}) rest.Model { return value.(*ListItem) },
+	)
+}
+
+func createJSON(t *testing.T, ctx context.Context, service rest.Service, body string) rest.Model {
+	t.Helper()
+	model, err := service.Create(ctx, bytes.NewReader([]byte(body)))
+	require.NoError(t, err)
+	return model
+}
+
+func TestChildService(t *testing.T) {
+	setup := func(t *testing.T) (rest.Service, rest.Service, *rest.ChildService) {
+		lists, items := NewListService(), NewListItemService()
+		createJSON(t, emptyContext, lists, `{"name":"foo"}`)
+		createJSON(t, emptyContext, lists, `{"name":"bar"}`)
+		return lists, items, rest.NewChildService(lists, items, "id", "list", "key")
+	}
+
+	inList := func(id string) context.Context {
+		return context.WithValue(emptyContext, "id", id)
+	}
+
+	t.Run("scopes children to the parent", func(t *testing.T) {
+		_, items, children := setup(t)
+
+		item := createJSON(t, inList("0"), children, `{"content":"a","list":"1"}`)
+		require.Equal(t, "0", item.(*ListItem).List)
+		createJSON(t, inList("0"), children, `{"content":"b"}`)
+		createJSON(t, inList("1"), children, `{"content":"c"}`)
+
+		models, err := children.Browse(inList("0"))
+		require.NoError(t, err)
+		require.Len(t, models, 2)
+
+		models, err = children.Browse(inList("1"))
+		require.NoError(t, err)
+		require.Len(t, models, 1)
+
+		_, err = children.Select(inList("1"), "0")
+		require.Equal(t, http.StatusNotFound, err.(rest.ServiceError).Code)
+
+		model, err := children.Modify(inList("0"), "0", bytes.NewReader([]byte(`{"content":"d","list":"1"}`)))
+		require.NoError(t, err)
+		require.Equal(t, "0", model.(*ListItem).List)
+
+		models, err = children.Delete(inList("0"))
+		require.NoError(t, err)
+		require.Len(t, models, 2)
+
+		models, err = items.Browse(emptyContext)
+		require.NoError(t, err)
+		require.Len(t, models, 1)
+	})
+
+	t.Run("checks the parent exists", func(t *testing.T) {
+		_, _, children := setup(t)
+
+		_, err := children.Browse(inList("2"))
+		require.Equal(t, http.StatusNotFound, err.(rest.ServiceError).Code)
+
+		_, err = children.Create(inList("2"), bytes.NewReader([]byte(`{"content":"a"}`)))
+		require.Equal(t, http.StatusNotFound, err.(rest.ServiceError).Code)
+	})
+
+	t.Run("cascades removals", func(t *testing.T) {
+		lists, items, children := setup(t)
+		lists = rest.Cascade("key", children)(lists)
+
+		createJSON(t, inList("0"), children, `{"content":"a"}`)
+		createJSON(t, inList("0"), children, `{"content":"b"}`)
+		createJSON(t, inList("1"), children, `{"content":"c"}`)
+
+		_, err := lists.Remove(emptyContext, "0")
+		require.NoError(t, err)
+
+		models, err := items.Browse(emptyContext)
+		require.NoError(t, err)
+		require.Len(t, models, 1)
+
+		_, err = lists.Delete(emptyContext)
+		require.NoError(t, err)
+
+		models, err = items.Browse(emptyContext)
+		require.NoError(t, err)
+		require.Len(t, models, 0)
+	})
+
+	t.Run("cascades deletes of copied parents once", func(t *testing.T) {
+		lists, items, _ := setup(t)
+		browsed := 0
+		counting := rest.ServiceFuncs{
+			Service: items,
+			BrowseFunc: func(ctx context.Context) ([]rest.Model, error) {
+				browsed++
+				return items.Browse(ctx)
+			},
+		}
+		children := rest.NewChildService(lists, counting, "id", "list", "key")
+		copied := rest.ServiceFuncs{
+			Service: lists,
+			BrowseFunc: func(ctx context.Context) ([]rest.Model, error) {
+				models, err := lists.Browse(ctx)
+				for i, model := range models {
+					list := *model.(*List)
+					models[i] = &list
+				}
+				return models, err
+			},
+		}
+		parents := rest.Cascade("key", children)(copied)
+
+		models, err := parents.Delete(emptyContext)
+		require.NoError(t, err)
+		require.Len(t, models, 2)
+		require.Equal(t, 2, browsed)
+	})
+
+	t.Run("paginates children of the parent", func(t *testing.T) {
+		lists := NewListService()
+		createJSON(t, emptyContext, lists, `{"name":"foo"}`)
+		createJSON(t, emptyContext, lists, `{"name":"bar"}`)
+
+		store := OpenTodoStore(t, filepath.Join(t.TempDir(), "items.db"))
+		items := rest.NewKVService(store, "items", func() rest.Model { return &ListItem{} },
+			func(ctx context.Context) rest.Filter {
+				list := rest.ExtractParams(ctx).Get("list")
+				return func(value interface{}) bool {
+					return list == "" || value.(*ListItem).List == list
+				}
+			},
+			rest.WithKVFilterParams("list"),
+		)
+		children := rest.NewChildService(lists, items, "id", "list", "key")
+
+		createJSON(t, inList("1"), children, `{"content":"a"}`)
+		createJSON(t, inList("1"), children, `{"content":"b"}`)
+		createJSON(t, inList("0"), children, `{"content":"c"}`)
+		createJSON(t, inList("0"), children, `{"content":"d"}`)
+
+		ctx := rest.InjectParams(inList("0"), url.Values{rest.LimitParam: {"1"}})
+		models, err := children.Browse(ctx)
+		require.NoError(t, err)
+		require.Len(t, models, 1)
+		require.Equal(t, "c", models[0].(*ListItem).Content)
+	})
+
+	t.Run("removes children before the parent", func(t *testing.T) {
+		lists, items, _ := setup(t)
+		failing := rest.ServiceFuncs{
+			Service: items,
+			RemoveFunc: func(ctx context.Context, key string) (rest.Model, error) {
+				return nil, rest.NewServiceError(fmt.Errorf("item is locked"), http.StatusConflict)
+			},
+		}
+		children := rest.NewChildService(lists, failing, "id", "list", "key")
+		createJSON(t, inList("0"), children, `{"content":"a"}`)
+		lists = rest.Cascade("key", children)(lists)
+
+		_, err := lists.Remove(emptyContext, "0")
+		resttest.RequireStatus(t, http.StatusConflict, err)
+
+		_, err = lists.Select(emptyContext, "0")
+		require.NoError(t, err)
+
+		_, err = lists.Remove(emptyContext, "2")
+		require.Error(t, err)
+	})
+
+	t.Run("cascades purges", func(t *testing.T) {
+		lists := rest.NewDictService(
+			func() rest.Model { return &List{} },
+			func(context.Context) rest.Filter { return func(interface{}) bool { return true } },
+			func(value interface{}) rest.Model { return value.(*List) },
+			rest.WithSoftDelete(0),
+		)
+		createJSON(t, emptyContext, lists, `{"name":"foo"}`)
+		items := NewListItemService()
+		children := rest.NewChildService(lists, items, "id", "list", "key")
+		createJSON(t, inList("0"), children, `{"content":"a"}`)
+		parents := rest.CascadePurge("key", children)(lists)
+
+		_, err := parents.Remove(emptyContext, "0")
+		require.NoError(t, err)
+
+		models, err := items.Browse(emptyContext)
+		require.NoError(t, err)
+		require.Len(t, models, 1)
+
+		_, err = children.Browse(inList("0"))
+		resttest.RequireStatus(t, http.StatusNotFound, err)
+
+		_, err = parents.(rest.SoftDeleter).Purge(emptyContext)
+		require.NoError(t, err)
+
+		models, err = items.Browse(emptyContext)
+		require.NoError(t, err)
+		require.Len(t, models, 0)
+	})
+
+	t.Run("serves nested routes", func(t *testing.T) {
+		_, _, children := setup(t)
+		iface := rest.NewServiceInterface(children)
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/lists/0/todos", bytes.NewReader([]byte(`{"content":"a"}`)))
+		iface.Create(w, r.WithContext(inList("0")))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/lists/0/todos/0", nil)
+		iface.Select(w, r.WithContext(context.WithValue(inList("0"), rest.PK, "0")))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var item ListItem
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&item))
+		require.Equal(t, "0", item.List)
+
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/lists/5/todos", nil)
+		iface.Browse(w, r.WithContext(inList("5")))
+		require.Equal(t, http.StatusNotFound, w.Code)
+		require.Equal(t, rest.ProblemContentType, w.Header().Get("Content-Type"))
+	})
+}
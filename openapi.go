@@ -0,0 +1,342 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpenAPIPath is the conventional path to serve an OpenAPI document at.
+const OpenAPIPath = "/openapi.json"
+
+// OpenAPIVersion is the version of the OpenAPI specification generated.
+const OpenAPIVersion = "3.1.0"
+
+// Parameter describes a URL parameter of a Resource, e.g. a filter.
+type Parameter struct {
+	Name        string
+	Description string
+
+	// Type is the JSON schema type of the parameter. Defaults to string.
+	Type string
+}
+
+// Resource describes a collection served by a ServiceInterface.
+type Resource struct {
+	// Path of the collection, e.g. /todos. The path of a value appends the
+	// primary key parameter to it.
+	Path string
+
+	// Name of the Model, used for the schema and the operation IDs.
+	Name string
+
+	// Build creates a Model to derive the schema from.
+	Build ModelBuilder
+
+	// PKParam is the name of the primary key parameter. Defaults to PK.
+	PKParam string
+
+	// Params are the filter and sort parameters for Browse and Delete.
+	Params []Parameter
+
+	// Operations lists the documented operations. Defaults to Browse, Delete,
+	// Create, Select, Remove, Update and Modify.
+	Operations []Operation
+}
+
+// OpenAPI generates an OpenAPI document for a set of Resources.
+type OpenAPI struct {
+	mu        sync.Mutex
+	title     string
+	version   string
+	resources []Resource
+}
+
+// NewOpenAPI creates a new OpenAPI generator for an API of the given title
+// and version.
+func NewOpenAPI(title, version string) *OpenAPI {
+	return &OpenAPI{title: title, version: version}
+}
+
+// Register a Resource to be documented.
+func (o *OpenAPI) Register(resource Resource) *OpenAPI {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.resources = append(o.resources, resource)
+	return o
+}
+
+// Document generates the OpenAPI document.
+func (o *OpenAPI) Document() map[string]interface{} {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	schemas := map[string]interface{}{
+		"Problem": problemSchema(),
+	}
+	paths := make(map[string]interface{})
+
+	for _, resource := range o.resources {
+		schemas[resource.Name] = newSchemaGenerator().schema(reflect.TypeOf(resource.Build()))
+
+		pkparam := resource.PKParam
+		if pkparam == "" {
+			pkparam = PK
+		}
+
+		operations := resource.Operations
+		if operations == nil {
+			operations = []Operation{OpBrowse, OpDelete, OpCreate, OpSelect, OpRemove, OpUpdate, OpModify}
+		}
+
+		collection := make(map[string]interface{})
+		item := make(map[string]interface{})
+		for _, op := range operations {
+			if method, operation := resource.operation(op); operation != nil {
+				switch op {
+				case OpBrowse, OpDelete, OpCreate:
+					collection[method] = operation
+				default:
+					item[method] = operation
+				}
+			}
+		}
+
+		if len(collection) > 0 {
+			paths[resource.Path] = collection
+		}
+		if len(item) > 0 {
+			item["parameters"] = []interface{}{map[string]interface{}{
+				"name":     pkparam,
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			}}
+			paths[strings.TrimSuffix(resource.Path, "/")+"/{"+pkparam+"}"] = item
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": OpenAPIVersion,
+		"info": map[string]interface{}{
+			"title":   o.title,
+			"version": o.version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+		},
+	}
+}
+
+// ServeHTTP serves the OpenAPI document as JSON.
+func (o *OpenAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	HandleError(json.NewEncoder(w).Encode(o.Document()), w)
+}
+
+// operation describes an operation of the Resource, returning its method.
+func (r Resource) operation(op Operation) (string, map[string]interface{}) {
+	ref := map[string]interface{}{"$ref": "#/components/schemas/" + r.Name}
+	list := map[string]interface{}{"type": "array", "items": ref}
+
+	param := func(name, in, typ, description string) map[string]interface{} {
+		return map[string]interface{}{
+			"name":        name,
+			"in":          in,
+			"description": description,
+			"schema":      map[string]interface{}{"type": typ},
+		}
+	}
+
+	filters := make([]interface{}, len(r.Params))
+	for i, p := range r.Params {
+		typ := p.Type
+		if typ == "" {
+			typ = "string"
+		}
+		filters[i] = param(p.Name, "query", typ, p.Description)
+	}
+
+	fields := param(FieldsParam, "query", "string", "Comma separated fields to include in the response.")
+	expand := param(ExpandParam, "query", "string", "Comma separated references to expand.")
+	ttl := param(TTLHeader, "header", "string", "Time to live of the value in seconds or as a duration.")
+	body := map[string]interface{}{
+		"required": true,
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": ref},
+		},
+	}
+
+	var method string
+	operation := map[string]interface{}{
+		"operationId": strings.ToLower(string(op[:1])) + string(op[1:]) + r.Name,
+		"tags":        []string{r.Name},
+	}
+
+	switch op {
+	case OpBrowse:
+		method = "get"
+		operation["summary"] = "Browse " + r.Name + " values"
+		operation["parameters"] = append(filters, fields, expand)
+		operation["responses"] = responses(list, http.StatusBadRequest)
+	case OpDelete:
+		method = "delete"
+		operation["summary"] = "Delete the matching " + r.Name + " values"
+		operation["parameters"] = append(filters,
+			param(AllParam, "query", "boolean", "Confirm deleting all values without a filter."),
+			param(DryRunParam, "query", "boolean", "List the values to delete without deleting them."),
+		)
+		operation["responses"] = responses(list, http.StatusBadRequest)
+	case OpCreate:
+		method = "post"
+		operation["summary"] = "Create a " + r.Name + " value"
+		operation["parameters"] = []interface{}{ttl}
+		operation["requestBody"] = body
+		operation["responses"] = responses(ref, http.StatusBadRequest, http.StatusRequestEntityTooLarge)
+	case OpSelect:
+		method = "get"
+		operation["summary"] = "Select a " + r.Name + " value"
+		operation["parameters"] = []interface{}{
+			fields,
+			expand,
+			param(RevisionParam, "query", "integer", "Revision number of the value to select."),
+			param(IncludeDeletedParam, "query", "boolean", "Include soft deleted values."),
+		}
+		operation["responses"] = responses(ref, http.StatusBadRequest, http.StatusNotFound)
+	case OpRemove:
+		method = "delete"
+		operation["summary"] = "Remove a " + r.Name + " value"
+		operation["responses"] = responses(ref, http.StatusBadRequest, http.StatusNotFound)
+	case OpUpdate:
+		method = "put"
+		operation["summary"] = "Replace a " + r.Name + " value"
+		operation["parameters"] = []interface{}{ttl}
+		operation["requestBody"] = body
+		operation["responses"] = responses(ref, http.StatusBadRequest, http.StatusNotFound, http.StatusRequestEntityTooLarge)
+	case OpModify:
+		method = "patch"
+		operation["summary"] = "Modify a " + r.Name + " value"
+		operation["requestBody"] = body
+		operation["responses"] = responses(ref, http.StatusBadRequest, http.StatusNotFound, http.StatusRequestEntityTooLarge)
+	default:
+		return "", nil
+	}
+
+	return method, operation
+}
+
+// responses describes a successful response with the schema and Problem
+// responses for the given status codes and any other error.
+func responses(schema interface{}, codes ...int) map[string]interface{} {
+	problem := func(description string) map[string]interface{} {
+		return map[string]interface{}{
+			"description": description,
+			"content": map[string]interface{}{
+				ProblemContentType: map[string]interface{}{
+					"schema": map[string]interface{}{"$ref": "#/components/schemas/Problem"},
+				},
+			},
+		}
+	}
+
+	m := map[string]interface{}{
+		"200": map[string]interface{}{
+			"description": http.StatusText(http.StatusOK),
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": schema},
+			},
+		},
+		"default": problem("Error"),
+	}
+	for _, code := range codes {
+		m[strconv.Itoa(code)] = problem(http.StatusText(code))
+	}
+	return m
+}
+
+func problemSchema() map[string]interface{} {
+	str := map[string]interface{}{"type": "string"}
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"type":     str,
+			"title":    str,
+			"status":   map[string]interface{}{"type": "integer"},
+			"detail":   str,
+			"instance": str,
+		},
+		"additionalProperties": true,
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaGenerator derives JSON schemas from types following the
+// encoding/json rules.
+type schemaGenerator struct {
+	visiting map[reflect.Type]bool
+}
+
+func newSchemaGenerator() *schemaGenerator {
+	return &schemaGenerator{visiting: make(map[reflect.Type]bool)}
+}
+
+func (g *schemaGenerator) schema(t reflect.Type) map[string]interface{} {
+	if t == nil {
+		return map[string]interface{}{}
+	}
+
+	if t.Kind() == reflect.Ptr {
+		elem := g.schema(t.Elem())
+		if typ, ok := elem["type"].(string); ok && t.Elem().Kind() != reflect.Struct {
+			elem["type"] = []string{typ, "null"}
+		}
+		return elem
+	}
+
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		// encoding/json encodes byte slices, but not byte arrays, as base64.
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if g.visiting[t] {
+			return map[string]interface{}{"type": "object"}
+		}
+		g.visiting[t] = true
+		defer delete(g.visiting, t)
+
+		properties := make(map[string]interface{})
+		for name, field := range jsonFields(t) {
+			properties[name] = g.schema(field)
+		}
+		return map[string]interface{}{"type": "object", "properties": properties}
+	default:
+		return map[string]interface{}{}
+	}
+}
@@ -0,0 +1,119 @@
+package rest_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/stretchr/testify/require"
+)
+
+type spec map[string]interface{}
+
+func (s spec) get(keys ...string) interface{} {
+	var v interface{} = map[string]interface{}(s)
+	for _, key := range keys {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+type Blob struct {
+	Key  string   `json:"key"`
+	Data []byte   `json:"data"`
+	Hash [16]byte `json:"hash"`
+}
+
+func (b *Blob) Validate() error {
+	return nil
+}
+
+func (b *Blob) MakeKey(i int) string {
+	b.Key = strconv.Itoa(i)
+	return b.Key
+}
+
+func (b *Blob) Merge(other interface{}) error {
+	return nil
+}
+
+func TestOpenAPI(t *testing.T) {
+	doc := rest.NewOpenAPI("Todos", "1.0.0").
+		Register(rest.Resource{
+			Path:   "/todos",
+			Name:   "Todo",
+			Build:  NewTodo,
+			Params: []rest.Parameter{{Name: "done", Type: "boolean"}},
+		}).
+		Register(rest.Resource{
+			Path:       "/tasks",
+			Name:       "Task",
+			Build:      func() rest.Model { return &Task{} },
+			PKParam:    "id",
+			Operations: []rest.Operation{rest.OpBrowse, rest.OpSelect},
+		})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, rest.OpenAPIPath, nil)
+	doc.ServeHTTP(w, r)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	s := make(spec)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&s))
+
+	t.Run("documents paths", func(t *testing.T) {
+		require.Equal(t, rest.OpenAPIVersion, s.get("openapi"))
+		require.Len(t, s.get("paths"), 4)
+
+		require.Len(t, s.get("paths", "/todos"), 3)
+		require.Len(t, s.get("paths", "/todos/{pk}"), 5)
+		require.Equal(t, "browseTodo", s.get("paths", "/todos", "get", "operationId"))
+		require.NotNil(t, s.get("paths", "/todos/{pk}", "patch", "responses", "404"))
+
+		params := s.get("paths", "/todos", "get", "parameters").([]interface{})
+		require.Equal(t, "done", params[0].(map[string]interface{})["name"])
+
+		require.Len(t, s.get("paths", "/tasks"), 1)
+		params = s.get("paths", "/tasks/{id}", "parameters").([]interface{})
+		require.Equal(t, "id", params[0].(map[string]interface{})["name"])
+	})
+
+	t.Run("derives schemas", func(t *testing.T) {
+		require.Equal(t, "object", s.get("components", "schemas", "Todo", "type"))
+		require.Len(t, s.get("components", "schemas", "Todo", "properties"), 4)
+		require.Equal(t, "date-time", s.get("components", "schemas", "Todo", "properties", "CreatedAt", "format"))
+		require.Equal(t, "boolean", s.get("components", "schemas", "Todo", "properties", "Done", "type"))
+
+		require.Equal(t, "array", s.get("components", "schemas", "Task", "properties", "tags", "type"))
+		require.Equal(t, "string", s.get("components", "schemas", "Task", "properties", "tags", "items", "type"))
+
+		require.NotNil(t, s.get("components", "schemas", "Problem"))
+	})
+
+	t.Run("encodes byte slices only as base64", func(t *testing.T) {
+		doc := rest.NewOpenAPI("Blobs", "1.0.0").
+			Register(rest.Resource{
+				Path:  "/blobs",
+				Name:  "Blob",
+				Build: func() rest.Model { return &Blob{} },
+			})
+
+		w := httptest.NewRecorder()
+		doc.ServeHTTP(w, httptest.NewRequest(http.MethodGet, rest.OpenAPIPath, nil))
+
+		s := make(spec)
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&s))
+		require.Equal(t, "base64", s.get("components", "schemas", "Blob", "properties", "data", "contentEncoding"))
+		require.Equal(t, "array", s.get("components", "schemas", "Blob", "properties", "hash", "type"))
+		require.Equal(t, "integer", s.get("components", "schemas", "Blob", "properties", "hash", "items", "type"))
+	})
+}
@@ -3,6 +3,7 @@ package rest
 import (
 	"context"
 	"net/url"
+	"strconv"
 )
 
 // Param is a type alias for specifying URL parameters in contexts.
@@ -15,3 +16,18 @@ const Params = Param("params")
 func InjectParams(ctx context.Context, params url.Values) context.Context {
 	return context.WithValue(ctx, Params, params)
 }
+
+// ExtractParams extracts the URL parameters from the given context.
+func ExtractParams(ctx context.Context) url.Values {
+	if params, ok := ctx.Value(Params).(url.Values); ok {
+		return params
+	}
+	return url.Values{}
+}
+
+// ParamEnabled tests if the named URL parameter in the context is set to a
+// true boolean value.
+func ParamEnabled(ctx context.Context, name string) bool {
+	ok, err := strconv.ParseBool(ExtractParams(ctx).Get(name))
+	return err == nil && ok
+}
@@ -0,0 +1,111 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ProblemContentType is the media type of a Problem response body.
+const ProblemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details response body.
+type Problem struct {
+	Type     string
+	Title    string
+	Status   int
+	Detail   string
+	Instance string
+
+	// Extensions are additional members of the problem details object.
+	Extensions map[string]interface{}
+}
+
+// NewProblem creates a new Problem for the given status code and detail.
+func NewProblem(status int, detail string) Problem {
+	return Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// With returns a copy of the Problem with the given extension member set.
+func (p Problem) With(key string, value interface{}) Problem {
+	extensions := make(map[string]interface{}, len(p.Extensions)+1)
+	for k, v := range p.Extensions {
+		extensions[k] = v
+	}
+	extensions[key] = value
+	p.Extensions = extensions
+	return p
+}
+
+// MarshalJSON satisfies the json.Marshaler interface.
+func (p Problem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+	if p.Type != "" {
+		m["type"] = p.Type
+	}
+	if p.Title != "" {
+		m["title"] = p.Title
+	}
+	if p.Status != 0 {
+		m["status"] = p.Status
+	}
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		m["instance"] = p.Instance
+	}
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON satisfies the json.Unmarshaler interface.
+func (p *Problem) UnmarshalJSON(data []byte) error {
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+
+	*p = Problem{}
+	take := func(key string) interface{} {
+		v := m[key]
+		delete(m, key)
+		return v
+	}
+
+	p.Type, _ = take("type").(string)
+	p.Title, _ = take("title").(string)
+	if status, ok := take("status").(float64); ok {
+		p.Status = int(status)
+	}
+	p.Detail, _ = take("detail").(string)
+	p.Instance, _ = take("instance").(string)
+
+	if len(m) > 0 {
+		p.Extensions = m
+	}
+
+	return nil
+}
+
+// Error satisfies the error interface.
+func (p Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+// WriteProblem writes the Problem as the response.
+func WriteProblem(w http.ResponseWriter, p Problem) {
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
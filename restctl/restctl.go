@@ -0,0 +1,640 @@
+// Package restctl implements an admin tool for inspecting and editing
+// DictServices persisted as NDJSON snapshots by a rest.SnapshotFile.
+//
+// Records are handled as raw JSON unless a model type is selected with the
+// -type flag, in which case values are decoded into the Model registered by
+// that name, validated, and migrated with its Migrations. Put raises the
+// count of the file past the key, so that the keys made for new values do
+// not collide with it. Snapshot files have no write-ahead log, so there is
+// nothing to compact; purge rewrites the file without its tombstoned and
+// expired records.
+//
+// The -gob flag reads a DictService encoded with encoding/gob instead, as
+// persisted by an IOHandler encoding the DictService itself. Such files can
+// be listed, read, verified and exported to a snapshot but not changed. Their
+// values are read at the schema version given by -schema, 0 by default, and
+// decoded into the types registered with gob.Register under the names they
+// were saved with. The restctl command registers no types, so programs
+// reading gob files must embed the tool and register them, see
+// rest.ReadGobSnapshot.
+//
+// Programs embed the tool with their own types by registering them before
+// calling Run:
+//
+//	func main() {
+//		gob.Register(&Todo{})
+//		restctl.Register("todo", NewTodo, rest.WithMigrations(TodoMigrations()))
+//		os.Exit(restctl.Run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+//	}
+package restctl
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/pkg/errors"
+)
+
+// Type is a model type registered with the tool.
+type Type struct {
+	Build   rest.ModelBuilder
+	Options []rest.DictServiceOption
+}
+
+var (
+	mu    sync.RWMutex
+	types = make(map[string]Type)
+)
+
+// Register a model type by name with the options of its DictService.
+func Register(name string, build rest.ModelBuilder, opts ...rest.DictServiceOption) {
+	mu.Lock()
+	defer mu.Unlock()
+	types[name] = Type{Build: build, Options: opts}
+}
+
+// Types returns the names of the registered model types in order.
+func Types() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookup(name string) (Type, error) {
+	if name == "" {
+		return Type{Build: newRawModel}, nil
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	t, ok := types[name]
+	if !ok {
+		return Type{}, errors.Errorf("unknown type '%s'", name)
+	}
+	return t, nil
+}
+
+// rawModel is a Model holding any JSON value as is.
+type rawModel struct {
+	data json.RawMessage
+}
+
+func newRawModel() rest.Model {
+	return &rawModel{}
+}
+
+func (m *rawModel) Validate() error {
+	if len(m.data) == 0 {
+		return errors.New("value is empty")
+	}
+	return nil
+}
+
+func (m *rawModel) MakeKey(i int) string {
+	return strconv.Itoa(i)
+}
+
+func (m *rawModel) Merge(other interface{}) error {
+	return errors.New("raw values cannot be merged")
+}
+
+func (m *rawModel) MarshalJSON() ([]byte, error) {
+	return m.data, nil
+}
+
+func (m *rawModel) UnmarshalJSON(data []byte) error {
+	m.data = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+const usage = `usage: restctl [-type name] <command> <file> [arguments]
+
+Commands:
+  list [field=value ...]   list the records with the given top-level fields
+  get <key>                print the value for the key
+  put <key> [value]        create or replace the value for the key, read
+                           from standard input if not given
+  delete <key>             delete the value for the key
+  export [-format f]       write a snapshot as ndjson (default) or json
+  import [-format f] [-mode m]
+                           read a snapshot from standard input and import it
+                           with mode replace, merge (default) or skip-existing
+  verify                   check the integrity of the file
+  migrate [-dry-run]       migrate the values to the latest schema version
+  purge                    drop tombstoned and expired records
+
+Records are handled as raw JSON unless -type selects a registered type.
+With -gob the file is read as a gob encoded DictService at the schema
+version given by -schema and only list, get, export and verify are
+available. The types of its values must be registered with gob.Register.
+`
+
+// Run the tool with the given arguments, returning the exit code.
+func Run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("restctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		if names := Types(); len(names) > 0 {
+			fmt.Fprintf(stderr, "\nRegistered types: %s\n", strings.Join(names, ", "))
+		}
+	}
+	typeName := flags.String("type", "", "registered model type of the records")
+	gob := flags.Bool("gob", false, "read the file as a gob encoded DictService")
+	schema := flags.Int("schema", 0, "schema version of the values in a gob file")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return 2
+	}
+
+	t, err := lookup(*typeName)
+	if err != nil {
+		fmt.Fprintf(stderr, "restctl: %v\n", err)
+		return 2
+	}
+
+	if *typeName == "" {
+		t.Options = []rest.DictServiceOption{rest.WithMigrations(keepSchema(flags.Arg(1)))}
+	}
+
+	c := &command{
+		file:   flags.Arg(1),
+		typ:    t,
+		gob:    *gob,
+		schema: *schema,
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+
+	commands := map[string]func([]string) error{
+		"list":    c.list,
+		"get":     c.get,
+		"put":     c.put,
+		"delete":  c.delete,
+		"export":  c.export,
+		"import":  c.importSnapshot,
+		"verify":  c.verify,
+		"migrate": c.migrate,
+		"purge":   c.purge,
+	}
+
+	run, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "restctl: unknown command '%s'\n", flags.Arg(0))
+		flags.Usage()
+		return 2
+	}
+	if c.gob && !readOnly[flags.Arg(0)] {
+		fmt.Fprintf(stderr, "restctl: command '%s' cannot change gob files, export them first\n", flags.Arg(0))
+		return 2
+	}
+
+	if err := run(flags.Args()[2:]); err != nil {
+		fmt.Fprintf(stderr, "restctl %s: %v\n", flags.Arg(0), err)
+		if _, ok := err.(usageError); ok {
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+// keepSchema returns Migrations which leave raw values unchanged at the
+// schema version of the file, so that saving it keeps its schema version.
+func keepSchema(path string) *rest.Migrations {
+	migrations := rest.NewMigrations()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return migrations
+	}
+	defer file.Close()
+
+	var header rest.SnapshotHeader
+	if err := json.NewDecoder(file).Decode(&header); err != nil {
+		return migrations
+	}
+
+	for version := 1; version <= header.Schema; version++ {
+		migrations.Register(version, "keep", func(map[string]interface{}) error { return nil })
+	}
+	return migrations
+}
+
+// readOnly are the commands which do not change the file.
+var readOnly = map[string]bool{
+	"list":   true,
+	"get":    true,
+	"export": true,
+	"verify": true,
+}
+
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+type command struct {
+	file   string
+	typ    Type
+	gob    bool
+	schema int
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func (c *command) build() rest.Service {
+	filter := func(context.Context) rest.Filter {
+		return func(interface{}) bool { return true }
+	}
+	convert := func(value interface{}) rest.Model {
+		return value.(rest.Model)
+	}
+	return rest.NewDictService(c.typ.Build, filter, convert, c.typ.Options...)
+}
+
+func (c *command) snapshotFile() *rest.SnapshotFile {
+	return rest.NewSnapshotFile(c.file, c.build)
+}
+
+// load the DictService from the file, which must exist.
+func (c *command) load() (*rest.DictService, error) {
+	if _, err := os.Stat(c.file); err != nil {
+		return nil, err
+	}
+	if c.gob {
+		snapshot, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		dict := c.build().(*rest.DictService)
+		if _, err := dict.Load(context.Background(), snapshot, rest.ImportReplace); err != nil {
+			return nil, err
+		}
+		return dict, nil
+	}
+	service, err := c.snapshotFile().Load()
+	if err != nil {
+		return nil, err
+	}
+	return service.(*rest.DictService), nil
+}
+
+// read the snapshot in the file, or a snapshot of the gob encoded
+// DictService in it.
+func (c *command) read() (rest.Snapshot, error) {
+	file, err := os.Open(c.file)
+	if err != nil {
+		return rest.Snapshot{}, err
+	}
+	defer file.Close()
+
+	if c.gob {
+		snapshot, err := rest.ReadGobSnapshot(file, c.schema)
+		return snapshot, errors.Wrap(err, "value types of gob files must be registered with gob.Register")
+	}
+	return rest.ReadSnapshot(file, rest.SnapshotNDJSON)
+}
+
+func (c *command) save(service *rest.DictService) error {
+	return c.snapshotFile().Save(service)
+}
+
+func (c *command) print(v interface{}) error {
+	return json.NewEncoder(c.stdout).Encode(v)
+}
+
+func (c *command) list(args []string) error {
+	fields := make(url.Values)
+	for _, arg := range args {
+		i := strings.Index(arg, "=")
+		if i < 1 {
+			return usageError(fmt.Sprintf("invalid filter '%s', expected field=value", arg))
+		}
+		fields.Add(arg[:i], arg[i+1:])
+	}
+
+	service, err := c.load()
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := service.Snapshot(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for _, record := range snapshot.Records {
+		if record.Deleted != nil {
+			continue
+		}
+		ok, err := match(record.Value, fields)
+		if err != nil {
+			return errors.Wrapf(err, "key '%s'", record.Key)
+		}
+		if ok {
+			if err := c.print(rest.SnapshotRecord{Key: record.Key, Value: record.Value}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// match tests if the top-level fields of the JSON object have one of the
+// given values. String fields are compared unquoted and other fields by
+// their JSON encoding.
+func match(value json.RawMessage, fields url.Values) (bool, error) {
+	if len(fields) == 0 {
+		return true, nil
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(value, &object); err != nil {
+		return false, err
+	}
+
+	for name, values := range fields {
+		field, ok := object[name]
+		if !ok {
+			return false, nil
+		}
+
+		text := string(field)
+		var s string
+		if json.Unmarshal(field, &s) == nil {
+			text = s
+		}
+
+		found := false
+		for _, value := range values {
+			if value == text {
+				found = true
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (c *command) get(args []string) error {
+	if len(args) != 1 {
+		return usageError("expected a key")
+	}
+
+	service, err := c.load()
+	if err != nil {
+		return err
+	}
+
+	model, err := service.Select(context.Background(), args[0])
+	if err != nil {
+		return err
+	}
+	return c.print(model)
+}
+
+func (c *command) put(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return usageError("expected a key and an optional value")
+	}
+
+	var value []byte
+	if len(args) == 2 {
+		value = []byte(args[1])
+	} else {
+		data, err := io.ReadAll(c.stdin)
+		if err != nil {
+			return err
+		}
+		value = data
+	}
+	if !json.Valid(value) {
+		return errors.New("value is not valid JSON")
+	}
+
+	service, err := c.load()
+	if err != nil {
+		return err
+	}
+
+	snapshot := rest.Snapshot{
+		Header: rest.SnapshotHeader{
+			Version: rest.SnapshotVersion,
+			Records: 1,
+		},
+		Records: []rest.SnapshotRecord{{Key: args[0], Value: value}},
+	}
+
+	result, err := service.Load(context.Background(), snapshot, rest.ImportMerge)
+	if err != nil {
+		return err
+	}
+
+	if err := c.save(service); err != nil {
+		return err
+	}
+	return c.print(result)
+}
+
+func (c *command) delete(args []string) error {
+	if len(args) != 1 {
+		return usageError("expected a key")
+	}
+
+	service, err := c.load()
+	if err != nil {
+		return err
+	}
+
+	model, err := service.Remove(context.Background(), args[0])
+	if err != nil {
+		return err
+	}
+
+	if err := c.save(service); err != nil {
+		return err
+	}
+	return c.print(model)
+}
+
+func (c *command) export(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	format := flags.String("format", string(rest.SnapshotNDJSON), "snapshot format, ndjson or json")
+	if err := flags.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+
+	service, err := c.load()
+	if err != nil {
+		return err
+	}
+	return service.Export(context.Background(), c.stdout, rest.SnapshotFormat(*format))
+}
+
+func (c *command) importSnapshot(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	format := flags.String("format", string(rest.SnapshotNDJSON), "snapshot format, ndjson or json")
+	mode := flags.String("mode", string(rest.ImportMerge), "import mode, replace, merge or skip-existing")
+	if err := flags.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+
+	service, err := c.snapshotFile().Load()
+	if err != nil {
+		return err
+	}
+	dict := service.(*rest.DictService)
+
+	result, err := dict.Import(context.Background(), c.stdin, rest.SnapshotFormat(*format), rest.ImportMode(*mode))
+	if err != nil {
+		return err
+	}
+
+	if err := c.save(dict); err != nil {
+		return err
+	}
+	return c.print(result)
+}
+
+// verify checks that the file is a valid snapshot with unique keys in order
+// whose values are valid Models of the type.
+func (c *command) verify(args []string) error {
+	snapshot, err := c.read()
+	if err != nil {
+		return err
+	}
+
+	dict := c.build().(*rest.DictService)
+	snapshot, _, err = dict.Migrations().Migrate(snapshot)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	seen := make(map[string]bool, len(snapshot.Records))
+	for i, record := range snapshot.Records {
+		if seen[record.Key] {
+			problems = append(problems, fmt.Sprintf("record %d: duplicate key '%s'", i+1, record.Key))
+		}
+		seen[record.Key] = true
+
+		if i > 0 && record.Key < snapshot.Records[i-1].Key {
+			problems = append(problems, fmt.Sprintf("record %d: key '%s' is out of order", i+1, record.Key))
+		}
+
+		model := c.typ.Build()
+		if err := json.Unmarshal(record.Value, &model); err != nil {
+			problems = append(problems, fmt.Sprintf("record %d: key '%s': %v", i+1, record.Key, err))
+			continue
+		}
+		if err := model.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("record %d: key '%s': %v", i+1, record.Key, err))
+		}
+	}
+
+	for _, problem := range problems {
+		fmt.Fprintln(c.stdout, problem)
+	}
+	if len(problems) > 0 {
+		return errors.Errorf("found %d problems in %d records", len(problems), len(snapshot.Records))
+	}
+
+	fmt.Fprintf(c.stdout, "ok: %d records\n", len(snapshot.Records))
+	return nil
+}
+
+func (c *command) migrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	dryRun := flags.Bool("dry-run", false, "report the changes without writing them")
+	if err := flags.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+
+	report, err := c.snapshotFile().DryRun()
+	if err != nil {
+		return err
+	}
+
+	if !*dryRun {
+		service, err := c.load()
+		if err != nil {
+			return err
+		}
+		if err := c.save(service); err != nil {
+			return err
+		}
+	}
+
+	return c.print(report)
+}
+
+func (c *command) purge(args []string) error {
+	service, err := c.load()
+	if err != nil {
+		return err
+	}
+
+	before, err := countRecords(c.file)
+	if err != nil {
+		return err
+	}
+
+	if _, err := service.Purge(context.Background()); err != nil {
+		return err
+	}
+
+	if err := c.save(service); err != nil {
+		return err
+	}
+
+	after, err := countRecords(c.file)
+	if err != nil {
+		return err
+	}
+
+	return c.print(map[string]int{"before": before, "after": after, "dropped": before - after})
+}
+
+func countRecords(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	snapshot, err := rest.ReadSnapshot(file, rest.SnapshotNDJSON)
+	if err != nil {
+		return 0, err
+	}
+	return len(snapshot.Records), nil
+}
@@ -0,0 +1,270 @@
+package restctl_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/ktnyt/go-rest/restctl"
+	"github.com/stretchr/testify/require"
+)
+
+type Note struct {
+	Key  string
+	Text string
+	Tag  string
+}
+
+func NewNote() rest.Model {
+	return &Note{}
+}
+
+func (n *Note) Validate() error {
+	if n.Text == "" {
+		return errors.New("note text is empty")
+	}
+	return nil
+}
+
+func (n *Note) MakeKey(i int) string {
+	return ""
+}
+
+func (n *Note) Merge(v interface{}) error {
+	return nil
+}
+
+func NoteMigrations() *rest.Migrations {
+	return rest.NewMigrations().
+		Register(1, "body to text", func(value map[string]interface{}) error {
+			if body, ok := value["Body"]; ok {
+				value["Text"] = body
+				delete(value, "Body")
+			}
+			return nil
+		})
+}
+
+func init() {
+	gob.Register(&Note{})
+	restctl.Register("note", NewNote, rest.WithMigrations(NoteMigrations()))
+}
+
+const notes = `{"version":1,"count":3,"records":3}
+{"key":"a","value":{"Key":"a","Body":"foo","Tag":"x"}}
+{"key":"b","value":{"Key":"b","Body":"bar","Tag":"y"},"deleted":"2020-01-01T00:00:00Z"}
+{"key":"c","value":{"Key":"c","Body":"baz","Tag":"x"}}
+`
+
+func TestRun(t *testing.T) {
+	writeFile := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "notes.ndjson")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+		return path
+	}
+
+	run := func(t *testing.T, stdin string, args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		code := restctl.Run(args, strings.NewReader(stdin), &stdout, &stderr)
+		return code, stdout.String(), stderr.String()
+	}
+
+	t.Run("lists and gets records", func(t *testing.T) {
+		path := writeFile(t, notes)
+
+		code, out, _ := run(t, "", "list", path)
+		require.Equal(t, 0, code)
+		require.Equal(t, 2, strings.Count(out, "\n"))
+
+		code, out, _ = run(t, "", "list", path, "Tag=x", "Body=baz")
+		require.Equal(t, 0, code)
+		require.JSONEq(t, `{"key":"c","value":{"Key":"c","Body":"baz","Tag":"x"}}`, out)
+
+		code, out, _ = run(t, "", "get", path, "a")
+		require.Equal(t, 0, code)
+		require.JSONEq(t, `{"Key":"a","Body":"foo","Tag":"x"}`, out)
+
+		code, _, errs := run(t, "", "get", path, "b")
+		require.Equal(t, 1, code)
+		require.Contains(t, errs, "restctl get:")
+	})
+
+	t.Run("puts and deletes records", func(t *testing.T) {
+		path := writeFile(t, notes)
+
+		code, out, _ := run(t, `{"Key":"d","Body":"qux"}`, "put", path, "d")
+		require.Equal(t, 0, code)
+		require.JSONEq(t, `{"created":1,"updated":0,"skipped":0,"removed":0}`, out)
+
+		code, _, _ = run(t, "", "put", path, "a", `{"Key":"a","Body":"quux"}`)
+		require.Equal(t, 0, code)
+
+		code, _, _ = run(t, "", "delete", path, "c")
+		require.Equal(t, 0, code)
+
+		code, out, _ = run(t, "", "list", path)
+		require.Equal(t, 0, code)
+		require.Contains(t, out, `"quux"`)
+		require.Contains(t, out, `"key":"d"`)
+		require.NotContains(t, out, `"key":"c"`)
+
+		code, _, _ = run(t, "", "put", path, "e", "{")
+		require.Equal(t, 1, code)
+
+		code, _, _ = run(t, "", "put", path, "7", `{"Key":"7","Body":"corge"}`)
+		require.Equal(t, 0, code)
+
+		file, err := os.Open(path)
+		require.NoError(t, err)
+		defer file.Close()
+		var header rest.SnapshotHeader
+		require.NoError(t, json.NewDecoder(file).Decode(&header))
+		require.Equal(t, 8, header.Count)
+	})
+
+	t.Run("exports and imports snapshots", func(t *testing.T) {
+		source := writeFile(t, notes)
+		target := filepath.Join(t.TempDir(), "copy.ndjson")
+
+		code, out, _ := run(t, "", "export", source)
+		require.Equal(t, 0, code)
+
+		code, result, _ := run(t, out, "import", target, "-mode", "replace")
+		require.Equal(t, 0, code)
+		require.JSONEq(t, `{"created":3,"updated":0,"skipped":0,"removed":0}`, result)
+
+		code, out, _ = run(t, "", "export", target, "-format", "json")
+		require.Equal(t, 0, code)
+		require.Contains(t, out, `"header"`)
+	})
+
+	t.Run("validates registered types", func(t *testing.T) {
+		path := writeFile(t, notes)
+
+		code, out, _ := run(t, "", "-type", "note", "verify", path)
+		require.Equal(t, 0, code)
+		require.Equal(t, "ok: 3 records\n", out)
+
+		code, _, _ = run(t, "", "-type", "note", "put", path, "d", `{"Key":"d"}`)
+		require.Equal(t, 1, code)
+
+		code, out, _ = run(t, "", "-type", "note", "get", path, "a")
+		require.Equal(t, 0, code)
+		require.JSONEq(t, `{"Key":"a","Text":"foo","Tag":"x"}`, out)
+
+		code, _, errs := run(t, "", "-type", "memo", "list", path)
+		require.Equal(t, 2, code)
+		require.Contains(t, errs, "unknown type 'memo'")
+	})
+
+	t.Run("reports integrity problems", func(t *testing.T) {
+		path := writeFile(t, `{"version":1,"count":3,"records":3}
+{"key":"b","value":{"Key":"b","Body":"bar"}}
+{"key":"a","value":{"Key":"a","Body":""}}
+{"key":"a","value":{"Key":"a","Body":"foo"}}
+`)
+
+		code, out, errs := run(t, "", "-type", "note", "verify", path)
+		require.Equal(t, 1, code)
+		require.Contains(t, out, "record 2: key 'a' is out of order")
+		require.Contains(t, out, "record 2: key 'a': note text is empty")
+		require.Contains(t, out, "record 3: duplicate key 'a'")
+		require.Contains(t, errs, "found 3 problems in 3 records")
+
+		path = writeFile(t, strings.Replace(notes, `"records":3`, `"records":4`, 1))
+		code, _, errs = run(t, "", "verify", path)
+		require.Equal(t, 1, code)
+		require.Contains(t, errs, "header lists 4 records but found 3")
+	})
+
+	t.Run("migrates and purges files", func(t *testing.T) {
+		path := writeFile(t, notes)
+
+		code, out, _ := run(t, "", "-type", "note", "migrate", path, "-dry-run")
+		require.Equal(t, 0, code)
+		require.JSONEq(t, `{"from":0,"to":1,"records":3,"steps":[{"version":1,"name":"body to text","touched":3}]}`, out)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, notes, string(data))
+
+		code, _, _ = run(t, "", "-type", "note", "migrate", path)
+		require.Equal(t, 0, code)
+
+		data, err = os.ReadFile(path)
+		require.NoError(t, err)
+		require.Contains(t, string(data), `"schema":1`)
+		require.NotContains(t, string(data), `"Body"`)
+
+		code, out, _ = run(t, "", "purge", path)
+		require.Equal(t, 0, code)
+		require.JSONEq(t, `{"before":3,"after":2,"dropped":1}`, out)
+
+		data, err = os.ReadFile(path)
+		require.NoError(t, err)
+		require.Contains(t, string(data), `"schema":1`)
+	})
+
+	t.Run("reads gob files", func(t *testing.T) {
+		snapshot, err := rest.ReadSnapshot(strings.NewReader(notes), rest.SnapshotNDJSON)
+		require.NoError(t, err)
+
+		filter := func(context.Context) rest.Filter { return func(interface{}) bool { return true } }
+		convert := func(value interface{}) rest.Model { return value.(rest.Model) }
+		dict := rest.NewDictService(NewNote, filter, convert, rest.WithMigrations(NoteMigrations())).(*rest.DictService)
+		_, err = dict.Load(context.Background(), snapshot, rest.ImportReplace)
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		require.NoError(t, gob.NewEncoder(&buf).Encode(dict))
+		path := writeFile(t, buf.String())
+
+		code, out, _ := run(t, "", "-type", "note", "-gob", "-schema", "1", "list", path, "Tag=x")
+		require.Equal(t, 0, code)
+		require.Equal(t, 2, strings.Count(out, "\n"))
+
+		code, out, _ = run(t, "", "-gob", "get", path, "a")
+		require.Equal(t, 0, code)
+		require.JSONEq(t, `{"Key":"a","Text":"foo","Tag":"x"}`, out)
+
+		code, out, _ = run(t, "", "-type", "note", "-gob", "verify", path)
+		require.Equal(t, 0, code)
+		require.Equal(t, "ok: 3 records\n", out)
+
+		code, out, _ = run(t, "", "-type", "note", "-gob", "export", path)
+		require.Equal(t, 0, code)
+		target := filepath.Join(t.TempDir(), "notes.ndjson")
+		code, _, _ = run(t, out, "-type", "note", "import", target)
+		require.Equal(t, 0, code)
+		code, out, _ = run(t, "", "-type", "note", "get", target, "c")
+		require.Equal(t, 0, code)
+		require.JSONEq(t, `{"Key":"c","Text":"baz","Tag":"x"}`, out)
+
+		code, _, errs := run(t, "", "-gob", "delete", path, "a")
+		require.Equal(t, 2, code)
+		require.Contains(t, errs, "cannot change gob files")
+
+		code, _, _ = run(t, "", "-gob", "list", writeFile(t, notes))
+		require.Equal(t, 1, code)
+	})
+
+	t.Run("rejects invalid usage", func(t *testing.T) {
+		code, _, errs := run(t, "", "list")
+		require.Equal(t, 2, code)
+		require.Contains(t, errs, "usage: restctl")
+
+		code, _, errs = run(t, "", "frobnicate", "notes.ndjson")
+		require.Equal(t, 2, code)
+		require.Contains(t, errs, "unknown command 'frobnicate'")
+
+		code, _, _ = run(t, "", "list", filepath.Join(t.TempDir(), "missing.ndjson"))
+		require.Equal(t, 1, code)
+	})
+}
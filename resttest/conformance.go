@@ -0,0 +1,423 @@
+// Package resttest provides utilities for testing Services and Interfaces.
+package resttest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// Fixtures describe the values a conformance suite works with.
+type Fixtures struct {
+	// Valid returns the JSON body of a new valid value. Every call should
+	// return a distinct value.
+	Valid func() []byte
+
+	// Invalid is the JSON body of a value which fails validation, both when
+	// creating and when merged into an existing value.
+	Invalid []byte
+
+	// Build creates an empty Model to decode responses into.
+	Build rest.ModelBuilder
+
+	// Key extracts the key of a Model.
+	Key func(rest.Model) string
+
+	// Filter is an optional context narrowing Browse and Delete down to the
+	// values Match returns true for. Filter checks are skipped if it is nil.
+	Filter func(context.Context) context.Context
+
+	// Match tests if a value is matched by the Filter.
+	Match func(rest.Model) bool
+
+	// Concurrency is the number of goroutines creating values at the same
+	// time. Concurrency checks are skipped if it is zero.
+	Concurrency int
+}
+
+// Count is the number of values created for checks on collections.
+const Count = 6
+
+// RunServiceConformance checks that the Services created by the builder
+// follow the semantics of the Service interface. Every check runs on a new
+// Service.
+func RunServiceConformance(t *testing.T, builder rest.ServiceBuilder, fixtures Fixtures) {
+	t.Helper()
+	ctx := context.Background()
+
+	populate := func(t *testing.T) (rest.Service, []rest.Model) {
+		t.Helper()
+		service := builder()
+		models := make([]rest.Model, Count)
+		for i := range models {
+			model, err := service.Create(ctx, bytes.NewReader(fixtures.Valid()))
+			require.NoError(t, err)
+			models[i] = model
+		}
+		return service, models
+	}
+
+	t.Run("creates values", func(t *testing.T) {
+		service := builder()
+
+		body := fixtures.Valid()
+		model, err := service.Create(ctx, bytes.NewReader(body))
+		require.NoError(t, err)
+		require.NotEmpty(t, fixtures.Key(model))
+
+		selected, err := service.Select(ctx, fixtures.Key(model))
+		require.NoError(t, err)
+		RequireSameJSON(t, model, selected)
+	})
+
+	t.Run("assigns distinct keys", func(t *testing.T) {
+		_, models := populate(t)
+		keys := make(map[string]bool)
+		for _, model := range models {
+			keys[fixtures.Key(model)] = true
+		}
+		require.Len(t, keys, Count)
+	})
+
+	t.Run("rejects invalid values", func(t *testing.T) {
+		service, _ := populate(t)
+
+		_, err := service.Create(ctx, bytes.NewReader(fixtures.Invalid))
+		RequireClientError(t, err)
+
+		_, err = service.Create(ctx, bytes.NewReader([]byte(`{`)))
+		RequireStatus(t, http.StatusBadRequest, err)
+
+		models, err := service.Browse(ctx)
+		require.NoError(t, err)
+		require.Len(t, models, Count)
+	})
+
+	t.Run("browses values", func(t *testing.T) {
+		service, created := populate(t)
+
+		models, err := service.Browse(ctx)
+		require.NoError(t, err)
+		require.ElementsMatch(t, keys(fixtures, created), keys(fixtures, models))
+	})
+
+	t.Run("selects existing values only", func(t *testing.T) {
+		service, created := populate(t)
+
+		for _, model := range created {
+			selected, err := service.Select(ctx, fixtures.Key(model))
+			require.NoError(t, err)
+			RequireSameJSON(t, model, selected)
+		}
+
+		_, err := service.Select(ctx, "missing")
+		RequireClientError(t, err)
+	})
+
+	t.Run("updates existing values only", func(t *testing.T) {
+		service, created := populate(t)
+		key := fixtures.Key(created[0])
+
+		model, err := service.Update(ctx, key, bytes.NewReader(fixtures.Valid()))
+		require.NoError(t, err)
+
+		selected, err := service.Select(ctx, key)
+		require.NoError(t, err)
+		RequireSameJSON(t, model, selected)
+
+		_, err = service.Update(ctx, "missing", bytes.NewReader(fixtures.Valid()))
+		RequireClientError(t, err)
+	})
+
+	t.Run("rolls back invalid updates", func(t *testing.T) {
+		service, created := populate(t)
+		key := fixtures.Key(created[0])
+
+		_, err := service.Update(ctx, key, bytes.NewReader(fixtures.Invalid))
+		RequireClientError(t, err)
+
+		selected, err := service.Select(ctx, key)
+		require.NoError(t, err)
+		RequireSameJSON(t, created[0], selected)
+	})
+
+	t.Run("modifies existing values only", func(t *testing.T) {
+		service, created := populate(t)
+		key := fixtures.Key(created[0])
+
+		model, err := service.Modify(ctx, key, bytes.NewReader(fixtures.Valid()))
+		require.NoError(t, err)
+		require.Equal(t, key, fixtures.Key(model))
+
+		selected, err := service.Select(ctx, key)
+		require.NoError(t, err)
+		RequireSameJSON(t, model, selected)
+
+		_, err = service.Modify(ctx, "missing", bytes.NewReader(fixtures.Valid()))
+		RequireClientError(t, err)
+	})
+
+	t.Run("rolls back invalid modifications", func(t *testing.T) {
+		service, created := populate(t)
+		key := fixtures.Key(created[0])
+
+		_, err := service.Modify(ctx, key, bytes.NewReader(fixtures.Invalid))
+		RequireClientError(t, err)
+
+		selected, err := service.Select(ctx, key)
+		require.NoError(t, err)
+		RequireSameJSON(t, created[0], selected)
+	})
+
+	t.Run("removes existing values only", func(t *testing.T) {
+		service, created := populate(t)
+		key := fixtures.Key(created[0])
+
+		model, err := service.Remove(ctx, key)
+		require.NoError(t, err)
+		RequireSameJSON(t, created[0], model)
+
+		_, err = service.Select(ctx, key)
+		RequireClientError(t, err)
+
+		_, err = service.Remove(ctx, key)
+		RequireClientError(t, err)
+
+		models, err := service.Browse(ctx)
+		require.NoError(t, err)
+		require.Len(t, models, Count-1)
+	})
+
+	t.Run("deletes values", func(t *testing.T) {
+		service, created := populate(t)
+
+		models, err := service.Delete(ctx)
+		require.NoError(t, err)
+		require.ElementsMatch(t, keys(fixtures, created), keys(fixtures, models))
+
+		models, err = service.Browse(ctx)
+		require.NoError(t, err)
+		require.Len(t, models, 0)
+	})
+
+	if fixtures.Filter != nil {
+		t.Run("filters values", func(t *testing.T) {
+			service, created := populate(t)
+
+			matched := make([]rest.Model, 0, len(created))
+			for _, model := range created {
+				if fixtures.Match(model) {
+					matched = append(matched, model)
+				}
+			}
+
+			models, err := service.Browse(fixtures.Filter(ctx))
+			require.NoError(t, err)
+			require.ElementsMatch(t, keys(fixtures, matched), keys(fixtures, models))
+
+			models, err = service.Delete(fixtures.Filter(ctx))
+			require.NoError(t, err)
+			require.ElementsMatch(t, keys(fixtures, matched), keys(fixtures, models))
+
+			models, err = service.Browse(ctx)
+			require.NoError(t, err)
+			require.Len(t, models, len(created)-len(matched))
+		})
+	}
+
+	t.Run("honors canceled contexts", func(t *testing.T) {
+		service, created := populate(t)
+		key := fixtures.Key(created[0])
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := service.Browse(canceled)
+		RequireStatus(t, rest.StatusClientClosedRequest, err)
+
+		_, err = service.Create(canceled, bytes.NewReader(fixtures.Valid()))
+		RequireStatus(t, rest.StatusClientClosedRequest, err)
+
+		_, err = service.Remove(canceled, key)
+		RequireStatus(t, rest.StatusClientClosedRequest, err)
+
+		models, err := service.Browse(ctx)
+		require.NoError(t, err)
+		require.Len(t, models, Count)
+	})
+
+	if fixtures.Concurrency > 0 {
+		t.Run("creates values concurrently", func(t *testing.T) {
+			service := builder()
+
+			var wg sync.WaitGroup
+			errs := make(chan error, fixtures.Concurrency)
+			for i := 0; i < fixtures.Concurrency; i++ {
+				body := fixtures.Valid()
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := service.Create(ctx, bytes.NewReader(body))
+					errs <- err
+				}()
+			}
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				require.NoError(t, err)
+			}
+
+			models, err := service.Browse(ctx)
+			require.NoError(t, err)
+			require.Len(t, models, fixtures.Concurrency)
+
+			unique := make(map[string]bool)
+			for _, key := range keys(fixtures, models) {
+				unique[key] = true
+			}
+			require.Len(t, unique, fixtures.Concurrency)
+		})
+	}
+}
+
+// RunInterfaceConformance checks that the Interfaces created by the builder
+// serve the Service semantics over HTTP with Problem responses for errors.
+// The primary key is injected into the request context as rest.PK.
+func RunInterfaceConformance(t *testing.T, builder func() rest.Interface, fixtures Fixtures) {
+	t.Helper()
+
+	populate := func(t *testing.T) (*Harness, []string) {
+		t.Helper()
+		h := NewHarness(t, builder())
+		created := make([]string, Count)
+		for i := range created {
+			res := h.Create(fixtures.Valid()).RequireStatus(http.StatusOK)
+			created[i] = jsonKey(t, fixtures, res.Body.Bytes())
+		}
+		return h, created
+	}
+
+	t.Run("creates values", func(t *testing.T) {
+		h, created := populate(t)
+
+		res := h.Select(created[0]).RequireStatus(http.StatusOK)
+		require.Equal(t, "application/json", res.Header().Get("Content-Type"))
+		require.Equal(t, created[0], jsonKey(t, fixtures, res.Body.Bytes()))
+	})
+
+	t.Run("responds with problems", func(t *testing.T) {
+		h, created := populate(t)
+
+		h.Create("{").RequireStatus(http.StatusBadRequest).Problem()
+		requireClientProblem(t, h.Create(fixtures.Invalid))
+		requireClientProblem(t, h.Select("missing"))
+		requireClientProblem(t, h.Update(created[0], fixtures.Invalid))
+		requireClientProblem(t, h.Modify("missing", fixtures.Valid()))
+		requireClientProblem(t, h.Remove("missing"))
+	})
+
+	t.Run("browses values", func(t *testing.T) {
+		h, created := populate(t)
+
+		res := h.Browse().RequireStatus(http.StatusOK)
+		require.ElementsMatch(t, created, jsonKeys(t, fixtures, res.Body.Bytes()))
+	})
+
+	t.Run("updates and modifies values", func(t *testing.T) {
+		h, created := populate(t)
+
+		h.Update(created[0], fixtures.Valid()).RequireStatus(http.StatusOK)
+
+		res := h.Modify(created[1], fixtures.Valid()).RequireStatus(http.StatusOK)
+		require.Equal(t, created[1], jsonKey(t, fixtures, res.Body.Bytes()))
+	})
+
+	t.Run("removes values", func(t *testing.T) {
+		h, created := populate(t)
+
+		res := h.Remove(created[0]).RequireStatus(http.StatusOK)
+		require.Equal(t, created[0], jsonKey(t, fixtures, res.Body.Bytes()))
+
+		res = h.Browse().RequireStatus(http.StatusOK)
+		require.ElementsMatch(t, created[1:], jsonKeys(t, fixtures, res.Body.Bytes()))
+	})
+
+	t.Run("guards unfiltered deletes", func(t *testing.T) {
+		h, created := populate(t)
+
+		h.Delete().RequireStatus(http.StatusBadRequest).Problem()
+
+		res := h.Delete(Query(rest.AllParam, "true")).RequireStatus(http.StatusOK)
+		require.ElementsMatch(t, created, jsonKeys(t, fixtures, res.Body.Bytes()))
+	})
+}
+
+// RequireStatus requires the error to be a ServiceError with the status code.
+func RequireStatus(t testing.TB, code int, err error) {
+	t.Helper()
+	require.Error(t, err)
+	serviceErr, ok := errors.Cause(err).(rest.ServiceError)
+	require.True(t, ok, "expected a ServiceError, got %T: %v", err, err)
+	require.Equal(t, code, serviceErr.Code, serviceErr.Error())
+}
+
+// RequireClientError requires the error to be a ServiceError with a 4xx
+// status code.
+func RequireClientError(t testing.TB, err error) {
+	t.Helper()
+	require.Error(t, err)
+	serviceErr, ok := errors.Cause(err).(rest.ServiceError)
+	require.True(t, ok, "expected a ServiceError, got %T: %v", err, err)
+	require.True(t, serviceErr.Code >= 400 && serviceErr.Code < 500, "expected a 4xx status code, got %d", serviceErr.Code)
+}
+
+// RequireSameJSON requires the values to have the same JSON encoding.
+func RequireSameJSON(t testing.TB, expected, actual interface{}) {
+	t.Helper()
+	a, err := json.Marshal(expected)
+	require.NoError(t, err)
+	b, err := json.Marshal(actual)
+	require.NoError(t, err)
+	require.JSONEq(t, string(a), string(b))
+}
+
+func requireClientProblem(t *testing.T, res *Response) {
+	t.Helper()
+	require.True(t, res.Code >= 400 && res.Code < 500, "expected a 4xx status code, got %d", res.Code)
+	res.Problem()
+}
+
+func keys(fixtures Fixtures, models []rest.Model) []string {
+	list := make([]string, len(models))
+	for i, model := range models {
+		list[i] = fixtures.Key(model)
+	}
+	return list
+}
+
+// jsonKey extracts the key from a JSON encoded value.
+func jsonKey(t *testing.T, fixtures Fixtures, data []byte) string {
+	t.Helper()
+	model := fixtures.Build()
+	require.NoError(t, json.Unmarshal(data, model))
+	return fixtures.Key(model)
+}
+
+func jsonKeys(t *testing.T, fixtures Fixtures, data []byte) []string {
+	t.Helper()
+	var list []json.RawMessage
+	require.NoError(t, json.Unmarshal(data, &list))
+	keys := make([]string, len(list))
+	for i, raw := range list {
+		keys[i] = jsonKey(t, fixtures, raw)
+	}
+	return keys
+}
@@ -0,0 +1,191 @@
+package resttest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+	"testing"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/stretchr/testify/require"
+)
+
+// Call records a call to a FakeService.
+type Call struct {
+	Op     rest.Operation
+	Key    string
+	Body   []byte
+	Params url.Values
+}
+
+type result struct {
+	models []rest.Model
+	err    error
+}
+
+// FakeService is a Service which records every call and returns the results
+// programmed for each operation. Operations without a programmed result
+// return no values and no error.
+type FakeService struct {
+	mu      sync.Mutex
+	calls   []Call
+	results map[rest.Operation][]result
+}
+
+// NewFakeService creates a new FakeService.
+func NewFakeService() *FakeService {
+	return &FakeService{results: make(map[rest.Operation][]result)}
+}
+
+// Returns programs the operation to return the models. Browse and Delete
+// return all of them and the other operations return the first one. Results
+// programmed more than once are returned in order, with the last one
+// repeating.
+func (f *FakeService) Returns(op rest.Operation, models ...rest.Model) *FakeService {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.results[op] = append(f.results[op], result{models: models})
+	return f
+}
+
+// Fails programs the operation to return the error, e.g. a ServiceError.
+func (f *FakeService) Fails(op rest.Operation, err error) *FakeService {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.results[op] = append(f.results[op], result{err: err})
+	return f
+}
+
+// Reset forgets the recorded calls and programmed results.
+func (f *FakeService) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = nil
+	f.results = make(map[rest.Operation][]result)
+}
+
+// Calls returns the recorded calls, or only the calls to the given
+// operations if any.
+func (f *FakeService) Calls(ops ...rest.Operation) []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(ops) == 0 {
+		return append([]Call(nil), f.calls...)
+	}
+
+	calls := make([]Call, 0, len(f.calls))
+	for _, call := range f.calls {
+		for _, op := range ops {
+			if call.Op == op {
+				calls = append(calls, call)
+			}
+		}
+	}
+	return calls
+}
+
+// AssertCalled requires the operation to have been called for the key. The
+// key is ignored for Browse, Delete and Create.
+func (f *FakeService) AssertCalled(t testing.TB, op rest.Operation, key string) Call {
+	t.Helper()
+	for _, call := range f.Calls(op) {
+		if call.Key == key {
+			return call
+		}
+	}
+	require.FailNow(t, fmt.Sprintf("%s was not called for key %q", op, key), "calls: %v", f.Calls())
+	return Call{}
+}
+
+// AssertNotCalled requires the operation not to have been called.
+func (f *FakeService) AssertNotCalled(t testing.TB, op rest.Operation) {
+	t.Helper()
+	require.Empty(t, f.Calls(op), "%s was called", op)
+}
+
+// AssertCalls requires the operation to have been called n times.
+func (f *FakeService) AssertCalls(t testing.TB, op rest.Operation, n int) {
+	t.Helper()
+	require.Len(t, f.Calls(op), n, "number of calls to %s", op)
+}
+
+// record the call and return the programmed result.
+func (f *FakeService) record(ctx context.Context, op rest.Operation, key string, reader io.Reader) result {
+	call := Call{Op: op, Key: key, Params: rest.ExtractParams(ctx)}
+	if reader != nil {
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			return result{err: err}
+		}
+		call.Body = body
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, call)
+
+	results := f.results[op]
+	if len(results) == 0 {
+		return result{}
+	}
+	if len(results) > 1 {
+		f.results[op] = results[1:]
+	}
+	return results[0]
+}
+
+func (r result) one() (rest.Model, error) {
+	if r.err != nil || len(r.models) == 0 {
+		return nil, r.err
+	}
+	return r.models[0], nil
+}
+
+func (r result) all() ([]rest.Model, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.models == nil {
+		return []rest.Model{}, nil
+	}
+	return r.models, nil
+}
+
+// Browse records the call and returns the programmed result.
+func (f *FakeService) Browse(ctx context.Context) ([]rest.Model, error) {
+	return f.record(ctx, rest.OpBrowse, "", nil).all()
+}
+
+// Delete records the call and returns the programmed result.
+func (f *FakeService) Delete(ctx context.Context) ([]rest.Model, error) {
+	return f.record(ctx, rest.OpDelete, "", nil).all()
+}
+
+// Create records the call and returns the programmed result.
+func (f *FakeService) Create(ctx context.Context, reader io.Reader) (rest.Model, error) {
+	return f.record(ctx, rest.OpCreate, "", reader).one()
+}
+
+// Select records the call and returns the programmed result.
+func (f *FakeService) Select(ctx context.Context, key string) (rest.Model, error) {
+	return f.record(ctx, rest.OpSelect, key, nil).one()
+}
+
+// Remove records the call and returns the programmed result.
+func (f *FakeService) Remove(ctx context.Context, key string) (rest.Model, error) {
+	return f.record(ctx, rest.OpRemove, key, nil).one()
+}
+
+// Update records the call and returns the programmed result.
+func (f *FakeService) Update(ctx context.Context, key string, reader io.Reader) (rest.Model, error) {
+	return f.record(ctx, rest.OpUpdate, key, reader).one()
+}
+
+// Modify records the call and returns the programmed result.
+func (f *FakeService) Modify(ctx context.Context, key string, reader io.Reader) (rest.Model, error) {
+	return f.record(ctx, rest.OpModify, key, reader).one()
+}
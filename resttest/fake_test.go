@@ -0,0 +1,82 @@
+package resttest_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/ktnyt/go-rest/resttest"
+	"github.com/stretchr/testify/require"
+)
+
+type Note struct {
+	Key  string
+	Text string
+}
+
+func (n *Note) Validate() error {
+	if n.Text == "" {
+		return errors.New("note text is empty")
+	}
+	return nil
+}
+
+func (n *Note) MakeKey(i int) string {
+	return ""
+}
+
+func (n *Note) Merge(v interface{}) error {
+	return nil
+}
+
+func TestFakeService(t *testing.T) {
+	t.Run("records calls", func(t *testing.T) {
+		fake := resttest.NewFakeService()
+		fake.Returns(rest.OpCreate, &Note{Key: "a", Text: "foo"})
+
+		h := resttest.NewHarness(t, rest.NewServiceInterface(fake))
+		res := h.Create(Note{Text: "foo"}, resttest.Query("tag", "bar")).RequireStatus(http.StatusOK)
+
+		var note Note
+		res.Decode(&note)
+		require.Equal(t, Note{Key: "a", Text: "foo"}, note)
+
+		call := fake.AssertCalled(t, rest.OpCreate, "")
+		require.JSONEq(t, `{"Key":"","Text":"foo"}`, string(call.Body))
+		require.Equal(t, "bar", call.Params.Get("tag"))
+		fake.AssertCalls(t, rest.OpCreate, 1)
+		fake.AssertNotCalled(t, rest.OpRemove)
+	})
+
+	t.Run("returns programmed results in order", func(t *testing.T) {
+		fake := resttest.NewFakeService()
+		fake.Returns(rest.OpSelect, &Note{Key: "a", Text: "foo"})
+		fake.Fails(rest.OpSelect, rest.NewServiceError(errors.New("gone"), http.StatusNotFound))
+
+		h := resttest.NewHarness(t, rest.NewServiceInterface(fake))
+		h.Select("a").RequireStatus(http.StatusOK)
+		h.Select("a").RequireStatus(http.StatusNotFound).Problem()
+		h.Select("b").RequireStatus(http.StatusNotFound).Problem()
+
+		fake.AssertCalled(t, rest.OpSelect, "b")
+		fake.AssertCalls(t, rest.OpSelect, 3)
+		require.Len(t, fake.Calls(rest.OpSelect, rest.OpBrowse), 3)
+
+		fake.Reset()
+		require.Empty(t, fake.Calls())
+	})
+
+	t.Run("returns empty lists by default", func(t *testing.T) {
+		fake := resttest.NewFakeService()
+
+		h := resttest.NewHarness(t, rest.NewServiceInterface(fake))
+		res := h.Browse().RequireStatus(http.StatusOK)
+		require.JSONEq(t, `[]`, res.Body.String())
+
+		h.Delete().RequireStatus(http.StatusBadRequest)
+		fake.AssertNotCalled(t, rest.OpDelete)
+		h.Delete(resttest.Query(rest.AllParam, "true")).RequireStatus(http.StatusOK)
+		fake.AssertCalls(t, rest.OpDelete, 1)
+	})
+}
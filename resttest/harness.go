@@ -0,0 +1,159 @@
+package resttest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/stretchr/testify/require"
+)
+
+// RequestOption modifies a request built by a Harness.
+type RequestOption func(*http.Request) *http.Request
+
+// Query adds a URL query parameter to the request.
+func Query(name, value string) RequestOption {
+	return func(r *http.Request) *http.Request {
+		query := r.URL.Query()
+		query.Add(name, value)
+		r.URL.RawQuery = query.Encode()
+		return r
+	}
+}
+
+// Header sets a header of the request.
+func Header(name, value string) RequestOption {
+	return func(r *http.Request) *http.Request {
+		r.Header.Set(name, value)
+		return r
+	}
+}
+
+// ContextValue sets a value in the request context, e.g. a path parameter.
+func ContextValue(key, value interface{}) RequestOption {
+	return func(r *http.Request) *http.Request {
+		return r.WithContext(context.WithValue(r.Context(), key, value))
+	}
+}
+
+// Harness drives an Interface with requests for each of its operations.
+type Harness struct {
+	t       testing.TB
+	iface   rest.Interface
+	pkparam string
+}
+
+// NewHarness creates a Harness for the Interface which injects the primary
+// key into the request context as rest.PK.
+func NewHarness(t testing.TB, iface rest.Interface) *Harness {
+	return NewHarnessWithPKParam(t, iface, rest.PK)
+}
+
+// NewHarnessWithPKParam creates a Harness for the Interface which injects the
+// primary key into the request context as the given parameter.
+func NewHarnessWithPKParam(t testing.TB, iface rest.Interface, pkparam string) *Harness {
+	return &Harness{t: t, iface: iface, pkparam: pkparam}
+}
+
+// Browse sends a Browse request.
+func (h *Harness) Browse(opts ...RequestOption) *Response {
+	return h.do(h.iface.Browse, http.MethodGet, "", nil, opts)
+}
+
+// Delete sends a Delete request.
+func (h *Harness) Delete(opts ...RequestOption) *Response {
+	return h.do(h.iface.Delete, http.MethodDelete, "", nil, opts)
+}
+
+// Create sends a Create request. The body is sent as is if it is a []byte
+// or string and encoded as JSON otherwise.
+func (h *Harness) Create(body interface{}, opts ...RequestOption) *Response {
+	return h.do(h.iface.Create, http.MethodPost, "", body, opts)
+}
+
+// Select sends a Select request for the key.
+func (h *Harness) Select(key string, opts ...RequestOption) *Response {
+	return h.do(h.iface.Select, http.MethodGet, key, nil, opts)
+}
+
+// Remove sends a Remove request for the key.
+func (h *Harness) Remove(key string, opts ...RequestOption) *Response {
+	return h.do(h.iface.Remove, http.MethodDelete, key, nil, opts)
+}
+
+// Update sends an Update request for the key.
+func (h *Harness) Update(key string, body interface{}, opts ...RequestOption) *Response {
+	return h.do(h.iface.Update, http.MethodPut, key, body, opts)
+}
+
+// Modify sends a Modify request for the key.
+func (h *Harness) Modify(key string, body interface{}, opts ...RequestOption) *Response {
+	return h.do(h.iface.Modify, http.MethodPatch, key, body, opts)
+}
+
+func (h *Harness) do(handler http.HandlerFunc, method, key string, body interface{}, opts []RequestOption) *Response {
+	h.t.Helper()
+
+	var reader io.Reader
+	switch body := body.(type) {
+	case nil:
+	case []byte:
+		reader = bytes.NewReader(body)
+	case string:
+		reader = bytes.NewReader([]byte(body))
+	default:
+		data, err := json.Marshal(body)
+		require.NoError(h.t, err)
+		reader = bytes.NewReader(data)
+	}
+
+	r := httptest.NewRequest(method, "/", reader)
+	if reader != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if key != "" {
+		r = r.WithContext(context.WithValue(r.Context(), h.pkparam, key))
+	}
+	for _, opt := range opts {
+		r = opt(r)
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return &Response{ResponseRecorder: w, t: h.t}
+}
+
+// Response is the recorded response to a Harness request.
+type Response struct {
+	*httptest.ResponseRecorder
+	t testing.TB
+}
+
+// RequireStatus requires the response to have the status code.
+func (r *Response) RequireStatus(code int) *Response {
+	r.t.Helper()
+	require.Equal(r.t, code, r.Code, r.Body.String())
+	return r
+}
+
+// Decode the JSON response body into v.
+func (r *Response) Decode(v interface{}) {
+	r.t.Helper()
+	require.NoError(r.t, json.Unmarshal(r.Body.Bytes(), v))
+}
+
+// Problem requires the response to be a Problem and decodes it.
+func (r *Response) Problem() rest.Problem {
+	r.t.Helper()
+	require.Equal(r.t, rest.ProblemContentType, r.Header().Get("Content-Type"))
+
+	var problem rest.Problem
+	r.Decode(&problem)
+	require.Equal(r.t, r.Code, problem.Status)
+	return problem
+}
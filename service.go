@@ -6,6 +6,11 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 // ServiceError is an error with an associated HTTP status code.
@@ -24,29 +29,124 @@ func (e ServiceError) Error() string {
 	return fmt.Sprintf("%d: %s", e.Code, e.Err.Error())
 }
 
-// HandleError handles the given error gracefully.
+// HandleError handles the given error gracefully by responding with a
+// Problem. Returns false if there is no error.
 func HandleError(err error, w http.ResponseWriter) bool {
-	switch err := err.(type) {
+	switch cause := errors.Cause(err).(type) {
 	case ServiceError:
-		http.Error(w, err.Error(), err.Code)
+		WriteProblem(w, ErrorProblem(cause))
 		return true
 	case nil:
 		return false
 	default:
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteProblem(w, NewProblem(http.StatusInternalServerError, err.Error()))
 		return true
 	}
 }
 
+// ErrorProblem creates a Problem describing the given ServiceError. A Problem
+// wrapped by the ServiceError, e.g. one received by a Client, is passed on.
+func ErrorProblem(err ServiceError) Problem {
+	if problem, ok := errors.Cause(err.Err).(Problem); ok {
+		problem.Status = err.Code
+		return problem
+	}
+
+	problem := NewProblem(err.Code, err.Err.Error())
+	if e, ok := errors.Cause(err.Err).(DecodeError); ok {
+		problem = problem.With("offset", e.Offset)
+		if e.Field != "" {
+			problem = problem.With("field", e.Field)
+		}
+	}
+	return problem
+}
+
 // Service defines interfaces for manipulating values for a persistence backend.
 type Service interface {
 	Browse(context.Context) ([]Model, error)
 	Delete(context.Context) ([]Model, error)
-	Create(io.Reader) (Model, error)
-	Select(string) (Model, error)
-	Remove(string) (Model, error)
-	Update(string, io.Reader) (Model, error)
-	Modify(string, io.Reader) (Model, error)
+	Create(context.Context, io.Reader) (Model, error)
+	Select(context.Context, string) (Model, error)
+	Remove(context.Context, string) (Model, error)
+	Update(context.Context, string, io.Reader) (Model, error)
+	Modify(context.Context, string, io.Reader) (Model, error)
+}
+
+// StatusClientClosedRequest is the non-standard status code used when the
+// client cancels a request before it completes.
+const StatusClientClosedRequest = 499
+
+// CheckContext returns a ServiceError if the context is done, so that a
+// Service can stop working on a canceled or timed out request.
+func CheckContext(ctx context.Context) error {
+	switch err := ctx.Err(); err {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return NewServiceError(err, http.StatusGatewayTimeout)
+	default:
+		return NewServiceError(err, StatusClientClosedRequest)
+	}
+}
+
+// IncludeDeletedParam is the URL parameter for including soft deleted values.
+const IncludeDeletedParam = "includeDeleted"
+
+// SoftDeleter defines interfaces for services which tombstone removed values.
+type SoftDeleter interface {
+	SelectWithDeleted(context.Context, string) (Model, error)
+	Restore(context.Context, string) (Model, error)
+	Purge(context.Context) ([]Model, error)
+}
+
+// RevisionParam is the URL parameter for selecting a revision of a value.
+const RevisionParam = "revision"
+
+// Revision operations.
+const (
+	RevisionCreate = "create"
+	RevisionUpdate = "update"
+	RevisionModify = "modify"
+	RevisionRevert = "revert"
+)
+
+// Revision is a recorded state of a value.
+type Revision struct {
+	Number int       `json:"number"`
+	Time   time.Time `json:"time"`
+	Op     string    `json:"op"`
+	Value  Model     `json:"value"`
+}
+
+// Reverter defines interfaces for services which keep a revision history.
+type Reverter interface {
+	Revisions(context.Context, string) ([]Revision, error)
+	SelectRevision(context.Context, string, int) (Model, error)
+	Revert(context.Context, string, int) (Model, error)
+}
+
+// TTLHeader is the request header for setting the time-to-live of a value.
+// The value is either a Go duration string or a number of seconds.
+const TTLHeader = "X-TTL"
+
+// TTLModel is implemented by Models which expire after a time-to-live.
+type TTLModel interface {
+	// TTL returns the time-to-live of the Model.
+	TTL() time.Duration
+}
+
+// Expired describes a value removed because its time-to-live has passed.
+type Expired struct {
+	Key   string
+	Model Model
+	Time  time.Time
+}
+
+// Expirer defines interfaces for services which support expiring values.
+type Expirer interface {
+	CreateWithTTL(context.Context, io.Reader, time.Duration) (Model, error)
+	UpdateWithTTL(context.Context, string, io.Reader, time.Duration) (Model, error)
 }
 
 // PK is the default primary key.
@@ -56,19 +156,46 @@ const PK = "pk"
 type ServiceBuilder func() Service
 
 type serviceInterface struct {
-	service Service
-	pkparam string
+	service         Service
+	pkparam         string
+	allowUnfiltered bool
+	registry        *Registry
+}
+
+// InterfaceOption configures an Interface created by NewServiceInterface.
+type InterfaceOption func(*serviceInterface)
+
+// AllowUnfilteredDelete lets the Delete handler remove whole collections
+// without requiring the AllParam.
+func AllowUnfilteredDelete() InterfaceOption {
+	return func(i *serviceInterface) {
+		i.allowUnfiltered = true
+	}
+}
+
+// WithRegistry lets the Browse and Select handlers expand the references
+// requested by the ExpandParam against the Registry.
+func WithRegistry(registry *Registry) InterfaceOption {
+	return func(i *serviceInterface) {
+		i.registry = registry
+	}
 }
 
 // NewServiceInterface creates an Interface wrapped around the given Service.
-func NewServiceInterface(service Service) Interface {
-	return NewServiceInterfaceWithPKParam(service, PK)
+// The Delete handler is guarded by GuardDelete.
+func NewServiceInterface(service Service, opts ...InterfaceOption) Interface {
+	return NewServiceInterfaceWithPKParam(service, PK, opts...)
 }
 
 // NewServiceInterfaceWithPKParam creates a ServiceInterface for the given
 // primary key parameter value.
-func NewServiceInterfaceWithPKParam(service Service, pkparam string) Interface {
-	return serviceInterface{service: service, pkparam: pkparam}
+func NewServiceInterfaceWithPKParam(service Service, pkparam string, opts ...InterfaceOption) Interface {
+	i := serviceInterface{pkparam: pkparam}
+	for _, opt := range opts {
+		opt(&i)
+	}
+	i.service = GuardDelete(i.allowUnfiltered)(service)
+	return i
 }
 
 func (i serviceInterface) Browse(w http.ResponseWriter, r *http.Request) {
@@ -78,8 +205,7 @@ func (i serviceInterface) Browse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	HandleError(json.NewEncoder(w).Encode(list), w)
+	i.encodeFields(w, r, list)
 }
 
 func (i serviceInterface) Delete(w http.ResponseWriter, r *http.Request) {
@@ -94,7 +220,18 @@ func (i serviceInterface) Delete(w http.ResponseWriter, r *http.Request) {
 }
 
 func (i serviceInterface) Create(w http.ResponseWriter, r *http.Request) {
-	item, err := i.service.Create(r.Body)
+	ctx := InjectParams(r.Context(), r.URL.Query())
+	ttl, err := parseTTL(r.Header.Get(TTLHeader))
+	if HandleError(err, w) {
+		return
+	}
+
+	var item Model
+	if ttl > 0 {
+		item, err = asExpirer(i.service).CreateWithTTL(ctx, r.Body, ttl)
+	} else {
+		item, err = i.service.Create(ctx, r.Body)
+	}
 	if HandleError(err, w) {
 		return
 	}
@@ -104,19 +241,28 @@ func (i serviceInterface) Create(w http.ResponseWriter, r *http.Request) {
 }
 
 func (i serviceInterface) Select(w http.ResponseWriter, r *http.Request) {
-	pk := r.Context().Value(i.pkparam).(string)
-	item, err := i.service.Select(pk)
+	ctx := InjectParams(r.Context(), r.URL.Query())
+	pk, err := i.primaryKey(r)
 	if HandleError(err, w) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	HandleError(json.NewEncoder(w).Encode(item), w)
+	item, err := i.selectWithParams(ctx, pk)
+	if HandleError(err, w) {
+		return
+	}
+
+	i.encodeFields(w, r, item)
 }
 
 func (i serviceInterface) Remove(w http.ResponseWriter, r *http.Request) {
-	pk := r.Context().Value(i.pkparam).(string)
-	item, err := i.service.Remove(pk)
+	ctx := InjectParams(r.Context(), r.URL.Query())
+	pk, err := i.primaryKey(r)
+	if HandleError(err, w) {
+		return
+	}
+
+	item, err := i.service.Remove(ctx, pk)
 	if HandleError(err, w) {
 		return
 	}
@@ -126,8 +272,23 @@ func (i serviceInterface) Remove(w http.ResponseWriter, r *http.Request) {
 }
 
 func (i serviceInterface) Update(w http.ResponseWriter, r *http.Request) {
-	pk := r.Context().Value(i.pkparam).(string)
-	item, err := i.service.Update(pk, r.Body)
+	ctx := InjectParams(r.Context(), r.URL.Query())
+	pk, err := i.primaryKey(r)
+	if HandleError(err, w) {
+		return
+	}
+
+	ttl, err := parseTTL(r.Header.Get(TTLHeader))
+	if HandleError(err, w) {
+		return
+	}
+
+	var item Model
+	if ttl > 0 {
+		item, err = asExpirer(i.service).UpdateWithTTL(ctx, pk, r.Body, ttl)
+	} else {
+		item, err = i.service.Update(ctx, pk, r.Body)
+	}
 	if HandleError(err, w) {
 		return
 	}
@@ -137,8 +298,66 @@ func (i serviceInterface) Update(w http.ResponseWriter, r *http.Request) {
 }
 
 func (i serviceInterface) Modify(w http.ResponseWriter, r *http.Request) {
-	pk := r.Context().Value(i.pkparam).(string)
-	item, err := i.service.Modify(pk, r.Body)
+	ctx := InjectParams(r.Context(), r.URL.Query())
+	pk, err := i.primaryKey(r)
+	if HandleError(err, w) {
+		return
+	}
+
+	item, err := i.service.Modify(ctx, pk, r.Body)
+	if HandleError(err, w) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	HandleError(json.NewEncoder(w).Encode(item), w)
+}
+
+func (i serviceInterface) Restore(w http.ResponseWriter, r *http.Request) {
+	ctx := InjectParams(r.Context(), r.URL.Query())
+	pk, err := i.primaryKey(r)
+	if HandleError(err, w) {
+		return
+	}
+
+	item, err := asSoftDeleter(i.service).Restore(ctx, pk)
+	if HandleError(err, w) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	HandleError(json.NewEncoder(w).Encode(item), w)
+}
+
+func (i serviceInterface) Revisions(w http.ResponseWriter, r *http.Request) {
+	ctx := InjectParams(r.Context(), r.URL.Query())
+	pk, err := i.primaryKey(r)
+	if HandleError(err, w) {
+		return
+	}
+
+	list, err := asReverter(i.service).Revisions(ctx, pk)
+	if HandleError(err, w) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	HandleError(json.NewEncoder(w).Encode(list), w)
+}
+
+func (i serviceInterface) Revert(w http.ResponseWriter, r *http.Request) {
+	ctx := InjectParams(r.Context(), r.URL.Query())
+	pk, err := i.primaryKey(r)
+	if HandleError(err, w) {
+		return
+	}
+
+	number, err := revisionNumber(r.URL.Query())
+	if HandleError(err, w) {
+		return
+	}
+
+	item, err := asReverter(i.service).Revert(ctx, pk, number)
 	if HandleError(err, w) {
 		return
 	}
@@ -146,3 +365,178 @@ func (i serviceInterface) Modify(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	HandleError(json.NewEncoder(w).Encode(item), w)
 }
+
+// primaryKey extracts the primary key from the request context.
+func (i serviceInterface) primaryKey(r *http.Request) (string, error) {
+	pk, ok := r.Context().Value(i.pkparam).(string)
+	if !ok {
+		err := fmt.Errorf("primary key parameter '%s' is missing from the request context", i.pkparam)
+		return "", NewServiceError(err, http.StatusInternalServerError)
+	}
+	return pk, nil
+}
+
+// parseTTL parses the value of a TTLHeader. Returns zero for an empty value
+// and a ServiceError with status code 400 for a non-positive TTL.
+func parseTTL(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	seconds, err := strconv.Atoi(value)
+	ttl := time.Duration(seconds) * time.Second
+	if err != nil {
+		ttl, err = time.ParseDuration(value)
+	}
+	if err != nil {
+		err = errors.Wrapf(err, "invalid %s header", TTLHeader)
+		return 0, NewServiceError(err, http.StatusBadRequest)
+	}
+
+	if ttl <= 0 {
+		err := errors.Errorf("%s header must be positive", TTLHeader)
+		return 0, NewServiceError(err, http.StatusBadRequest)
+	}
+
+	return ttl, nil
+}
+
+// revisionNumber parses the revision number from the URL parameters.
+func revisionNumber(params url.Values) (int, error) {
+	number, err := strconv.Atoi(params.Get(RevisionParam))
+	if err != nil {
+		err = errors.Wrapf(err, "invalid %s parameter", RevisionParam)
+		return 0, NewServiceError(err, http.StatusBadRequest)
+	}
+	return number, nil
+}
+
+// selectWithParams selects a value honoring the URL parameters.
+func (i serviceInterface) selectWithParams(ctx context.Context, pk string) (Model, error) {
+	params := ExtractParams(ctx)
+	if _, ok := params[RevisionParam]; ok {
+		number, err := revisionNumber(params)
+		if err != nil {
+			return nil, err
+		}
+		return asReverter(i.service).SelectRevision(ctx, pk, number)
+	}
+	if ParamEnabled(ctx, IncludeDeletedParam) {
+		return asSoftDeleter(i.service).SelectWithDeleted(ctx, pk)
+	}
+	return i.service.Select(ctx, pk)
+}
+
+// asSoftDeleter returns the service as a SoftDeleter, or a SoftDeleter which
+// reports every operation as not implemented if the service is not one.
+func asSoftDeleter(service Service) SoftDeleter {
+	if s, ok := service.(SoftDeleter); ok {
+		return s
+	}
+	return unsupportedSoftDeleter{}
+}
+
+// asReverter returns the service as a Reverter, or a Reverter which
+// reports every operation as not implemented if the service is not one.
+func asReverter(service Service) Reverter {
+	if s, ok := service.(Reverter); ok {
+		return s
+	}
+	return unsupportedReverter{}
+}
+
+// asExpirer returns the service as an Expirer, or an Expirer which
+// reports every operation as not implemented if the service is not one.
+func asExpirer(service Service) Expirer {
+	if s, ok := service.(Expirer); ok {
+		return s
+	}
+	return unsupportedExpirer{}
+}
+
+type unsupportedSoftDeleter struct{}
+
+func (unsupportedSoftDeleter) SelectWithDeleted(context.Context, string) (Model, error) {
+	return nil, errNotSoftDeleter
+}
+
+func (unsupportedSoftDeleter) Restore(context.Context, string) (Model, error) {
+	return nil, errNotSoftDeleter
+}
+
+func (unsupportedSoftDeleter) Purge(context.Context) ([]Model, error) {
+	return nil, errNotSoftDeleter
+}
+
+type unsupportedReverter struct{}
+
+func (unsupportedReverter) Revisions(context.Context, string) ([]Revision, error) {
+	return nil, errNotReverter
+}
+
+func (unsupportedReverter) SelectRevision(context.Context, string, int) (Model, error) {
+	return nil, errNotReverter
+}
+
+func (unsupportedReverter) Revert(context.Context, string, int) (Model, error) {
+	return nil, errNotReverter
+}
+
+type unsupportedExpirer struct{}
+
+func (unsupportedExpirer) CreateWithTTL(context.Context, io.Reader, time.Duration) (Model, error) {
+	return nil, errNotExpirer
+}
+
+func (unsupportedExpirer) UpdateWithTTL(context.Context, string, io.Reader, time.Duration) (Model, error) {
+	return nil, errNotExpirer
+}
+
+var errNotSoftDeleter = NewServiceError(
+	errors.New("service does not support soft deletion"),
+	http.StatusNotImplemented,
+)
+
+var errNotReverter = NewServiceError(
+	errors.New("service does not keep revisions"),
+	http.StatusNotImplemented,
+)
+
+var errNotExpirer = NewServiceError(
+	errors.New("service does not support expiring values"),
+	http.StatusNotImplemented,
+)
+
+// encodeFields encodes the value with the requested references expanded,
+// restricted to the requested sparse fieldset. The fields other than the
+// expanded references are checked against the type of the value first, as
+// the expanded value no longer has one.
+func (i serviceInterface) encodeFields(w http.ResponseWriter, r *http.Request, v interface{}) {
+	ctx := InjectParams(r.Context(), r.URL.Query())
+	fields := ParseFieldset(r.URL.Query()[FieldsParam]...)
+	if names := ParseExpand(ctx); len(names) > 0 {
+		if i.registry == nil {
+			err := errors.Errorf("%s parameter is not supported", ExpandParam)
+			HandleError(NewServiceError(err, http.StatusBadRequest), w)
+			return
+		}
+
+		if HandleError(fields.without(names).checkValue(v), w) {
+			return
+		}
+
+		expanded, err := i.registry.Expand(ctx, v, names)
+		if HandleError(err, w) {
+			return
+		}
+		v = expanded
+	}
+
+	v, err := fields.Apply(v)
+	if HandleError(err, w) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	HandleError(json.NewEncoder(w).Encode(v), w)
+}
@@ -0,0 +1,470 @@
+package rest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SnapshotVersion is the version of the snapshot format written by Export.
+const SnapshotVersion = 1
+
+// SnapshotFormat is the encoding of a snapshot.
+type SnapshotFormat string
+
+const (
+	// SnapshotJSON encodes a snapshot as a single JSON object with the
+	// header and an array of records.
+	SnapshotJSON = SnapshotFormat("json")
+
+	// SnapshotNDJSON encodes a snapshot as newline delimited JSON with the
+	// header on the first line followed by one record per line.
+	SnapshotNDJSON = SnapshotFormat("ndjson")
+)
+
+// NDJSONContentType is the content type of newline delimited JSON.
+const NDJSONContentType = "application/x-ndjson"
+
+// SnapshotHeader describes a snapshot.
+type SnapshotHeader struct {
+	// Version is the version of the snapshot format.
+	Version int `json:"version"`
+
+	// Schema is the schema version of the values, see Migrations.
+	Schema int `json:"schema,omitempty"`
+
+	// Count is the number of values ever created, used to make new keys.
+	Count int `json:"count"`
+
+	// Records is the number of records in the snapshot.
+	Records int `json:"records"`
+
+	// Time is the time at which the snapshot was taken.
+	Time time.Time `json:"time"`
+}
+
+// SnapshotRecord is a value stored in a snapshot. The revision history of the
+// value is included if the DictService keeps one.
+type SnapshotRecord struct {
+	Key     string             `json:"key"`
+	Value   json.RawMessage    `json:"value"`
+	Deleted *time.Time         `json:"deleted,omitempty"`
+	Expires *time.Time         `json:"expires,omitempty"`
+	History []SnapshotRevision `json:"history,omitempty"`
+}
+
+// SnapshotRevision is a Revision stored in a snapshot.
+type SnapshotRevision struct {
+	Number int             `json:"number"`
+	Time   time.Time       `json:"time"`
+	Op     string          `json:"op"`
+	Value  json.RawMessage `json:"value"`
+}
+
+// Snapshot is the full content of a DictService.
+type Snapshot struct {
+	Header  SnapshotHeader   `json:"header"`
+	Records []SnapshotRecord `json:"records"`
+}
+
+// ImportMode selects how imported records are combined with existing values.
+type ImportMode string
+
+const (
+	// ImportReplace removes all existing values before importing.
+	ImportReplace = ImportMode("replace")
+
+	// ImportMerge overwrites existing values with imported values for the
+	// same keys and keeps the others.
+	ImportMerge = ImportMode("merge")
+
+	// ImportSkipExisting only imports values for keys which do not exist.
+	ImportSkipExisting = ImportMode("skip-existing")
+)
+
+// ImportResult reports the changes made by an import.
+type ImportResult struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Skipped int `json:"skipped"`
+	Removed int `json:"removed"`
+}
+
+// Snapshot takes a snapshot of all values including tombstoned values.
+func (s *DictService) Snapshot(ctx context.Context) (Snapshot, error) {
+	if err := CheckContext(ctx); err != nil {
+		return Snapshot{}, err
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	s.sweep()
+
+	records := make([]SnapshotRecord, s.Dict.Len())
+	for i, key := range s.Dict.Keys {
+		value, err := json.Marshal(s.Dict.Values[i])
+		if err != nil {
+			return Snapshot{}, errors.Wrapf(err, "in DictService Snapshot: key '%s'", key)
+		}
+
+		records[i] = SnapshotRecord{Key: key, Value: value}
+		if at, ok := s.Deleted[key]; ok {
+			records[i].Deleted = &at
+		}
+		if at, ok := s.Expires[key]; ok {
+			records[i].Expires = &at
+		}
+
+		if !s.history {
+			continue
+		}
+		for _, revision := range s.History[key] {
+			value, err := json.Marshal(revision.Value)
+			if err != nil {
+				return Snapshot{}, errors.Wrapf(err, "in DictService Snapshot: revision %d of key '%s'", revision.Number, key)
+			}
+			records[i].History = append(records[i].History, SnapshotRevision{
+				Number: revision.Number,
+				Time:   revision.Time,
+				Op:     revision.Op,
+				Value:  value,
+			})
+		}
+	}
+
+	header := SnapshotHeader{
+		Version: SnapshotVersion,
+		Schema:  s.migrations.Latest(),
+		Count:   s.Count,
+		Records: len(records),
+		Time:    time.Now(),
+	}
+
+	return Snapshot{Header: header, Records: records}, nil
+}
+
+// Export a snapshot of all values to the writer in the given format.
+func (s *DictService) Export(ctx context.Context, w io.Writer, format SnapshotFormat) error {
+	snapshot, err := s.Snapshot(ctx)
+	if err != nil {
+		return err
+	}
+	return WriteSnapshot(w, snapshot, format)
+}
+
+// Import a snapshot in the given format from the reader. Every record is
+// validated before any value is changed, so that an invalid snapshot is
+// rejected as a whole.
+func (s *DictService) Import(ctx context.Context, r io.Reader, format SnapshotFormat, mode ImportMode) (ImportResult, error) {
+	snapshot, err := ReadSnapshot(r, format)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	return s.Load(ctx, snapshot, mode)
+}
+
+// Load the values in the snapshot, migrating them to the latest schema
+// version first. The revision histories in the snapshot replace those of the
+// loaded values if the DictService keeps a history. The Count is raised past
+// numeric imported keys and imported keys the Model would make next, so that
+// Create does not collide with them.
+func (s *DictService) Load(ctx context.Context, snapshot Snapshot, mode ImportMode) (ImportResult, error) {
+	if err := CheckContext(ctx); err != nil {
+		return ImportResult{}, err
+	}
+
+	snapshot, _, err := s.migrations.Migrate(snapshot)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	switch mode {
+	case ImportReplace, ImportMerge, ImportSkipExisting:
+	default:
+		err := errors.Errorf("unknown import mode '%s'", mode)
+		return ImportResult{}, NewServiceError(err, http.StatusBadRequest)
+	}
+
+	models := make([]Model, len(snapshot.Records))
+	histories := make([][]Revision, len(snapshot.Records))
+	for i, record := range snapshot.Records {
+		model := s.build()
+		if err := json.Unmarshal(record.Value, &model); err != nil {
+			err = errors.Wrapf(err, "invalid value for key '%s'", record.Key)
+			return ImportResult{}, NewServiceError(err, http.StatusBadRequest)
+		}
+		if err := model.Validate(); err != nil {
+			err = errors.Wrapf(err, "invalid value for key '%s'", record.Key)
+			return ImportResult{}, NewServiceError(err, http.StatusBadRequest)
+		}
+		models[i] = model
+
+		if !s.history {
+			continue
+		}
+		for _, revision := range record.History {
+			value := s.build()
+			if err := json.Unmarshal(revision.Value, &value); err != nil {
+				err = errors.Wrapf(err, "invalid revision %d for key '%s'", revision.Number, record.Key)
+				return ImportResult{}, NewServiceError(err, http.StatusBadRequest)
+			}
+			histories[i] = append(histories[i], Revision{
+				Number: revision.Number,
+				Time:   revision.Time,
+				Op:     revision.Op,
+				Value:  value,
+			})
+		}
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	s.sweep()
+
+	var result ImportResult
+	if mode == ImportReplace {
+		result.Removed = s.Dict.Len()
+		s.Dict.Clear()
+		s.Count = 0
+		s.Deleted = make(map[string]time.Time)
+		s.History = make(map[string][]Revision)
+		s.Expires = make(map[string]time.Time)
+	}
+
+	for i, record := range snapshot.Records {
+		exists := s.Dict.Get(record.Key) != nil
+		switch {
+		case !exists:
+			s.Dict.Insert(record.Key, models[i])
+			result.Created++
+		case mode == ImportSkipExisting:
+			result.Skipped++
+			continue
+		default:
+			s.Dict.Set(record.Key, models[i])
+			delete(s.History, record.Key)
+			result.Updated++
+		}
+
+		delete(s.Deleted, record.Key)
+		if record.Deleted != nil {
+			s.Deleted[record.Key] = *record.Deleted
+		}
+		delete(s.Expires, record.Key)
+		if record.Expires != nil {
+			s.Expires[record.Key] = *record.Expires
+		}
+		if histories[i] != nil {
+			s.History[record.Key] = histories[i]
+		}
+	}
+
+	if snapshot.Header.Count > s.Count {
+		s.Count = snapshot.Header.Count
+	}
+	s.skipTakenKeys()
+
+	return result, nil
+}
+
+// skipTakenKeys raises the Count past the stored keys, so that keys made for
+// new values do not collide with imported ones. Numeric keys are skipped
+// outright, and the Count is advanced while the next key made by the Model
+// is taken.
+func (s *DictService) skipTakenKeys() {
+	for _, key := range s.Dict.Keys {
+		if n, err := strconv.Atoi(key); err == nil && n >= s.Count {
+			s.Count = n + 1
+		}
+	}
+
+	// Stop after as many steps as there are keys, in case the Model does
+	// not make keys from the Count at all.
+	for i := 0; i < s.Dict.Len(); i++ {
+		if s.Dict.Get(s.build().MakeKey(s.Count)) == nil {
+			return
+		}
+		s.Count++
+	}
+}
+
+// WriteSnapshot writes the snapshot to the writer in the given format.
+func WriteSnapshot(w io.Writer, snapshot Snapshot, format SnapshotFormat) error {
+	switch format {
+	case SnapshotJSON:
+		return json.NewEncoder(w).Encode(snapshot)
+
+	case SnapshotNDJSON:
+		buffered := bufio.NewWriter(w)
+		encoder := json.NewEncoder(buffered)
+		if err := encoder.Encode(snapshot.Header); err != nil {
+			return err
+		}
+		for _, record := range snapshot.Records {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		return buffered.Flush()
+
+	default:
+		err := errors.Errorf("unknown snapshot format '%s'", format)
+		return NewServiceError(err, http.StatusBadRequest)
+	}
+}
+
+// ReadSnapshot reads a snapshot in the given format from the reader. Returns
+// a ServiceError with status code 400 if the snapshot is malformed, of a
+// newer version, or has a different number of records than its header says.
+func ReadSnapshot(r io.Reader, format SnapshotFormat) (Snapshot, error) {
+	var snapshot Snapshot
+
+	switch format {
+	case SnapshotJSON:
+		if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+			return Snapshot{}, snapshotError(err)
+		}
+
+	case SnapshotNDJSON:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(nil, 64<<20)
+
+		header := true
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+
+			if header {
+				if err := json.Unmarshal(line, &snapshot.Header); err != nil {
+					return Snapshot{}, snapshotError(errors.Wrap(err, "header"))
+				}
+				header = false
+				continue
+			}
+
+			var record SnapshotRecord
+			if err := json.Unmarshal(line, &record); err != nil {
+				return Snapshot{}, snapshotError(errors.Wrapf(err, "record %d", len(snapshot.Records)+1))
+			}
+			snapshot.Records = append(snapshot.Records, record)
+		}
+		if err := scanner.Err(); err != nil {
+			return Snapshot{}, snapshotError(err)
+		}
+		if header {
+			return Snapshot{}, snapshotError(errors.New("header is missing"))
+		}
+
+	default:
+		err := errors.Errorf("unknown snapshot format '%s'", format)
+		return Snapshot{}, NewServiceError(err, http.StatusBadRequest)
+	}
+
+	if v := snapshot.Header.Version; v < 1 || v > SnapshotVersion {
+		return Snapshot{}, snapshotError(errors.Errorf("unsupported version %d", v))
+	}
+
+	if n := len(snapshot.Records); n != snapshot.Header.Records {
+		err := errors.Errorf("header lists %d records but found %d", snapshot.Header.Records, n)
+		return Snapshot{}, snapshotError(err)
+	}
+
+	return snapshot, nil
+}
+
+func snapshotError(err error) error {
+	return NewServiceError(errors.Wrap(err, "invalid snapshot"), http.StatusBadRequest)
+}
+
+// FormatParam is the URL parameter selecting the format of a snapshot.
+const FormatParam = "format"
+
+// ModeParam is the URL parameter selecting the ImportMode of a snapshot.
+const ModeParam = "mode"
+
+// Snapshotter is implemented by Services which can be exported and imported
+// as a snapshot, like a DictService or an IO Service persisting one.
+type Snapshotter interface {
+	Snapshot(ctx context.Context) (Snapshot, error)
+	Import(ctx context.Context, r io.Reader, format SnapshotFormat, mode ImportMode) (ImportResult, error)
+}
+
+var errNotSnapshotter = NewServiceError(
+	errors.New("service does not support snapshots"),
+	http.StatusNotImplemented,
+)
+
+// SnapshotHandler creates an http.Handler exporting the Snapshotter on GET
+// and importing into it on POST, for use as an admin endpoint. The format is
+// given by the FormatParam, or else NDJSON if the request accepts or sends
+// NDJSON and JSON otherwise. Imports use the ImportMode in the ModeParam and
+// merge by default, responding with the ImportResult. The handler does not
+// authenticate requests by itself.
+func SnapshotHandler(s Snapshotter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			format := snapshotFormat(r, r.Header.Get("Accept"))
+			snapshot, err := s.Snapshot(r.Context())
+			if HandleError(err, w) {
+				return
+			}
+
+			var buf bytes.Buffer
+			if HandleError(WriteSnapshot(&buf, snapshot, format), w) {
+				return
+			}
+
+			if format == SnapshotNDJSON {
+				w.Header().Set("Content-Type", NDJSONContentType)
+			} else {
+				w.Header().Set("Content-Type", "application/json")
+			}
+			buf.WriteTo(w)
+
+		case http.MethodPost:
+			mode := ImportMode(r.URL.Query().Get(ModeParam))
+			if mode == "" {
+				mode = ImportMerge
+			}
+
+			format := snapshotFormat(r, r.Header.Get("Content-Type"))
+			result, err := s.Import(r.Context(), r.Body, format, mode)
+			if HandleError(err, w) {
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			HandleError(json.NewEncoder(w).Encode(result), w)
+
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			err := errors.Errorf("method %s is not allowed", r.Method)
+			HandleError(NewServiceError(err, http.StatusMethodNotAllowed), w)
+		}
+	})
+}
+
+// snapshotFormat selects the format of a snapshot from the FormatParam or
+// the given media type header.
+func snapshotFormat(r *http.Request, mediaType string) SnapshotFormat {
+	if format := r.URL.Query().Get(FormatParam); format != "" {
+		return SnapshotFormat(format)
+	}
+	if strings.Contains(mediaType, NDJSONContentType) {
+		return SnapshotNDJSON
+	}
+	return SnapshotJSON
+}
@@ -0,0 +1,202 @@
+package rest_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/ktnyt/go-rest/resttest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	populate := func(t *testing.T, n int) *rest.DictService {
+		service := rest.NewDictService(NewTodo, Filter, Convert, rest.WithSoftDelete(0)).(*rest.DictService)
+		for i := 0; i < n; i++ {
+			_, err := service.Create(emptyContext, bytes.NewReader(mustMarshal(RandomTodo())))
+			require.NoError(t, err)
+		}
+		return service
+	}
+
+	for _, format := range []rest.SnapshotFormat{rest.SnapshotJSON, rest.SnapshotNDJSON} {
+		t.Run("round trips "+string(format), func(t *testing.T) {
+			source := populate(t, 3)
+			_, err := source.Remove(emptyContext, "1")
+			require.NoError(t, err)
+			_, err = source.CreateWithTTL(emptyContext, bytes.NewReader(mustMarshal(RandomTodo())), time.Hour)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			require.NoError(t, source.Export(emptyContext, &buf, format))
+
+			target := populate(t, 1)
+			result, err := target.Import(emptyContext, &buf, format, rest.ImportReplace)
+			require.NoError(t, err)
+			require.Equal(t, rest.ImportResult{Created: 4, Removed: 1}, result)
+
+			expected, err := source.Snapshot(emptyContext)
+			require.NoError(t, err)
+			actual, err := target.Snapshot(emptyContext)
+			require.NoError(t, err)
+			require.Equal(t, expected.Header.Count, actual.Header.Count)
+			require.JSONEq(t, string(mustMarshal(expected.Records)), string(mustMarshal(actual.Records)))
+
+			_, ok := target.Expiry("3")
+			require.True(t, ok)
+
+			model, err := target.Create(emptyContext, bytes.NewReader(mustMarshal(RandomTodo())))
+			require.NoError(t, err)
+			require.Equal(t, "4", model.(*Todo).Key)
+		})
+	}
+
+	t.Run("writes a header line", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, populate(t, 2).Export(emptyContext, &buf, rest.SnapshotNDJSON))
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 3)
+
+		var header rest.SnapshotHeader
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &header))
+		require.Equal(t, rest.SnapshotVersion, header.Version)
+		require.Equal(t, 2, header.Count)
+		require.Equal(t, 2, header.Records)
+	})
+
+	t.Run("merges or skips existing values", func(t *testing.T) {
+		source := populate(t, 3)
+		snapshot, err := source.Snapshot(emptyContext)
+		require.NoError(t, err)
+
+		target := populate(t, 1)
+		result, err := target.Load(emptyContext, snapshot, rest.ImportSkipExisting)
+		require.NoError(t, err)
+		require.Equal(t, rest.ImportResult{Created: 2, Skipped: 1}, result)
+
+		model, err := target.Select(emptyContext, "0")
+		require.NoError(t, err)
+		require.NotEqual(t, snapshot.Records[0].Value, json.RawMessage(mustMarshal(model)))
+
+		result, err = target.Load(emptyContext, snapshot, rest.ImportMerge)
+		require.NoError(t, err)
+		require.Equal(t, rest.ImportResult{Updated: 3}, result)
+
+		model, err = target.Select(emptyContext, "0")
+		require.NoError(t, err)
+		require.JSONEq(t, string(snapshot.Records[0].Value), string(mustMarshal(model)))
+	})
+
+	t.Run("makes keys past imported keys", func(t *testing.T) {
+		value := func(key string) json.RawMessage {
+			todo := RandomTodo()
+			todo.Key = key
+			return mustMarshal(todo)
+		}
+		snapshot := rest.Snapshot{
+			Header: rest.SnapshotHeader{Version: rest.SnapshotVersion, Count: 1, Records: 2},
+			Records: []rest.SnapshotRecord{
+				{Key: "1", Value: value("1")},
+				{Key: "7", Value: value("7")},
+			},
+		}
+
+		target := populate(t, 0)
+		_, err := target.Load(emptyContext, snapshot, rest.ImportMerge)
+		require.NoError(t, err)
+		require.Equal(t, 8, target.Count)
+
+		model, err := create(t, target, RandomTodo())
+		require.NoError(t, err)
+		require.Equal(t, "8", model.(*Todo).Key)
+	})
+
+	t.Run("rejects invalid snapshots", func(t *testing.T) {
+		target := populate(t, 2)
+		header := `{"version":1,"count":1,"records":1}`
+		invalid := string(mustMarshal(InvalidTodo()))
+
+		for _, body := range []string{
+			``,
+			`{"version":2,"count":0,"records":0}`,
+			header,
+			header + "\n" + `{"key":"0","value":` + invalid + `}`,
+			header + "\n" + `{"key":"0","value":{"Content":1}}`,
+		} {
+			_, err := target.Import(emptyContext, strings.NewReader(body), rest.SnapshotNDJSON, rest.ImportReplace)
+			resttest.RequireStatus(t, http.StatusBadRequest, err)
+		}
+
+		_, err := target.Import(emptyContext, strings.NewReader(header), rest.SnapshotNDJSON, "overwrite")
+		resttest.RequireStatus(t, http.StatusBadRequest, err)
+
+		models, err := target.Browse(emptyContext)
+		require.NoError(t, err)
+		require.Len(t, models, 2)
+	})
+
+	t.Run("serves admin endpoints", func(t *testing.T) {
+		source := rest.SnapshotHandler(populate(t, 2))
+		target := populate(t, 1)
+		handler := rest.SnapshotHandler(target)
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", rest.NDJSONContentType)
+		w := httptest.NewRecorder()
+		source.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, rest.NDJSONContentType, w.Header().Get("Content-Type"))
+
+		r = httptest.NewRequest(http.MethodPost, "/?mode=skip-existing", w.Body)
+		r.Header.Set("Content-Type", rest.NDJSONContentType)
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.JSONEq(t, `{"created":1,"updated":0,"skipped":1,"removed":0}`, w.Body.String())
+
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?format=json", nil))
+		require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		var snapshot rest.Snapshot
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &snapshot))
+		require.Len(t, snapshot.Records, 2)
+
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/", nil))
+		require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		require.Equal(t, rest.ProblemContentType, w.Header().Get("Content-Type"))
+	})
+
+	t.Run("persists imports into io services", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, populate(t, 2).Export(emptyContext, &buf, rest.SnapshotNDJSON))
+
+		service := rest.NewIOService(NewBufferIOHandler(NewTodoDictService))
+		handler := rest.SnapshotHandler(service.(rest.Snapshotter))
+
+		r := httptest.NewRequest(http.MethodPost, "/", &buf)
+		r.Header.Set("Content-Type", rest.NDJSONContentType)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		models, err := service.Browse(emptyContext)
+		require.NoError(t, err)
+		require.Len(t, models, 2)
+
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?format=json", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var snapshot rest.Snapshot
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &snapshot))
+		require.Len(t, snapshot.Records, 2)
+	})
+}
@@ -0,0 +1,934 @@
+package rest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// SortParam is the URL parameter listing the columns to sort values by,
+// separated by commas. Columns prefixed with a '-' are sorted in descending
+// order.
+const SortParam = "sort"
+
+// LimitParam is the URL parameter for the maximum number of values to return.
+const LimitParam = "limit"
+
+// OffsetParam is the URL parameter for the number of values to skip.
+const OffsetParam = "offset"
+
+// SQLService provides a Service for a table in a SQL database. The Model
+// must be a pointer to a struct whose exported fields map to the columns of
+// the table. The column name is taken from the `db` struct tag, or else the
+// field name in snake case, and fields tagged with `db:"-"` are skipped. The
+// key column is tagged with a `pk` option, e.g. `db:"id,pk"`, or else is the
+// column for the field named Key, and must be a string. Structs other than
+// time.Time, slices other than []byte and maps are stored as JSON.
+//
+// URL parameters named after a column filter Browse and Delete to the values
+// with that column equal to one of the parameter values. The SortParam,
+// LimitParam and OffsetParam sort and paginate the values, which are sorted
+// by key by default. Other URL parameters are rejected with a 400 unless they
+// control how the request is served, like the FieldsParam.
+type SQLService struct {
+	db    *sql.DB
+	table sqlTable
+	build ModelBuilder
+
+	mu      sync.Mutex
+	count   int
+	counted bool
+
+	placeholder func(int) string
+	hooks       *Hooks
+	decoding    DecodeOptions
+}
+
+// SQLServiceOption configures optional behavior of a SQLService.
+type SQLServiceOption func(*SQLService)
+
+// WithPlaceholder sets the function creating the placeholder for the nth
+// query argument, counting from 1. The default placeholder is '?'.
+func WithPlaceholder(placeholder func(int) string) SQLServiceOption {
+	return func(s *SQLService) {
+		s.placeholder = placeholder
+	}
+}
+
+// DollarPlaceholder creates placeholders of the form $n, e.g. for PostgreSQL.
+func DollarPlaceholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// WithSQLHooks registers Hooks to run around the SQLService operations, after
+// the hook methods implemented by the Model itself. An error from an After
+// hook rolls back the transaction of the operation.
+func WithSQLHooks(hooks *Hooks) SQLServiceOption {
+	return func(s *SQLService) {
+		s.hooks = hooks
+	}
+}
+
+// WithSQLDecoding sets the options for decoding request bodies.
+func WithSQLDecoding(decoding DecodeOptions) SQLServiceOption {
+	return func(s *SQLService) {
+		s.decoding = decoding
+	}
+}
+
+// NewSQLService returns a new SQL service for the named table. Returns an
+// error if the Model created by the builder cannot be mapped to a table.
+func NewSQLService(db *sql.DB, table string, build ModelBuilder, opts ...SQLServiceOption) (Service, error) {
+	t, err := newSQLTable(table, build())
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SQLService{
+		db:          db,
+		table:       t,
+		build:       build,
+		placeholder: func(int) string { return "?" },
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+// Browse the values matching the URL parameters.
+func (s *SQLService) Browse(ctx context.Context) ([]Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	var q sqlQuery
+	if err := s.where(ctx, &q); err != nil {
+		return nil, err
+	}
+	if err := s.page(ctx, &q); err != nil {
+		return nil, err
+	}
+
+	list, err := s.query(ctx, s.db, &q)
+	if err != nil {
+		return nil, s.fail(ctx, "Browse", err)
+	}
+	return list, nil
+}
+
+// Delete the values matching the URL parameters.
+func (s *SQLService) Delete(ctx context.Context) ([]Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	var q sqlQuery
+	if err := s.where(ctx, &q); err != nil {
+		return nil, err
+	}
+	if err := s.page(ctx, &q); err != nil {
+		return nil, err
+	}
+
+	var list []Model
+	err := s.transact(ctx, func(tx *sql.Tx) error {
+		var err error
+		if list, err = s.query(ctx, tx, &q); err != nil {
+			return err
+		}
+
+		for _, model := range list {
+			if err := runHooks(ctx, s.hooks, HookBeforeRemove, model); err != nil {
+				return err
+			}
+		}
+
+		for _, model := range list {
+			if err := s.remove(ctx, tx, s.table.key(model)); err != nil {
+				return err
+			}
+		}
+
+		for _, model := range list {
+			if err := runHooks(ctx, s.hooks, HookAfterRemove, model); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, s.fail(ctx, "Delete", err)
+	}
+	return list, nil
+}
+
+// Create and store a new value.
+func (s *SQLService) Create(ctx context.Context, reader io.Reader) (Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	model := s.build()
+	if err := s.decoding.Decode(reader, &model); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.counted {
+		row := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+quoteIdent(s.table.name))
+		if err := row.Scan(&s.count); err != nil {
+			return nil, s.fail(ctx, "Create", err)
+		}
+		s.counted = true
+	}
+
+	key := s.makeKey(model)
+	if err := runHooks(ctx, s.hooks, HookBeforeCreate, model); err != nil {
+		return nil, err
+	}
+
+	if err := model.Validate(); err != nil {
+		return nil, NewServiceError(err, http.StatusBadRequest)
+	}
+
+	err := s.transact(ctx, func(tx *sql.Tx) error {
+		for {
+			exists, err := s.exists(ctx, tx, key)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				break
+			}
+
+			// The key was taken, e.g. by a value created before the count
+			// was taken. Retry with the next key unless it is the same.
+			s.count++
+			next := s.makeKey(model)
+			if next == key {
+				return NewServiceError(NewKeyError(key, false), http.StatusBadRequest)
+			}
+			key = next
+		}
+
+		if err := s.insert(ctx, tx, model); err != nil {
+			return err
+		}
+
+		return runHooks(ctx, s.hooks, HookAfterCreate, model)
+	})
+	if err != nil {
+		return nil, s.fail(ctx, "Create", err)
+	}
+
+	s.count++
+
+	return model, nil
+}
+
+// Select a value identified by the given key.
+func (s *SQLService) Select(ctx context.Context, key string) (Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	model, err := s.get(ctx, s.db, key)
+	if err != nil {
+		return nil, s.fail(ctx, "Select", err)
+	}
+	return model, nil
+}
+
+// SelectMany selects the values identified by the given keys at once. Missing
+// keys are left out of the result.
+func (s *SQLService) SelectMany(ctx context.Context, keys []string) (map[string]Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]Model, len(keys))
+	if len(keys) == 0 {
+		return values, nil
+	}
+
+	var q sqlQuery
+	q.in(s.table.pk().name, stringArgs(keys), s.placeholder)
+
+	list, err := s.query(ctx, s.db, &q)
+	if err != nil {
+		return nil, s.fail(ctx, "SelectMany", err)
+	}
+
+	for _, model := range list {
+		values[s.table.key(model)] = model
+	}
+	return values, nil
+}
+
+// Remove a value identified by the given key.
+func (s *SQLService) Remove(ctx context.Context, key string) (Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	var model Model
+	err := s.transact(ctx, func(tx *sql.Tx) error {
+		var err error
+		if model, err = s.get(ctx, tx, key); err != nil {
+			return err
+		}
+
+		if err := runHooks(ctx, s.hooks, HookBeforeRemove, model); err != nil {
+			return err
+		}
+
+		if err := s.remove(ctx, tx, key); err != nil {
+			return err
+		}
+
+		return runHooks(ctx, s.hooks, HookAfterRemove, model)
+	})
+	if err != nil {
+		return nil, s.fail(ctx, "Remove", err)
+	}
+	return model, nil
+}
+
+// Update an entire value identified by the given key.
+func (s *SQLService) Update(ctx context.Context, key string, reader io.Reader) (Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	value := s.build()
+	if err := s.decoding.Decode(reader, &value); err != nil {
+		return nil, err
+	}
+	s.table.setKey(value, key)
+
+	if err := runHooks(ctx, s.hooks, HookBeforeUpdate, value); err != nil {
+		return nil, err
+	}
+
+	if err := value.Validate(); err != nil {
+		return nil, NewServiceError(err, http.StatusBadRequest)
+	}
+
+	err := s.transact(ctx, func(tx *sql.Tx) error {
+		exists, err := s.exists(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			err := NewKeyError(key, true)
+			return NewServiceError(err, http.StatusBadRequest)
+		}
+
+		if err := s.update(ctx, tx, key, value); err != nil {
+			return err
+		}
+		return runHooks(ctx, s.hooks, HookAfterUpdate, value)
+	})
+	if err != nil {
+		return nil, s.fail(ctx, "Update", err)
+	}
+	return value, nil
+}
+
+// Modify part of a value identified by the given key.
+func (s *SQLService) Modify(ctx context.Context, key string, reader io.Reader) (Model, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	model := s.build()
+	if err := s.decoding.Decode(reader, &model); err != nil {
+		return nil, err
+	}
+
+	var value Model
+	err := s.transact(ctx, func(tx *sql.Tx) error {
+		var err error
+		if value, err = s.get(ctx, tx, key); err != nil {
+			return err
+		}
+
+		if err := value.Merge(model); err != nil {
+			return NewServiceError(err, http.StatusBadRequest)
+		}
+		s.table.setKey(value, key)
+
+		if err := runHooks(ctx, s.hooks, HookBeforeModify, value); err != nil {
+			return err
+		}
+
+		if err := value.Validate(); err != nil {
+			return NewServiceError(err, http.StatusBadRequest)
+		}
+
+		if err := s.update(ctx, tx, key, value); err != nil {
+			return err
+		}
+
+		return runHooks(ctx, s.hooks, HookAfterModify, value)
+	})
+	if err != nil {
+		return nil, s.fail(ctx, "Modify", err)
+	}
+	return value, nil
+}
+
+// sqlQueryer is implemented by both *sql.DB and *sql.Tx.
+type sqlQueryer interface {
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+}
+
+// transact runs the function in a transaction, committing it if the function
+// succeeds and rolling it back otherwise.
+func (s *SQLService) transact(ctx context.Context, f func(*sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// fail maps an error from the database to a ServiceError.
+func (s *SQLService) fail(ctx context.Context, op string, err error) error {
+	if _, ok := err.(ServiceError); ok {
+		return err
+	}
+	if err := CheckContext(ctx); err != nil {
+		return err
+	}
+	if isUniqueViolation(err) {
+		return NewServiceError(errors.Wrapf(err, "in SQLService %s", op), http.StatusConflict)
+	}
+	return errors.Wrapf(err, "in SQLService %s", op)
+}
+
+// makeKey makes the key for the current count and sets it on the model.
+func (s *SQLService) makeKey(model Model) string {
+	key := model.MakeKey(s.count)
+	s.table.setKey(model, key)
+	return key
+}
+
+// query the values matching the query.
+func (s *SQLService) query(ctx context.Context, db sqlQueryer, q *sqlQuery) ([]Model, error) {
+	query := "SELECT " + s.table.columnList() + " FROM " + quoteIdent(s.table.name) + q.String()
+	rows, err := db.QueryContext(ctx, query, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]Model, 0)
+	for rows.Next() {
+		model := s.build()
+		if err := rows.Scan(s.table.dest(model)...); err != nil {
+			return nil, err
+		}
+		list = append(list, model)
+	}
+
+	return list, rows.Err()
+}
+
+// get the value identified by the given key.
+func (s *SQLService) get(ctx context.Context, db sqlQueryer, key string) (Model, error) {
+	var q sqlQuery
+	q.in(s.table.pk().name, []interface{}{key}, s.placeholder)
+
+	list, err := s.query(ctx, db, &q)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list) == 0 {
+		err := NewKeyError(key, true)
+		return nil, NewServiceError(err, http.StatusBadRequest)
+	}
+	return list[0], nil
+}
+
+// exists tests if a value with the given key exists.
+func (s *SQLService) exists(ctx context.Context, db sqlQueryer, key string) (bool, error) {
+	var q sqlQuery
+	q.in(s.table.pk().name, []interface{}{key}, s.placeholder)
+
+	query := "SELECT 1 FROM " + quoteIdent(s.table.name) + q.String()
+	rows, err := db.QueryContext(ctx, query, q.args...)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	return rows.Next(), rows.Err()
+}
+
+// insert the value as a new row.
+func (s *SQLService) insert(ctx context.Context, db sqlQueryer, model Model) error {
+	values := s.table.values(model)
+	placeholders := make([]string, len(values))
+	for i := range values {
+		placeholders[i] = s.placeholder(i + 1)
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s)",
+		quoteIdent(s.table.name),
+		s.table.columnList(),
+		strings.Join(placeholders, ", "),
+	)
+
+	_, err := db.ExecContext(ctx, query, values...)
+	return err
+}
+
+// update the row identified by the given key with the value.
+func (s *SQLService) update(ctx context.Context, db sqlQueryer, key string, model Model) error {
+	values := s.table.values(model)
+	assignments := make([]string, 0, len(values))
+	args := make([]interface{}, 0, len(values))
+	for i, column := range s.table.columns {
+		if i == s.table.pkIndex {
+			continue
+		}
+		args = append(args, values[i])
+		assignments = append(assignments, quoteIdent(column.name)+" = "+s.placeholder(len(args)))
+	}
+
+	var q sqlQuery
+	q.args = args
+	q.in(s.table.pk().name, []interface{}{key}, s.placeholder)
+
+	query := "UPDATE " + quoteIdent(s.table.name) + " SET " + strings.Join(assignments, ", ") + q.String()
+	_, err := db.ExecContext(ctx, query, q.args...)
+	return err
+}
+
+// remove the row identified by the given key.
+func (s *SQLService) remove(ctx context.Context, db sqlQueryer, key string) error {
+	var q sqlQuery
+	q.in(s.table.pk().name, []interface{}{key}, s.placeholder)
+
+	_, err := db.ExecContext(ctx, "DELETE FROM "+quoteIdent(s.table.name)+q.String(), q.args...)
+	return err
+}
+
+// FilterParams returns the names of the columns values can be filtered by.
+func (s *SQLService) FilterParams() []string {
+	names := []string{}
+	for _, column := range s.table.columns {
+		if !column.json {
+			names = append(names, column.name)
+		}
+	}
+	return names
+}
+
+// where adds the filters in the URL parameters to the query. Parameters which
+// are neither control parameters nor filterable columns are rejected, so that
+// a misspelled filter does not silently match every row.
+func (s *SQLService) where(ctx context.Context, q *sqlQuery) error {
+	params := ExtractParams(ctx)
+	for name := range params {
+		if controlParams[name] {
+			continue
+		}
+		if column, ok := s.table.column(name); !ok || column.json {
+			err := errors.Errorf("cannot filter by unknown parameter '%s'", name)
+			return NewServiceError(err, http.StatusBadRequest)
+		}
+	}
+
+	for _, column := range s.table.columns {
+		values, ok := params[column.name]
+		if !ok || column.json {
+			continue
+		}
+
+		args := make([]interface{}, len(values))
+		for i, value := range values {
+			arg, err := parseColumnValue(column.typ, value)
+			if err != nil {
+				err = errors.Wrapf(err, "invalid value for parameter '%s'", column.name)
+				return NewServiceError(err, http.StatusBadRequest)
+			}
+			args[i] = arg
+		}
+
+		q.in(column.name, args, s.placeholder)
+	}
+	return nil
+}
+
+// page adds the sort order and pagination in the URL parameters to the query.
+func (s *SQLService) page(ctx context.Context, q *sqlQuery) error {
+	params := ExtractParams(ctx)
+
+	var order []string
+	if sort := params.Get(SortParam); sort != "" {
+		for _, name := range strings.Split(sort, ",") {
+			direction := "ASC"
+			if strings.HasPrefix(name, "-") {
+				name, direction = name[1:], "DESC"
+			}
+			if _, ok := s.table.column(name); !ok {
+				err := errors.Errorf("cannot sort by unknown column '%s'", name)
+				return NewServiceError(err, http.StatusBadRequest)
+			}
+			order = append(order, quoteIdent(name)+" "+direction)
+		}
+	}
+	q.order = append(order, quoteIdent(s.table.pk().name)+" ASC")
+
+	limit, err := intParam(params.Get(LimitParam), LimitParam)
+	if err != nil {
+		return err
+	}
+	offset, err := intParam(params.Get(OffsetParam), OffsetParam)
+	if err != nil {
+		return err
+	}
+
+	if limit >= 0 || offset > 0 {
+		if limit < 0 {
+			limit = math.MaxInt64
+		}
+		if offset < 0 {
+			offset = 0
+		}
+		q.args = append(q.args, limit)
+		q.limit = s.placeholder(len(q.args))
+		q.args = append(q.args, offset)
+		q.offset = s.placeholder(len(q.args))
+	}
+
+	return nil
+}
+
+// intParam parses a non-negative integer URL parameter, returning -1 if it is
+// not set.
+func intParam(value, name string) (int64, error) {
+	if value == "" {
+		return -1, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		err := errors.Errorf("parameter '%s' must be a non-negative integer", name)
+		return 0, NewServiceError(err, http.StatusBadRequest)
+	}
+	return n, nil
+}
+
+// sqlQuery collects the clauses following the table name of a query.
+type sqlQuery struct {
+	conditions []string
+	order      []string
+	limit      string
+	offset     string
+	args       []interface{}
+}
+
+// in adds a condition for the column to equal one of the values.
+func (q *sqlQuery) in(column string, values []interface{}, placeholder func(int) string) {
+	placeholders := make([]string, len(values))
+	for i, value := range values {
+		q.args = append(q.args, value)
+		placeholders[i] = placeholder(len(q.args))
+	}
+
+	if len(values) == 1 {
+		q.conditions = append(q.conditions, quoteIdent(column)+" = "+placeholders[0])
+		return
+	}
+	q.conditions = append(q.conditions, quoteIdent(column)+" IN ("+strings.Join(placeholders, ", ")+")")
+}
+
+func (q *sqlQuery) String() string {
+	var b strings.Builder
+	if len(q.conditions) > 0 {
+		b.WriteString(" WHERE ")
+		b.WriteString(strings.Join(q.conditions, " AND "))
+	}
+	if len(q.order) > 0 {
+		b.WriteString(" ORDER BY ")
+		b.WriteString(strings.Join(q.order, ", "))
+	}
+	if q.limit != "" {
+		b.WriteString(" LIMIT ")
+		b.WriteString(q.limit)
+		b.WriteString(" OFFSET ")
+		b.WriteString(q.offset)
+	}
+	return b.String()
+}
+
+// sqlColumn maps a struct field to a column.
+type sqlColumn struct {
+	name  string
+	index []int
+	typ   reflect.Type
+	json  bool
+}
+
+// sqlTable maps a struct type to a table.
+type sqlTable struct {
+	name    string
+	columns []sqlColumn
+	pkIndex int
+}
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	valuerType  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
+func newSQLTable(name string, model Model) (sqlTable, error) {
+	t := reflect.TypeOf(model)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return sqlTable{}, errors.Errorf("in NewSQLService: model must be a pointer to a struct, got %T", model)
+	}
+	t = t.Elem()
+
+	table := sqlTable{name: name, pkIndex: -1}
+	keyField := -1
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		tag := field.Tag.Get("db")
+		if tag == "-" {
+			continue
+		}
+
+		options := strings.Split(tag, ",")
+		column := sqlColumn{
+			name:  options[0],
+			index: field.Index,
+			typ:   field.Type,
+			json:  jsonColumnType(field.Type),
+		}
+		if column.name == "" {
+			column.name = snakeCase(field.Name)
+		}
+
+		for _, option := range options[1:] {
+			if option == "pk" {
+				table.pkIndex = len(table.columns)
+			}
+		}
+		if field.Name == "Key" {
+			keyField = len(table.columns)
+		}
+
+		table.columns = append(table.columns, column)
+	}
+
+	if table.pkIndex < 0 {
+		table.pkIndex = keyField
+	}
+	if table.pkIndex < 0 {
+		return sqlTable{}, errors.Errorf("in NewSQLService: %s has no key column", t)
+	}
+	if table.pk().typ.Kind() != reflect.String {
+		return sqlTable{}, errors.Errorf("in NewSQLService: key column '%s' must be a string", table.pk().name)
+	}
+
+	return table, nil
+}
+
+// jsonColumnType tests if values of the type are stored as JSON.
+func jsonColumnType(t reflect.Type) bool {
+	if reflect.PtrTo(t).Implements(scannerType) || t.Implements(valuerType) {
+		return false
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		return t != timeType
+	case reflect.Slice:
+		return t.Elem().Kind() != reflect.Uint8
+	case reflect.Map, reflect.Array:
+		return true
+	}
+	return false
+}
+
+func (t sqlTable) pk() sqlColumn {
+	return t.columns[t.pkIndex]
+}
+
+func (t sqlTable) column(name string) (sqlColumn, bool) {
+	for _, column := range t.columns {
+		if column.name == name {
+			return column, true
+		}
+	}
+	return sqlColumn{}, false
+}
+
+func (t sqlTable) columnList() string {
+	names := make([]string, len(t.columns))
+	for i, column := range t.columns {
+		names[i] = quoteIdent(column.name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// key returns the key of the model.
+func (t sqlTable) key(model Model) string {
+	return reflect.ValueOf(model).Elem().FieldByIndex(t.pk().index).String()
+}
+
+// setKey sets the key of the model.
+func (t sqlTable) setKey(model Model, key string) {
+	reflect.ValueOf(model).Elem().FieldByIndex(t.pk().index).SetString(key)
+}
+
+// values returns the column values of the model.
+func (t sqlTable) values(model Model) []interface{} {
+	v := reflect.ValueOf(model).Elem()
+	values := make([]interface{}, len(t.columns))
+	for i, column := range t.columns {
+		field := v.FieldByIndex(column.index)
+		if column.json {
+			values[i] = jsonColumn{field.Addr().Interface()}
+		} else {
+			values[i] = field.Interface()
+		}
+	}
+	return values
+}
+
+// dest returns the destinations for scanning a row into the model.
+func (t sqlTable) dest(model Model) []interface{} {
+	v := reflect.ValueOf(model).Elem()
+	dest := make([]interface{}, len(t.columns))
+	for i, column := range t.columns {
+		field := v.FieldByIndex(column.index).Addr().Interface()
+		if column.json {
+			dest[i] = &jsonColumn{field}
+		} else {
+			dest[i] = field
+		}
+	}
+	return dest
+}
+
+// jsonColumn stores a value as JSON.
+type jsonColumn struct {
+	v interface{}
+}
+
+// Value satisfies the driver.Valuer interface.
+func (c jsonColumn) Value() (driver.Value, error) {
+	data, err := json.Marshal(c.v)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan satisfies the sql.Scanner interface.
+func (c *jsonColumn) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(src, c.v)
+	case string:
+		return json.Unmarshal([]byte(src), c.v)
+	default:
+		return errors.Errorf("cannot scan %T into a JSON column", src)
+	}
+}
+
+// parseColumnValue parses a URL parameter value into a value of the type.
+func parseColumnValue(t reflect.Type, value string) (interface{}, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return time.Parse(time.RFC3339Nano, value)
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return strconv.ParseBool(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(value, 10, t.Bits())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(value, 10, t.Bits())
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(value, t.Bits())
+	default:
+		return value, nil
+	}
+}
+
+// isUniqueViolation tests if the error is a unique constraint violation
+// reported by one of the common database drivers.
+func isUniqueViolation(err error) bool {
+	message := strings.ToLower(errors.Cause(err).Error())
+	return strings.Contains(message, "unique constraint") ||
+		strings.Contains(message, "duplicate key") ||
+		strings.Contains(message, "duplicate entry")
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return args
+}
+
+// snakeCase converts a field name such as CreatedAt to created_at.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteRune('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
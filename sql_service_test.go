@@ -0,0 +1,237 @@
+package rest_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/ktnyt/go-rest/resttest"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+const todoSchema = `CREATE TABLE todo (
+	key TEXT PRIMARY KEY,
+	content TEXT NOT NULL UNIQUE,
+	created_at DATETIME NOT NULL,
+	done BOOLEAN NOT NULL
+)`
+
+type Label struct {
+	ID    string   `db:"id,pk"`
+	Name  string   `db:"title"`
+	Tags  []string `db:"tags"`
+	Count int
+	Cache string `db:"-"`
+}
+
+func (l *Label) Validate() error {
+	return nil
+}
+
+func (l *Label) MakeKey(i int) string {
+	l.ID = fmt.Sprintf("label-%d", i)
+	return l.ID
+}
+
+func (l *Label) Merge(other interface{}) error {
+	return fmt.Errorf("attempted to merge Label")
+}
+
+func NewLabel() rest.Model {
+	return &Label{}
+}
+
+func OpenTodoDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	// Every connection to :memory: opens a distinct database.
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(todoSchema)
+	require.NoError(t, err)
+	return db
+}
+
+func NewTodoSQLService(t *testing.T) rest.Service {
+	service, err := rest.NewSQLService(OpenTodoDB(t), "todo", NewTodo)
+	require.NoError(t, err)
+	return service
+}
+
+func TestSQLServiceConformance(t *testing.T) {
+	fixtures := TodoFixtures
+	fixtures.Filter = func(ctx context.Context) context.Context {
+		return rest.InjectParams(ctx, url.Values{"done": {"true"}})
+	}
+	fixtures.Concurrency = 20
+	resttest.RunServiceConformance(t, func() rest.Service {
+		return NewTodoSQLService(t)
+	}, fixtures)
+}
+
+func TestSQLService(t *testing.T) {
+	params := func(values url.Values) context.Context {
+		return rest.InjectParams(emptyContext, values)
+	}
+
+	populate := func(t *testing.T, service rest.Service, n int) []*Todo {
+		todos := make([]*Todo, n)
+		for i := range todos {
+			model, err := service.Create(emptyContext, bytes.NewReader(mustMarshal(RandomTodo())))
+			require.NoError(t, err)
+			todos[i] = model.(*Todo)
+		}
+		return todos
+	}
+
+	todoKeys := func(models []rest.Model) []string {
+		keys := make([]string, len(models))
+		for i, model := range models {
+			keys[i] = model.(*Todo).Key
+		}
+		return keys
+	}
+
+	t.Run("filters, sorts and paginates", func(t *testing.T) {
+		service := NewTodoSQLService(t)
+		populate(t, service, 5)
+
+		models, err := service.Browse(params(url.Values{"done": {"false"}}))
+		require.NoError(t, err)
+		require.Equal(t, []string{"0", "2", "4"}, todoKeys(models))
+
+		models, err = service.Browse(params(url.Values{"key": {"1", "3", "9"}}))
+		require.NoError(t, err)
+		require.Equal(t, []string{"1", "3"}, todoKeys(models))
+
+		models, err = service.Browse(params(url.Values{rest.SortParam: {"-done,-key"}}))
+		require.NoError(t, err)
+		require.Equal(t, []string{"3", "1", "4", "2", "0"}, todoKeys(models))
+
+		models, err = service.Browse(params(url.Values{rest.LimitParam: {"2"}, rest.OffsetParam: {"1"}}))
+		require.NoError(t, err)
+		require.Equal(t, []string{"1", "2"}, todoKeys(models))
+
+		models, err = service.Browse(params(url.Values{rest.OffsetParam: {"3"}}))
+		require.NoError(t, err)
+		require.Equal(t, []string{"3", "4"}, todoKeys(models))
+
+		models, err = service.Delete(params(url.Values{"done": {"true"}, rest.LimitParam: {"1"}}))
+		require.NoError(t, err)
+		require.Equal(t, []string{"1"}, todoKeys(models))
+
+		models, err = service.Browse(emptyContext)
+		require.NoError(t, err)
+		require.Equal(t, []string{"0", "2", "3", "4"}, todoKeys(models))
+	})
+
+	t.Run("rejects invalid parameters", func(t *testing.T) {
+		service := NewTodoSQLService(t)
+
+		for _, values := range []url.Values{
+			{"done": {"maybe"}},
+			{rest.SortParam: {"color"}},
+			{rest.LimitParam: {"-1"}},
+			{rest.OffsetParam: {"many"}},
+			{"dnoe": {"true"}},
+		} {
+			_, err := service.Browse(params(values))
+			resttest.RequireStatus(t, http.StatusBadRequest, err)
+		}
+
+		populate(t, service, 2)
+		_, err := service.Delete(params(url.Values{"x": {"1"}}))
+		resttest.RequireStatus(t, http.StatusBadRequest, err)
+
+		models, err := service.Browse(params(url.Values{rest.FieldsParam: {"key"}, rest.AllParam: {"true"}}))
+		require.NoError(t, err)
+		require.Len(t, models, 2)
+	})
+
+	t.Run("maps constraint errors", func(t *testing.T) {
+		service := NewTodoSQLService(t)
+		todos := populate(t, service, 2)
+
+		_, err := service.Select(emptyContext, "missing")
+		resttest.RequireStatus(t, http.StatusBadRequest, err)
+		require.IsType(t, rest.KeyError{}, err.(rest.ServiceError).Err)
+
+		duplicate := RandomTodo()
+		duplicate.Content = todos[0].Content
+		_, err = service.Create(emptyContext, bytes.NewReader(mustMarshal(duplicate)))
+		resttest.RequireStatus(t, http.StatusConflict, err)
+
+		_, err = service.Update(emptyContext, todos[1].Key, bytes.NewReader(mustMarshal(duplicate)))
+		resttest.RequireStatus(t, http.StatusConflict, err)
+
+		model, err := service.Select(emptyContext, todos[1].Key)
+		require.NoError(t, err)
+		require.Equal(t, todos[1].Content, model.(*Todo).Content)
+	})
+
+	t.Run("skips existing keys", func(t *testing.T) {
+		db := OpenTodoDB(t)
+		service, err := rest.NewSQLService(db, "todo", NewTodo)
+		require.NoError(t, err)
+		populate(t, service, 3)
+
+		_, err = service.Remove(emptyContext, "0")
+		require.NoError(t, err)
+
+		service, err = rest.NewSQLService(db, "todo", NewTodo)
+		require.NoError(t, err)
+		todos := populate(t, service, 1)
+		require.Equal(t, "3", todos[0].Key)
+	})
+
+	t.Run("rolls back failed hooks", func(t *testing.T) {
+		hooks := rest.NewHooks().On(rest.HookAfterRemove, func(ctx context.Context, model rest.Model) error {
+			return rest.NewServiceError(fmt.Errorf("todo is in use"), http.StatusConflict)
+		})
+		service, err := rest.NewSQLService(OpenTodoDB(t), "todo", NewTodo, rest.WithSQLHooks(hooks))
+		require.NoError(t, err)
+		populate(t, service, 2)
+
+		_, err = service.Remove(emptyContext, "0")
+		resttest.RequireStatus(t, http.StatusConflict, err)
+
+		models, err := service.Browse(emptyContext)
+		require.NoError(t, err)
+		require.Len(t, models, 2)
+	})
+
+	t.Run("maps tagged fields", func(t *testing.T) {
+		db := OpenTodoDB(t)
+		_, err := db.Exec(`CREATE TABLE label (id TEXT PRIMARY KEY, title TEXT, tags TEXT, count INTEGER)`)
+		require.NoError(t, err)
+
+		service, err := rest.NewSQLService(db, "label", NewLabel)
+		require.NoError(t, err)
+
+		model, err := service.Create(emptyContext, bytes.NewReader([]byte(`{"Name":"work","Tags":["a","b"],"Count":2,"Cache":"x"}`)))
+		require.NoError(t, err)
+		require.Equal(t, "label-0", model.(*Label).ID)
+
+		model, err = service.Select(emptyContext, "label-0")
+		require.NoError(t, err)
+		require.Equal(t, &Label{ID: "label-0", Name: "work", Tags: []string{"a", "b"}, Count: 2}, model)
+
+		models, err := service.Browse(params(url.Values{"title": {"work"}, "count": {"2"}}))
+		require.NoError(t, err)
+		require.Len(t, models, 1)
+
+		_, err = service.Browse(params(url.Values{"tags": {"a"}}))
+		resttest.RequireStatus(t, http.StatusBadRequest, err)
+
+		_, err = rest.NewSQLService(db, "label", func() rest.Model { return rest.Model(nil) })
+		require.Error(t, err)
+	})
+}
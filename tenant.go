@@ -0,0 +1,438 @@
+package rest
+
+import (
+	"container/list"
+	"context"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNoTenant is returned when the tenant of a request cannot be resolved.
+var ErrNoTenant = errors.New("tenant is missing from the request")
+
+// ErrInvalidTenant is returned by ValidateTenant for malformed tenant IDs.
+var ErrInvalidTenant = errors.New("tenant ID is invalid")
+
+// ErrTooManyTenants is returned when a TenantService keeping its tenants only
+// in memory cannot keep another one.
+var ErrTooManyTenants = errors.New("too many tenants")
+
+// MaxTenantLength is the maximum length of a tenant ID accepted by
+// ValidateTenant.
+const MaxTenantLength = 64
+
+// ValidateTenant accepts tenant IDs of at most MaxTenantLength ASCII letters,
+// digits, dots, dashes, underscores and at signs which do not start with a
+// dot, so that they are safe to use in file names and paths. It is the default validator
+// of a TenantService.
+func ValidateTenant(tenant string) error {
+	if tenant == "" || len(tenant) > MaxTenantLength || tenant[0] == '.' {
+		return errors.Wrapf(ErrInvalidTenant, "'%s'", tenant)
+	}
+	for _, c := range tenant {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '.' || c == '-' || c == '_' || c == '@':
+		default:
+			return errors.Wrapf(ErrInvalidTenant, "'%s'", tenant)
+		}
+	}
+	return nil
+}
+
+type tenantKey struct{}
+
+// WithTenant injects the tenant ID into the given context.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantResolver resolves the tenant ID of an operation from its context.
+type TenantResolver func(context.Context) (string, error)
+
+// TenantFromContext resolves the tenant ID injected by WithTenant, e.g. by the
+// TenantHeader middleware.
+func TenantFromContext(ctx context.Context) (string, error) {
+	if tenant, ok := ctx.Value(tenantKey{}).(string); ok && tenant != "" {
+		return tenant, nil
+	}
+	return "", NewServiceError(ErrNoTenant, http.StatusBadRequest)
+}
+
+// TenantFromParam creates a TenantResolver reading the tenant ID from the
+// named path parameter in the context, like the primary key.
+func TenantFromParam(param string) TenantResolver {
+	return func(ctx context.Context) (string, error) {
+		if tenant, ok := ctx.Value(param).(string); ok && tenant != "" {
+			return tenant, nil
+		}
+		err := errors.Wrapf(ErrNoTenant, "path parameter '%s' is missing", param)
+		return "", NewServiceError(err, http.StatusBadRequest)
+	}
+}
+
+// TenantFromPrincipal creates a TenantResolver reading the tenant ID from
+// the named attribute of the Principal in the context. The Principal ID is
+// used if the attribute is empty.
+func TenantFromPrincipal(attribute string) TenantResolver {
+	return func(ctx context.Context) (string, error) {
+		principal, ok := PrincipalFromContext(ctx)
+		if !ok {
+			return "", NewServiceError(ErrUnauthenticated, http.StatusUnauthorized)
+		}
+		if attribute == "" {
+			return principal.ID, nil
+		}
+		if tenant, ok := principal.Attributes[attribute].(string); ok && tenant != "" {
+			return tenant, nil
+		}
+		err := errors.Wrapf(ErrNoTenant, "principal has no '%s' attribute", attribute)
+		return "", NewServiceError(err, http.StatusForbidden)
+	}
+}
+
+// TenantHeader creates an InterfaceMiddleware injecting the tenant ID given
+// by the named header into the request context for TenantFromContext.
+func TenantHeader(header string) InterfaceMiddleware {
+	return InterfaceMiddlewareFunc(func(op Operation, next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if tenant := r.Header.Get(header); tenant != "" {
+				r = r.WithContext(WithTenant(r.Context(), tenant))
+			}
+			next(w, r)
+		}
+	})
+}
+
+// TenantServiceBuilder will construct the Service of the given tenant.
+type TenantServiceBuilder func(tenant string) (Service, error)
+
+// TenantService is a Service partitioning its values by tenant. Every tenant
+// has its own isolated Service, so a caller can never read or change the
+// values of another tenant.
+//
+// Tenant IDs are checked by the validator before they reach the
+// TenantServiceBuilder. The Service of a tenant is kept once a value is
+// created for it. Other operations on a tenant which is not kept run against
+// a Service built for the operation alone, which finds the values persisted
+// by the builder, if any.
+type TenantService struct {
+	mu       sync.Mutex
+	services map[string]*list.Element
+	order    *list.List
+	resolve  TenantResolver
+	build    TenantServiceBuilder
+	validate func(string) error
+	max      int
+	evict    bool
+}
+
+type tenantEntry struct {
+	tenant  string
+	service Service
+}
+
+// TenantServiceOption configures optional behavior of a TenantService.
+type TenantServiceOption func(*TenantService)
+
+// WithTenantValidator replaces ValidateTenant as the validator of the tenant
+// IDs. A tenant ID rejected by the validator results in a 400.
+func WithTenantValidator(validate func(tenant string) error) TenantServiceOption {
+	return func(s *TenantService) {
+		s.validate = validate
+	}
+}
+
+// WithMaxTenants keeps the Services of at most n tenants, evicting the least
+// recently used one when another is kept. An evicted tenant is built again on
+// its next use, so the limit is meant for tenants persisting their values,
+// e.g. with NewTenantIOService. A TenantService created with
+// NewTenantDictService never evicts its tenants and responds with a 507 to
+// requests creating values for another tenant instead.
+func WithMaxTenants(n int) TenantServiceOption {
+	return func(s *TenantService) {
+		s.max = n
+	}
+}
+
+// NewTenantService creates a new TenantService.
+func NewTenantService(resolve TenantResolver, build TenantServiceBuilder, opts ...TenantServiceOption) *TenantService {
+	s := &TenantService{
+		services: make(map[string]*list.Element),
+		order:    list.New(),
+		resolve:  resolve,
+		build:    build,
+		validate: ValidateTenant,
+		evict:    true,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// NewTenantDictService creates a TenantService with an in-memory DictService
+// created with the given DictServiceOptions for every tenant.
+func NewTenantDictService(resolve TenantResolver, build ModelBuilder, factory FilterFactory, convert Converter, dictOpts []DictServiceOption, opts ...TenantServiceOption) *TenantService {
+	s := NewTenantService(resolve, func(string) (Service, error) {
+		return NewDictService(build, factory, convert, dictOpts...), nil
+	}, opts...)
+	s.evict = false
+	return s
+}
+
+// NewTenantIOService creates a TenantService with an IO service persisted by
+// its own IOHandler for every tenant. The handler only receives tenant IDs
+// accepted by the validator.
+func NewTenantIOService(resolve TenantResolver, handler func(tenant string) (IOHandler, error), hooks *Hooks, opts ...TenantServiceOption) *TenantService {
+	return NewTenantService(resolve, func(tenant string) (Service, error) {
+		h, err := handler(tenant)
+		if err != nil {
+			return nil, err
+		}
+		return NewIOServiceWithHooks(h, hooks), nil
+	}, opts...)
+}
+
+// Tenants returns the IDs of the tenants which are kept, in order.
+func (s *TenantService) Tenants() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenants := make([]string, 0, len(s.services))
+	for tenant := range s.services {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// Tenant returns the Service of the given tenant, creating and keeping it if
+// needed.
+func (s *TenantService) Tenant(tenant string) (Service, error) {
+	return s.tenant(tenant, true)
+}
+
+// tenant returns the Service of the given tenant, building it if it is not
+// kept. The built Service is only kept if keep is true. The Service is built
+// without holding the lock so that slow builders do not block other tenants.
+func (s *TenantService) tenant(tenant string, keep bool) (Service, error) {
+	if err := s.validate(tenant); err != nil {
+		return nil, NewServiceError(err, http.StatusBadRequest)
+	}
+
+	service, ok, err := s.kept(tenant, keep)
+	if ok || err != nil {
+		return service, err
+	}
+
+	service, err = s.build(tenant)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while creating service for tenant %s", tenant)
+	}
+	if !keep {
+		return service, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.services[tenant]; ok {
+		s.order.MoveToFront(elem)
+		return elem.Value.(*tenantEntry).service, nil
+	}
+	if err := s.full(); err != nil {
+		return nil, err
+	}
+
+	s.services[tenant] = s.order.PushFront(&tenantEntry{tenant: tenant, service: service})
+	if s.max > 0 && s.order.Len() > s.max {
+		last := s.order.Back()
+		s.order.Remove(last)
+		delete(s.services, last.Value.(*tenantEntry).tenant)
+	}
+	return service, nil
+}
+
+// kept returns the Service of the given tenant if it is kept. It fails if the
+// tenant would need to be kept but cannot be.
+func (s *TenantService) kept(tenant string, keep bool) (Service, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.services[tenant]; ok {
+		s.order.MoveToFront(elem)
+		return elem.Value.(*tenantEntry).service, true, nil
+	}
+	if keep {
+		return nil, false, s.full()
+	}
+	return nil, false, nil
+}
+
+// full fails if another tenant cannot be kept without evicting one which is
+// not allowed to be evicted. The lock must be held.
+func (s *TenantService) full() error {
+	if !s.evict && s.max > 0 && s.order.Len() >= s.max {
+		return NewServiceError(ErrTooManyTenants, http.StatusInsufficientStorage)
+	}
+	return nil
+}
+
+// service resolves the Service of the tenant in the context. The Service is
+// only kept if keep is true, i.e. if the operation creates a value.
+func (s *TenantService) service(ctx context.Context, keep bool) (Service, error) {
+	if err := CheckContext(ctx); err != nil {
+		return nil, err
+	}
+
+	tenant, err := s.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if tenant == "" {
+		return nil, NewServiceError(ErrNoTenant, http.StatusBadRequest)
+	}
+
+	return s.tenant(tenant, keep)
+}
+
+// Browse the values of the tenant.
+func (s *TenantService) Browse(ctx context.Context) ([]Model, error) {
+	service, err := s.service(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return service.Browse(ctx)
+}
+
+// Delete the values of the tenant.
+func (s *TenantService) Delete(ctx context.Context) ([]Model, error) {
+	service, err := s.service(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return service.Delete(ctx)
+}
+
+// Create a value for the tenant.
+func (s *TenantService) Create(ctx context.Context, reader io.Reader) (Model, error) {
+	service, err := s.service(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	return service.Create(ctx, reader)
+}
+
+// Select a value of the tenant.
+func (s *TenantService) Select(ctx context.Context, key string) (Model, error) {
+	service, err := s.service(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return service.Select(ctx, key)
+}
+
+// Remove a value of the tenant.
+func (s *TenantService) Remove(ctx context.Context, key string) (Model, error) {
+	service, err := s.service(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return service.Remove(ctx, key)
+}
+
+// Update a value of the tenant.
+func (s *TenantService) Update(ctx context.Context, key string, reader io.Reader) (Model, error) {
+	service, err := s.service(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return service.Update(ctx, key, reader)
+}
+
+// Modify a value of the tenant.
+func (s *TenantService) Modify(ctx context.Context, key string, reader io.Reader) (Model, error) {
+	service, err := s.service(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return service.Modify(ctx, key, reader)
+}
+
+// SelectWithDeleted selects a possibly soft deleted value of the tenant.
+func (s *TenantService) SelectWithDeleted(ctx context.Context, key string) (Model, error) {
+	service, err := s.service(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return asSoftDeleter(service).SelectWithDeleted(ctx, key)
+}
+
+// Restore a soft deleted value of the tenant.
+func (s *TenantService) Restore(ctx context.Context, key string) (Model, error) {
+	service, err := s.service(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return asSoftDeleter(service).Restore(ctx, key)
+}
+
+// Purge the soft deleted values of the tenant.
+func (s *TenantService) Purge(ctx context.Context) ([]Model, error) {
+	service, err := s.service(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return asSoftDeleter(service).Purge(ctx)
+}
+
+// Revisions lists the revisions of a value of the tenant.
+func (s *TenantService) Revisions(ctx context.Context, key string) ([]Revision, error) {
+	service, err := s.service(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return asReverter(service).Revisions(ctx, key)
+}
+
+// SelectRevision selects a revision of a value of the tenant.
+func (s *TenantService) SelectRevision(ctx context.Context, key string, number int) (Model, error) {
+	service, err := s.service(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return asReverter(service).SelectRevision(ctx, key, number)
+}
+
+// Revert a value of the tenant to a revision.
+func (s *TenantService) Revert(ctx context.Context, key string, number int) (Model, error) {
+	service, err := s.service(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return asReverter(service).Revert(ctx, key, number)
+}
+
+// CreateWithTTL creates an expiring value for the tenant.
+func (s *TenantService) CreateWithTTL(ctx context.Context, reader io.Reader, ttl time.Duration) (Model, error) {
+	service, err := s.service(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	return asExpirer(service).CreateWithTTL(ctx, reader, ttl)
+}
+
+// UpdateWithTTL updates a value of the tenant with a new TTL.
+func (s *TenantService) UpdateWithTTL(ctx context.Context, key string, reader io.Reader, ttl time.Duration) (Model, error) {
+	service, err := s.service(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return asExpirer(service).UpdateWithTTL(ctx, key, reader, ttl)
+}
@@ -0,0 +1,224 @@
+package rest_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	rest "github.com/ktnyt/go-rest"
+	"github.com/ktnyt/go-rest/resttest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenantService(t *testing.T) {
+	t.Run("isolates tenants", func(t *testing.T) {
+		service := rest.NewTenantDictService(rest.TenantFromContext, NewTodo, Filter, Convert, nil)
+
+		foo := rest.WithTenant(emptyContext, "foo")
+		bar := rest.WithTenant(emptyContext, "bar")
+
+		_, err := create(t, service, RandomTodo())
+		require.Equal(t, http.StatusBadRequest, err.(rest.ServiceError).Code)
+
+		data, err := json.Marshal(RandomTodo())
+		require.NoError(t, err)
+
+		a, err := service.Create(foo, bytes.NewReader(data))
+		require.NoError(t, err)
+
+		_, err = service.Select(bar, a.(*Todo).Key)
+		require.Error(t, err)
+
+		models, err := service.Browse(bar)
+		require.NoError(t, err)
+		require.Len(t, models, 0)
+
+		models, err = service.Browse(foo)
+		require.NoError(t, err)
+		require.Len(t, models, 1)
+
+		require.Equal(t, []string{"foo"}, service.Tenants())
+	})
+
+	t.Run("persists tenants with their own handlers", func(t *testing.T) {
+		handlers := make(map[string]rest.IOHandler)
+		service := rest.NewTenantIOService(rest.TenantFromParam("tenant"), func(tenant string) (rest.IOHandler, error) {
+			handlers[tenant] = NewBufferIOHandler(NewTodoDictService)
+			return handlers[tenant], nil
+		}, nil)
+
+		foo := context.WithValue(emptyContext, "tenant", "foo")
+		bar := context.WithValue(emptyContext, "tenant", "bar")
+
+		for _, ctx := range []context.Context{foo, foo, bar} {
+			data, err := json.Marshal(RandomTodo())
+			require.NoError(t, err)
+			_, err = service.Create(ctx, bytes.NewReader(data))
+			require.NoError(t, err)
+		}
+
+		require.Len(t, handlers, 2)
+
+		loaded, err := handlers["foo"].Load()
+		require.NoError(t, err)
+		models, err := loaded.Browse(emptyContext)
+		require.NoError(t, err)
+		require.Len(t, models, 2)
+
+		loaded, err = handlers["bar"].Load()
+		require.NoError(t, err)
+		models, err = loaded.Browse(emptyContext)
+		require.NoError(t, err)
+		require.Len(t, models, 1)
+	})
+
+	t.Run("resolves tenants from principals", func(t *testing.T) {
+		service := rest.NewTenantDictService(rest.TenantFromPrincipal("org"), NewTodo, Filter, Convert, nil)
+
+		_, err := service.Browse(emptyContext)
+		require.Equal(t, http.StatusUnauthorized, err.(rest.ServiceError).Code)
+
+		ctx := rest.WithPrincipal(emptyContext, &rest.Principal{ID: "user"})
+		_, err = service.Browse(ctx)
+		require.Equal(t, http.StatusForbidden, err.(rest.ServiceError).Code)
+
+		ctx = rest.WithPrincipal(emptyContext, &rest.Principal{
+			ID:         "user",
+			Attributes: map[string]interface{}{"org": "foo"},
+		})
+		_, err = service.Create(ctx, bytes.NewReader(mustMarshal(RandomTodo())))
+		require.NoError(t, err)
+		require.Equal(t, []string{"foo"}, service.Tenants())
+	})
+
+	t.Run("resolves tenants from headers", func(t *testing.T) {
+		service := rest.NewTenantDictService(rest.TenantFromContext, NewTodo, Filter, Convert, nil)
+		iface := rest.TenantHeader("X-Tenant")(rest.NewServiceInterface(service))
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		iface.Browse(w, r)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(mustMarshal(RandomTodo())))
+		r.Header.Set("X-Tenant", "foo")
+		iface.Create(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, []string{"foo"}, service.Tenants())
+	})
+
+	t.Run("keeps tenants only once values are created", func(t *testing.T) {
+		service := rest.NewTenantDictService(rest.TenantFromContext, NewTodo, Filter, Convert, nil)
+		foo := rest.WithTenant(emptyContext, "foo")
+
+		for i := 0; i < 3; i++ {
+			_, err := service.Browse(rest.WithTenant(emptyContext, fmt.Sprintf("tenant%d", i)))
+			require.NoError(t, err)
+			_, err = service.Remove(foo, "0")
+			require.Error(t, err)
+		}
+		require.Empty(t, service.Tenants())
+
+		_, err := service.Create(foo, bytes.NewReader(mustMarshal(RandomTodo())))
+		require.NoError(t, err)
+		require.Equal(t, []string{"foo"}, service.Tenants())
+	})
+
+	t.Run("validates tenant IDs", func(t *testing.T) {
+		built := 0
+		service := rest.NewTenantService(rest.TenantFromContext, func(string) (rest.Service, error) {
+			built++
+			return NewTodoDictService(), nil
+		})
+
+		for _, tenant := range []string{"../foo", "foo/bar", ".foo", strings.Repeat("a", rest.MaxTenantLength+1)} {
+			_, err := service.Browse(rest.WithTenant(emptyContext, tenant))
+			resttest.RequireStatus(t, http.StatusBadRequest, err)
+		}
+		require.Equal(t, 0, built)
+
+		service = rest.NewTenantService(rest.TenantFromContext, func(string) (rest.Service, error) {
+			return NewTodoDictService(), nil
+		}, rest.WithTenantValidator(func(tenant string) error {
+			if tenant != "foo" {
+				return errors.New("unknown tenant")
+			}
+			return nil
+		}))
+
+		_, err := service.Browse(rest.WithTenant(emptyContext, "bar"))
+		resttest.RequireStatus(t, http.StatusBadRequest, err)
+		_, err = service.Browse(rest.WithTenant(emptyContext, "foo"))
+		require.NoError(t, err)
+	})
+
+	t.Run("evicts the least recently used tenants", func(t *testing.T) {
+		handlers := make(map[string]rest.IOHandler)
+		service := rest.NewTenantIOService(rest.TenantFromContext, func(tenant string) (rest.IOHandler, error) {
+			if _, ok := handlers[tenant]; !ok {
+				handlers[tenant] = NewBufferIOHandler(NewTodoDictService)
+			}
+			return handlers[tenant], nil
+		}, nil, rest.WithMaxTenants(2))
+
+		for _, tenant := range []string{"foo", "bar", "foo", "baz"} {
+			_, err := service.Create(rest.WithTenant(emptyContext, tenant), bytes.NewReader(mustMarshal(RandomTodo())))
+			require.NoError(t, err)
+		}
+		require.Equal(t, []string{"baz", "foo"}, service.Tenants())
+
+		models, err := service.Browse(rest.WithTenant(emptyContext, "bar"))
+		require.NoError(t, err)
+		require.Len(t, models, 1)
+		require.Equal(t, []string{"baz", "foo"}, service.Tenants())
+	})
+	t.Run("refuses to evict in-memory tenants", func(t *testing.T) {
+		service := rest.NewTenantDictService(rest.TenantFromContext, NewTodo, Filter, Convert, nil, rest.WithMaxTenants(1))
+		foo := rest.WithTenant(emptyContext, "foo")
+		bar := rest.WithTenant(emptyContext, "bar")
+
+		_, err := service.Create(foo, bytes.NewReader(mustMarshal(RandomTodo())))
+		require.NoError(t, err)
+		_, err = service.Create(bar, bytes.NewReader(mustMarshal(RandomTodo())))
+		resttest.RequireStatus(t, http.StatusInsufficientStorage, err)
+
+		_, err = service.Browse(bar)
+		require.NoError(t, err)
+		models, err := service.Browse(foo)
+		require.NoError(t, err)
+		require.Len(t, models, 1)
+		require.Equal(t, []string{"foo"}, service.Tenants())
+	})
+
+	t.Run("builds tenants without blocking others", func(t *testing.T) {
+		building := make(chan struct{})
+		release := make(chan struct{})
+		service := rest.NewTenantService(rest.TenantFromContext, func(tenant string) (rest.Service, error) {
+			if tenant == "slow" {
+				close(building)
+				<-release
+			}
+			return NewTodoDictService(), nil
+		})
+
+		done := make(chan error)
+		go func() {
+			_, err := service.Create(rest.WithTenant(emptyContext, "slow"), bytes.NewReader(mustMarshal(RandomTodo())))
+			done <- err
+		}()
+
+		<-building
+		_, err := service.Create(rest.WithTenant(emptyContext, "fast"), bytes.NewReader(mustMarshal(RandomTodo())))
+		require.NoError(t, err)
+		close(release)
+		require.NoError(t, <-done)
+		require.Equal(t, []string{"fast", "slow"}, service.Tenants())
+	})
+}